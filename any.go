@@ -0,0 +1,96 @@
+package fmutils
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const anyFullName protoreflect.FullName = "google.protobuf.Any"
+
+// unpackAny returns the message packed into the google.protobuf.Any message rft.
+//
+// The second return value is false if the packed message type can't be resolved or its value can't be decoded.
+func unpackAny(rft protoreflect.Message) (protoreflect.Message, bool) {
+	fields := rft.Descriptor().Fields()
+	typeURL := rft.Get(fields.ByNumber(1)).String()
+	mt, err := protoregistry.GlobalTypes.FindMessageByURL(typeURL)
+	if err != nil {
+		return nil, false
+	}
+	inner := mt.New()
+	err = proto.UnmarshalOptions{AllowPartial: true}.Unmarshal(rft.Get(fields.ByNumber(2)).Bytes(), inner.Interface())
+	if err != nil {
+		return nil, false
+	}
+	return inner, true
+}
+
+// repackAny replaces the value of the google.protobuf.Any message rft with the encoded inner message.
+//
+// The required fields of the inner message may be unset, e.g. cleared by a mask. If the inner message can't be
+// encoded then rft is left untouched.
+func repackAny(rft, inner protoreflect.Message) {
+	b, err := proto.MarshalOptions{AllowPartial: true}.Marshal(inner.Interface())
+	if err != nil {
+		return
+	}
+	rft.Set(rft.Descriptor().Fields().ByNumber(2), protoreflect.ValueOfBytes(b))
+}
+
+// FilterAnyByType keeps the fields of the message packed into the google.protobuf.Any located at anyPath in msg
+// using the paths listed for its type in masks and clears all the rest.
+//
+// This allows redacting polymorphic payloads, e.g. keeping "user.name" if the payload is a Profile and "next_token"
+// if it is a Result. The anyPath is a dotted path of message fields and message map values leading to a singular Any
+// field or to a repeated Any field, in which case every element is filtered using the mask for its own type. The Any
+// messages packing the types that are not listed in masks or that can't be resolved are left opaque and untouched.
+// The required fields of the packed proto2 messages may be cleared like any other fields.
+func FilterAnyByType(msg proto.Message, anyPath string, masks map[protoreflect.FullName][]string) {
+	if isNil(msg) {
+		return
+	}
+	for _, rft := range anyMessagesAt(msg.ProtoReflect(), anyPath) {
+		inner, ok := unpackAny(rft)
+		if !ok {
+			continue
+		}
+		paths, ok := masks[inner.Descriptor().FullName()]
+		if !ok {
+			continue
+		}
+		NestedMaskFromPaths(paths).filter(inner, "", nil, FilterOptions{})
+		repackAny(rft, inner)
+	}
+}
+
+// anyMessagesAt returns the set google.protobuf.Any messages located at the path in rft: either the singular
+// message or the elements of the repeated field.
+func anyMessagesAt(rft protoreflect.Message, path string) []protoreflect.Message {
+	if m, ok := messageAt(rft, path); ok {
+		if m.Descriptor().FullName() != anyFullName {
+			return nil
+		}
+		return []protoreflect.Message{m}
+	}
+	parentPath, name := "", path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parentPath, name = path[:i], path[i+1:]
+	}
+	parent, ok := messageAt(rft, parentPath)
+	if !ok {
+		return nil
+	}
+	fd := parent.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil || !fd.IsList() || fd.Message() == nil || fd.Message().FullName() != anyFullName {
+		return nil
+	}
+	list := parent.Get(fd).List()
+	messages := make([]protoreflect.Message, list.Len())
+	for i := range messages {
+		messages[i] = list.Get(i).Message()
+	}
+	return messages
+}
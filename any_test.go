@@ -0,0 +1,111 @@
+package fmutils
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestFilterAnyByType(t *testing.T) {
+	masks := map[protoreflect.FullName][]string{
+		"testproto.Profile": {"user.name"},
+		"testproto.Result":  {"next_token"},
+		"testproto.Owner":   {"name"},
+	}
+	profile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:  &testproto.User{UserId: 1, Name: "user name"},
+			Photo: &testproto.Photo{PhotoId: 2, Path: "photo path"},
+		}
+	}
+	result := func() *testproto.Result {
+		return &testproto.Result{Data: []byte("bytes"), NextToken: 3}
+	}
+	unresolvable := &anypb.Any{TypeUrl: "example.com/unknown.Type", Value: []byte("opaque")}
+	tests := []struct {
+		name    string
+		msg     proto.Message
+		anyPath string
+		want    proto.Message
+	}{
+		{
+			name:    "profile payload",
+			msg:     &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(profile())}},
+			anyPath: "details",
+			want: &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(&testproto.Profile{
+				User: &testproto.User{Name: "user name"},
+			})}},
+		},
+		{
+			name:    "result payload",
+			msg:     &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(result())}},
+			anyPath: "details",
+			want:    &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(&testproto.Result{NextToken: 3})}},
+		},
+		{
+			name: "partial proto2 payload",
+			msg: &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(&testproto.Owner{
+				Email: proto.String("email"),
+				Name:  proto.String("name"),
+			})}},
+			anyPath: "details",
+			want:    &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(&testproto.Owner{Name: proto.String("name")})}},
+		},
+		{
+			name:    "unlisted type is untouched",
+			msg:     &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(&testproto.User{UserId: 1, Name: "name"})}},
+			anyPath: "details",
+			want:    &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(&testproto.User{UserId: 1, Name: "name"})}},
+		},
+		{
+			name:    "unresolvable type is untouched",
+			msg:     &testproto.Event{Changed: &testproto.Event_Details{Details: proto.Clone(unresolvable).(*anypb.Any)}},
+			anyPath: "details",
+			want:    &testproto.Event{Changed: &testproto.Event_Details{Details: proto.Clone(unresolvable).(*anypb.Any)}},
+		},
+		{
+			name: "repeated payloads of mixed types",
+			msg: &testproto.Event{Payloads: []*anypb.Any{
+				createAny(profile()),
+				createAny(result()),
+				createAny(&testproto.User{UserId: 1}),
+			}},
+			anyPath: "payloads",
+			want: &testproto.Event{Payloads: []*anypb.Any{
+				createAny(&testproto.Profile{User: &testproto.User{Name: "user name"}}),
+				createAny(&testproto.Result{NextToken: 3}),
+				createAny(&testproto.User{UserId: 1}),
+			}},
+		},
+		{
+			name:    "unset Any",
+			msg:     &testproto.Event{EventId: 1},
+			anyPath: "details",
+			want:    &testproto.Event{EventId: 1},
+		},
+		{
+			name:    "path to a non-Any field",
+			msg:     &testproto.Event{Changed: &testproto.Event_Profile{Profile: profile()}},
+			anyPath: "profile",
+			want:    &testproto.Event{Changed: &testproto.Event_Profile{Profile: profile()}},
+		},
+		{
+			name:    "path to a missing field",
+			msg:     &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(result())}},
+			anyPath: "missing.details",
+			want:    &testproto.Event{Changed: &testproto.Event_Details{Details: createAny(result())}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			FilterAnyByType(tt.msg, tt.anyPath, masks)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package fmutils
+
+import (
+	"bytes"
+	"math"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FilterChanged clears all the msg fields that are equal to the corresponding fields of the baseline, so that only
+// the changed fields remain.
+//
+// Message fields set in both messages are processed recursively and are cleared if no changes are left in them.
+// Repeated fields are kept as a whole if they differ in any way since their elements are matched by position.
+// Map entries are matched by key: the entries that are equal to the baseline ones are deleted and the others are kept
+// as a whole. Fields and map entries removed from the msg are not represented in the result.
+// If either message is nil or the messages are of different types the msg is left untouched.
+func FilterChanged(msg, baseline proto.Message) {
+	if isNil(msg) || isNil(baseline) {
+		return
+	}
+	rft, baseRft := msg.ProtoReflect(), baseline.ProtoReflect()
+	if rft.Descriptor().FullName() != baseRft.Descriptor().FullName() {
+		return
+	}
+	filterChanged(rft, baseRft)
+}
+
+// filterChanged clears the rft fields equal to the baseRft ones and reports whether there are no changes left.
+func filterChanged(rft, baseRft protoreflect.Message) bool {
+	rft.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if !baseRft.Has(fd) {
+			return true
+		}
+		baseV := baseRft.Get(fd)
+		switch {
+		case fd.IsMap():
+			baseMap := baseV.Map()
+			xmap := v.Map()
+			xmap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+				if baseMap.Has(mk) && valuesEqual(fd.MapValue(), mv, baseMap.Get(mk)) {
+					xmap.Clear(mk)
+				}
+				return true
+			})
+			if xmap.Len() == 0 {
+				rft.Clear(fd)
+			}
+		case fd.IsList():
+			if listsEqual(fd, v.List(), baseV.List()) {
+				rft.Clear(fd)
+			}
+		case fd.Message() != nil:
+			if filterChanged(v.Message(), baseV.Message()) {
+				rft.Clear(fd)
+			}
+		default:
+			if valuesEqual(fd, v, baseV) {
+				rft.Clear(fd)
+			}
+		}
+		return true
+	})
+
+	unchanged := bytes.Equal(rft.GetUnknown(), baseRft.GetUnknown())
+	rft.Range(func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+		unchanged = false
+		return false
+	})
+	return unchanged
+}
+
+// listsEqual reports whether the lists a and b of the repeated field fd have equal elements.
+func listsEqual(fd protoreflect.FieldDescriptor, a, b protoreflect.List) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for i := 0; i < a.Len(); i++ {
+		if !valuesEqual(fd, a.Get(i), b.Get(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesEqual reports whether the singular values a and b of the field fd are equal.
+//
+// Like proto.Equal, it considers two NaN floats equal and 0.0 equal to -0.0.
+func valuesEqual(fd protoreflect.FieldDescriptor, a, b protoreflect.Value) bool {
+	switch {
+	case fd.Message() != nil:
+		return proto.Equal(a.Message().Interface(), b.Message().Interface())
+	case fd.Kind() == protoreflect.BytesKind:
+		return bytes.Equal(a.Bytes(), b.Bytes())
+	case fd.Kind() == protoreflect.FloatKind || fd.Kind() == protoreflect.DoubleKind:
+		x, y := a.Float(), b.Float()
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return math.IsNaN(x) && math.IsNaN(y)
+		}
+		return x == y
+	}
+	return a.Interface() == b.Interface()
+}
@@ -0,0 +1,121 @@
+package fmutils
+
+import (
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestFilterChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      proto.Message
+		baseline proto.Message
+		want     proto.Message
+	}{
+		{
+			name: "nested changes",
+			msg: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "new name"},
+				Photo: &testproto.Photo{Path: "path", Dimensions: &testproto.Dimensions{Width: 100, Height: 50}},
+			},
+			baseline: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "old name"},
+				Photo: &testproto.Photo{Path: "path", Dimensions: &testproto.Dimensions{Width: 100, Height: 40}},
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{Name: "new name"},
+				Photo: &testproto.Photo{Dimensions: &testproto.Dimensions{Height: 50}},
+			},
+		},
+		{
+			name: "added fields are kept",
+			msg: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{Path: "path"},
+			},
+			baseline: &testproto.Profile{
+				User: &testproto.User{UserId: 1},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "path"},
+			},
+		},
+		{
+			name: "repeated fields",
+			msg: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2, 3},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2}},
+			},
+			baseline: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2}},
+			},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2, 3},
+			},
+		},
+		{
+			name: "map entries",
+			msg: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"same":    {Tags: map[string]string{"t1": "v1"}},
+					"changed": {Tags: map[string]string{"t1": "new", "t2": "v2"}},
+					"added":   {},
+				},
+			},
+			baseline: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"same":    {Tags: map[string]string{"t1": "v1"}},
+					"changed": {Tags: map[string]string{"t1": "old", "t2": "v2"}},
+					"removed": {},
+				},
+			},
+			want: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"changed": {Tags: map[string]string{"t1": "new", "t2": "v2"}},
+					"added":   {},
+				},
+			},
+		},
+		{
+			name: "no changes",
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+			baseline: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+			want: &testproto.Event{},
+		},
+		{
+			name:     "NaN floats are unchanged",
+			msg:      &testproto.Measurement{Value: math.NaN(), Ratio: 1},
+			baseline: &testproto.Measurement{Value: math.NaN(), Ratio: 2},
+			want:     &testproto.Measurement{Ratio: 1},
+		},
+		{
+			name:     "different types",
+			msg:      &testproto.User{UserId: 1},
+			baseline: &testproto.Photo{PhotoId: 1},
+			want:     &testproto.User{UserId: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := proto.Clone(tt.baseline)
+			FilterChanged(tt.msg, tt.baseline)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+			if !proto.Equal(tt.baseline, baseline) {
+				t.Errorf("baseline is modified: %v", tt.baseline)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package fmutils
+
+import (
+	"bytes"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Compact clears all the msg fields holding empty values, so that only the meaningful fields remain set.
+//
+// Scalar fields holding the default value (including the ones with explicit presence), empty repeated fields, empty
+// maps and message fields left without populated fields after they are compacted themselves are cleared.
+// The elements of repeated message fields and the message map values are compacted recursively but are never
+// removed since their positions and keys are meaningful. Nil message map values are kept as is.
+func Compact(msg proto.Message) {
+	if isNil(msg) {
+		return
+	}
+	compact(msg.ProtoReflect())
+}
+
+// compact compacts the rft and reports whether it has no populated fields left.
+func compact(rft protoreflect.Message) bool {
+	fields := rft.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !rft.Has(fd) {
+			if fd.IsList() || fd.IsMap() {
+				// Drop the explicitly set but empty containers.
+				rft.Clear(fd)
+			}
+			continue
+		}
+		v := rft.Get(fd)
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					// A nil message value is read-only and has nothing to compact.
+					if mv.Message().IsValid() {
+						compact(mv.Message())
+					}
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				list := v.List()
+				for i := 0; i < list.Len(); i++ {
+					compact(list.Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			if compact(v.Message()) {
+				rft.Clear(fd)
+			}
+		case isDefault(fd, v):
+			rft.Clear(fd)
+		}
+	}
+
+	empty := len(rft.GetUnknown()) == 0
+	rft.Range(func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
+
+// isDefault reports whether the value v of the scalar field fd is the default value of the field.
+func isDefault(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+	if fd.Kind() == protoreflect.BytesKind {
+		return bytes.Equal(v.Bytes(), fd.Default().Bytes())
+	}
+	return v.Interface() == fd.Default().Interface()
+}
@@ -0,0 +1,98 @@
+package fmutils
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  proto.Message
+		want proto.Message
+	}{
+		{
+			name: "empty messages are cleared",
+			msg: &testproto.Profile{
+				User:  &testproto.User{},
+				Photo: &testproto.Photo{Dimensions: &testproto.Dimensions{}},
+				Gallery: []*testproto.Photo{
+					{Dimensions: &testproto.Dimensions{}},
+					{PhotoId: 1},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{}},
+				},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{},
+					{PhotoId: 1},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {},
+				},
+			},
+		},
+		{
+			name: "optional fields holding default values are cleared",
+			msg: &testproto.Options{
+				OptionalString: proto.String(""),
+				OptionalInt:    proto.Int64(1),
+			},
+			want: &testproto.Options{
+				OptionalInt: proto.Int64(1),
+			},
+		},
+		{
+			name: "oneof with an empty message is cleared",
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_User{User: &testproto.User{}},
+			},
+			want: &testproto.Event{EventId: 1},
+		},
+		{
+			name: "nil map values are kept",
+			msg: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": nil,
+					"a2": {Tags: map[string]string{}},
+				},
+			},
+			want: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": nil,
+					"a2": {},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Compact(tt.msg)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompact_EmptyContainers(t *testing.T) {
+	msg := &testproto.Profile{
+		User:            &testproto.User{UserId: 1},
+		LoginTimestamps: []int64{},
+		Gallery:         []*testproto.Photo{},
+		Attributes:      map[string]*testproto.Attribute{},
+	}
+	Compact(msg)
+	if msg.LoginTimestamps != nil || msg.Gallery != nil || msg.Attributes != nil {
+		t.Errorf("empty containers are not cleared: %#v, %#v, %#v", msg.LoginTimestamps, msg.Gallery, msg.Attributes)
+	}
+	if msg.User.GetUserId() != 1 {
+		t.Errorf("user is cleared: %v", msg.User)
+	}
+}
@@ -0,0 +1,122 @@
+package fmutils
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// OverwriteCompatible overwrites all the fields listed in paths in the dest msg using values from the src msg of
+// a different but compatible type.
+//
+// This is a handy wrapper for NestedMask.OverwriteCompatible method.
+func OverwriteCompatible(src, dest proto.Message, paths []string) error {
+	return NestedMaskFromPaths(paths).OverwriteCompatible(src, dest)
+}
+
+// OverwriteCompatible works like NestedMask.Overwrite but allows the src and dest messages to be of different
+// types, e.g. an internal and an external variant of the same message.
+//
+// The mask paths refer to the src field names. Every listed src field is matched with the dest field of the same
+// number (the names may differ) and both fields must have the same kind and cardinality: both must be maps with the
+// same key and value kinds or neither. Nested message fields are matched the same way using their own types.
+// Oneofs may be listed by name if dest has a oneof with the same name.
+// Fields nested in a message field listed without a sub-mask are matched by number too and the ones that are
+// missing in dest are dropped.
+// If any of the listed fields is not compatible an error is returned and dest is left untouched.
+// The src msg is converted to the dest type using the wire format, so the field values are copied by number.
+func (mask NestedMask) OverwriteCompatible(src, dest proto.Message) error {
+	if isNil(src) || isNil(dest) {
+		return nil
+	}
+	srcMD := src.ProtoReflect().Descriptor()
+	destMD := dest.ProtoReflect().Descriptor()
+	if srcMD == destMD {
+		mask.Overwrite(src, dest)
+		return nil
+	}
+	destMask, err := mask.matchByNumber(srcMD, destMD, "")
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(src)
+	if err != nil {
+		return err
+	}
+	converted := dest.ProtoReflect().New().Interface()
+	if err := (proto.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, converted); err != nil {
+		return err
+	}
+	destMask.Overwrite(converted, dest)
+	return nil
+}
+
+// matchByNumber returns a copy of the mask with the srcMD field names replaced by the names of the destMD fields
+// of the same numbers.
+func (mask NestedMask) matchByNumber(srcMD, destMD protoreflect.MessageDescriptor, prefix string) (NestedMask, error) {
+	destMask := make(NestedMask, len(mask))
+	for _, name := range mask.sortedKeys() {
+		submask := mask[name]
+		path := childPath(prefix, name, true)
+		srcFD := srcMD.Fields().ByName(protoreflect.Name(name))
+		if srcFD == nil {
+			if srcMD.Oneofs().ByName(protoreflect.Name(name)) != nil && destMD.Oneofs().ByName(protoreflect.Name(name)) != nil {
+				destMask[name] = submask
+				continue
+			}
+			return nil, fmt.Errorf("fmutils: invalid path %q: message %s has no field or oneof %q", path, srcMD.FullName(), name)
+		}
+		destFD := destMD.Fields().ByNumber(srcFD.Number())
+		if destFD == nil {
+			return nil, fmt.Errorf("fmutils: path %q: message %s has no field number %d", path, destMD.FullName(), srcFD.Number())
+		}
+		if !compatibleFields(srcFD, destFD) {
+			return nil, fmt.Errorf("fmutils: path %q: field %s is not compatible with %s", path, srcFD.FullName(), destFD.FullName())
+		}
+		destSubmask := submask
+		if len(submask) > 0 {
+			var err error
+			switch {
+			case srcFD.IsMap():
+				if srcFD.MapValue().Message() == nil {
+					break
+				}
+				destSubmask = make(NestedMask, len(submask))
+				for key, m := range submask {
+					if destSubmask[key], err = m.matchByNumber(srcFD.MapValue().Message(), destFD.MapValue().Message(), childPath(path, key, true)); err != nil {
+						return nil, err
+					}
+				}
+			case srcFD.Message() != nil && srcFD.IsList():
+				fieldsMask, indexes := submask.splitIndexes()
+				if destSubmask, err = fieldsMask.matchByNumber(srcFD.Message(), destFD.Message(), path); err != nil {
+					return nil, err
+				}
+				for i, m := range indexes {
+					key := fmt.Sprintf("[%d]", i)
+					if destSubmask[key], err = m.matchByNumber(srcFD.Message(), destFD.Message(), path+key); err != nil {
+						return nil, err
+					}
+				}
+			case srcFD.Message() != nil:
+				if destSubmask, err = submask.matchByNumber(srcFD.Message(), destFD.Message(), path); err != nil {
+					return nil, err
+				}
+			}
+		}
+		destMask[string(destFD.Name())] = destSubmask
+	}
+	return destMask, nil
+}
+
+// compatibleFields reports whether the values of the src field may be stored in the dest field.
+func compatibleFields(src, dest protoreflect.FieldDescriptor) bool {
+	if src.Kind() != dest.Kind() || src.Cardinality() != dest.Cardinality() || src.IsMap() != dest.IsMap() {
+		return false
+	}
+	if src.IsMap() {
+		return compatibleFields(src.MapKey(), dest.MapKey()) && compatibleFields(src.MapValue(), dest.MapValue())
+	}
+	return true
+}
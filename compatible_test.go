@@ -0,0 +1,127 @@
+package fmutils
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestOverwriteCompatible(t *testing.T) {
+	src := &testproto.Profile{
+		User: &testproto.User{UserId: 1, Name: "name"},
+		Photo: &testproto.Photo{
+			PhotoId:    2,
+			Path:       "path",
+			Dimensions: &testproto.Dimensions{Width: 100},
+		},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 3, Path: "path 3"},
+			{PhotoId: 4, Path: "path 4"},
+		},
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		dest  proto.Message
+		want  proto.Message
+	}{
+		{
+			name:  "whole fields",
+			paths: []string{"user", "photo"},
+			dest: &testproto.ProfileV1{
+				Gallery: []*testproto.PhotoV1{{PhotoId: 5}},
+			},
+			want: &testproto.ProfileV1{
+				User:    &testproto.User{UserId: 1, Name: "name"},
+				Photo:   &testproto.PhotoV1{PhotoId: 2, Path: "path"},
+				Gallery: []*testproto.PhotoV1{{PhotoId: 5}},
+			},
+		},
+		{
+			name:  "nested fields",
+			paths: []string{"user.name", "photo.path", "gallery.photo_id", "gallery[1].path"},
+			dest: &testproto.ProfileV1{
+				User:  &testproto.User{UserId: 10},
+				Photo: &testproto.PhotoV1{PhotoId: 20},
+			},
+			want: &testproto.ProfileV1{
+				User:  &testproto.User{UserId: 10, Name: "name"},
+				Photo: &testproto.PhotoV1{PhotoId: 20, Path: "path"},
+				Gallery: []*testproto.PhotoV1{
+					{PhotoId: 3},
+					{PhotoId: 4, Path: "path 4"},
+				},
+			},
+		},
+		{
+			name:  "same type",
+			paths: []string{"user.name"},
+			dest:  &testproto.Profile{},
+			want:  &testproto.Profile{User: &testproto.User{Name: "name"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := OverwriteCompatible(src, tt.dest, tt.paths); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !proto.Equal(tt.dest, tt.want) {
+				t.Errorf("dest %v, want %v", tt.dest, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverwriteCompatible_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     proto.Message
+		dest    proto.Message
+		paths   []string
+		wantErr string
+	}{
+		{
+			name:    "missing dest field",
+			src:     &testproto.Profile{},
+			dest:    &testproto.ProfileV1{},
+			paths:   []string{"user", "login_timestamps"},
+			wantErr: "message testproto.ProfileV1 has no field number 3",
+		},
+		{
+			name:    "missing nested dest field",
+			src:     &testproto.Profile{},
+			dest:    &testproto.ProfileV1{},
+			paths:   []string{"photo.dimensions"},
+			wantErr: "message testproto.PhotoV1 has no field number 3",
+		},
+		{
+			name:    "incompatible kinds",
+			src:     &testproto.User{},
+			dest:    &testproto.Result{},
+			paths:   []string{"user_id"},
+			wantErr: "field testproto.User.user_id is not compatible with testproto.Result.data",
+		},
+		{
+			name:    "unknown src field",
+			src:     &testproto.User{},
+			dest:    &testproto.Result{},
+			paths:   []string{"foo"},
+			wantErr: `message testproto.User has no field or oneof "foo"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := proto.Clone(tt.dest)
+			err := OverwriteCompatible(tt.src, tt.dest, tt.paths)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+			if !proto.Equal(tt.dest, want) {
+				t.Errorf("dest %v, want %v", tt.dest, want)
+			}
+		})
+	}
+}
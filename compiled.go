@@ -0,0 +1,90 @@
+package fmutils
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CompiledMask is a mask validated against and bound to a single message type.
+//
+// Compile the mask once and use it to filter or prune any number of messages of that type: the paths are parsed and
+// validated only once. A CompiledMask may be used from multiple goroutines concurrently, but Compile and Reset must
+// not be called concurrently with any other method. Reset and a subsequent Compile re-bind the CompiledMask to
+// another message type, so CompiledMask values may be kept in a sync.Pool.
+type CompiledMask struct {
+	mask NestedMask
+	desc protoreflect.MessageDescriptor
+}
+
+// Compile validates the paths against the msg type and returns the CompiledMask bound to that type.
+func Compile(msg proto.Message, paths []string) (*CompiledMask, error) {
+	c := &CompiledMask{}
+	if err := c.Compile(msg, paths); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Compile validates the paths against the msg type and binds c to that type replacing the previously compiled mask.
+//
+// If the paths are invalid an error is returned and c is left unbound as after Reset.
+func (c *CompiledMask) Compile(msg proto.Message, paths []string) error {
+	c.Reset()
+	mask, err := validatedMask(msg, paths)
+	if err != nil {
+		return err
+	}
+	c.mask = mask
+	c.desc = msg.ProtoReflect().Descriptor()
+	return nil
+}
+
+// Reset drops the compiled mask and the message type c is bound to, so that c may be compiled for another type.
+func (c *CompiledMask) Reset() {
+	c.mask = nil
+	c.desc = nil
+}
+
+// Descriptor returns the descriptor of the message type c is bound to or nil if c is not compiled.
+func (c *CompiledMask) Descriptor() protoreflect.MessageDescriptor {
+	return c.desc
+}
+
+// Filter keeps the msg fields that are listed in the compiled mask and clears all the rest.
+//
+// An error is returned if c is not compiled or msg is not of the type c is bound to.
+func (c *CompiledMask) Filter(msg proto.Message) error {
+	if err := c.check(msg); err != nil {
+		return err
+	}
+	c.mask.Filter(msg)
+	return nil
+}
+
+// Prune clears all the fields listed in the compiled mask from the given msg.
+//
+// An error is returned if c is not compiled or msg is not of the type c is bound to.
+func (c *CompiledMask) Prune(msg proto.Message) error {
+	if err := c.check(msg); err != nil {
+		return err
+	}
+	c.mask.Prune(msg)
+	return nil
+}
+
+// check returns an error if msg can't be processed by c.
+func (c *CompiledMask) check(msg proto.Message) error {
+	if c.desc == nil {
+		return errors.New("fmutils: mask is not compiled")
+	}
+	if msg == nil {
+		return nil
+	}
+	if name := msg.ProtoReflect().Descriptor().FullName(); name != c.desc.FullName() {
+		return fmt.Errorf("fmutils: mask is compiled for %s, got %s", c.desc.FullName(), name)
+	}
+	return nil
+}
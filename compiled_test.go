@@ -0,0 +1,103 @@
+package fmutils
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestCompiledMask(t *testing.T) {
+	c, err := Compile(&testproto.Profile{}, []string{"user.name", "photo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := &testproto.Profile{
+		User:  &testproto.User{UserId: 1, Name: "name"},
+		Photo: &testproto.Photo{PhotoId: 2},
+	}
+	if err := c.Filter(msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &testproto.Profile{User: &testproto.User{Name: "name"}, Photo: &testproto.Photo{PhotoId: 2}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+	if err := c.Prune(msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (&testproto.Profile{User: &testproto.User{}}); !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+
+	err = c.Filter(&testproto.Event{})
+	if err == nil || !strings.Contains(err.Error(), "compiled for testproto.Profile, got testproto.Event") {
+		t.Errorf("error %v, want a message type error", err)
+	}
+
+	c.Reset()
+	if c.Descriptor() != nil {
+		t.Errorf("Descriptor() = %v, want nil after Reset", c.Descriptor().FullName())
+	}
+	if err := c.Prune(msg); err == nil || !strings.Contains(err.Error(), "not compiled") {
+		t.Errorf("error %v, want a not compiled error", err)
+	}
+
+	if err := c.Compile(&testproto.Event{}, []string{"event_id"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	event := &testproto.Event{EventId: 1, Changed: &testproto.Event_Status{Status: testproto.Status_OK}}
+	if err := c.Filter(event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (&testproto.Event{EventId: 1}); !proto.Equal(event, want) {
+		t.Errorf("msg %v, want %v", event, want)
+	}
+
+	if err := c.Compile(&testproto.Event{}, []string{"foo"}); err == nil {
+		t.Error("Compile() error is nil, want an invalid path error")
+	}
+	if c.Descriptor() != nil {
+		t.Error("Descriptor() is not nil after a failed Compile")
+	}
+	if _, err := Compile(&testproto.Profile{}, []string{"user.foo"}); err == nil {
+		t.Error("Compile() error is nil, want an invalid path error")
+	}
+}
+
+var benchmarkPaths = []string{"user.name", "photo.dimensions.width", "gallery.path", "attributes.a1.tags.t1"}
+
+func BenchmarkCompiledMask_fresh(b *testing.B) {
+	profile := benchmarkProfile()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c, err := Compile(profile, benchmarkPaths)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := c.Filter(proto.Clone(profile)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledMask_pooled(b *testing.B) {
+	profile := benchmarkProfile()
+	pool := sync.Pool{New: func() interface{} { return &CompiledMask{} }}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := pool.Get().(*CompiledMask)
+		if c.Descriptor() != profile.ProtoReflect().Descriptor() {
+			if err := c.Compile(profile, benchmarkPaths); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := c.Filter(proto.Clone(profile)); err != nil {
+			b.Fatal(err)
+		}
+		pool.Put(c)
+	}
+}
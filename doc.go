@@ -0,0 +1,29 @@
+// Package fmutils provides helpers to filter, prune and overwrite protobuf messages using field masks.
+//
+// # Paths
+//
+// A path is a dotted list of field names, e.g. "photo.dimensions.width", following the
+// google.golang.org/protobuf/types/known/fieldmaskpb conventions. On top of them the paths support:
+//   - map keys in their protoreflect.MapKey.String form: strings as is, bools as "true" or "false" and integers in
+//     decimal, e.g. "attributes.a1.tags" or "flags.true". Use NestedMask.WithKeyFormatter for other encodings;
+//   - list indexes in square brackets, e.g. "gallery[1].path", selecting a single element of a repeated field. An
+//     indexed element is processed with the union of its own sub-mask and the sub-mask listed for all the elements;
+//   - the wildcard "*" matching all the map keys, e.g. "attributes.*.tags", or all the fields, e.g. "photo.*". A
+//     field wildcard with a sub-mask only matches the message fields the sub-mask applies to, so
+//     "*.dimensions.width" refers to the fields that have dimensions. Explicitly listed keys and fields take
+//     precedence over the wildcard;
+//   - proto2 extensions referred to by their full names in square brackets, e.g. "[testproto.auditor].email".
+//
+// The Overwrite functions also accept oneof names, e.g. "changed", selecting whichever member of the oneof is set in
+// src. The other functions don't: for Filter and Prune such a path matches no field, so Filter clears the set member
+// and Prune keeps it, and Validate rejects it.
+//
+// Paths nested under a google.protobuf.Any field refer to the fields of the packed message, whose type is resolved
+// via protoregistry.GlobalTypes: the Any is left as is if the type can't be resolved. Paths nested under
+// google.protobuf.Struct, Value and ListValue fields navigate the JSON-like values by their keys, e.g.
+// "payload.user.name", and apply to all the values of a ListValue. Other well-known types like
+// google.protobuf.Timestamp are regular messages, so paths may refer to their fields, e.g. "created_at.seconds".
+//
+// A mask is never applied deeper than the mask itself since there is no recursive wildcard, so self-referential
+// message types are processed in a bounded number of steps.
+package fmutils
@@ -0,0 +1,24 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// ToFieldMask returns a FieldMask with the sorted paths of all the mask leaves.
+//
+// The map keys, list indexes and extension names in the mask are kept as literal path segments, e.g.
+// "attributes.a1.tags" or "gallery[0].path", so converting the FieldMask back with NestedMaskFromFieldMask results in
+// the same mask. Such paths are an extension of this package: they are not valid according to the FieldMask spec
+// and must not be normalized by the standard FieldMask utilities, e.g. fieldmaskpb.FieldMask.Normalize, or checked
+// with fieldmaskpb.FieldMask.IsValid. The map keys containing dots can't be converted back since the dots split
+// the paths into segments.
+func (mask NestedMask) ToFieldMask() *fieldmaskpb.FieldMask {
+	return &fieldmaskpb.FieldMask{Paths: mask.leafPaths("")}
+}
+
+// NestedMaskFromFieldMask returns the NestedMask built from the paths of the fm.
+//
+// This is the reverse of NestedMask.ToFieldMask. A nil fm results in an empty mask.
+func NestedMaskFromFieldMask(fm *fieldmaskpb.FieldMask) NestedMask {
+	return NestedMaskFromPaths(fm.GetPaths())
+}
@@ -0,0 +1,64 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestNestedMask_ToFieldMask(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{
+			name:  "fields",
+			paths: []string{"user.name", "photo", "user.user_id"},
+			want:  []string{"photo", "user.name", "user.user_id"},
+		},
+		{
+			name:  "map keys",
+			paths: []string{"attributes.a1.tags.t1", "attributes.*.tags", "flags.true"},
+			want:  []string{"attributes.*.tags", "attributes.a1.tags.t1", "flags.true"},
+		},
+		{
+			name:  "list indexes and extensions",
+			paths: []string{"gallery[1].path", "[testproto.auditor].email"},
+			want:  []string{"[testproto.auditor].email", "gallery[1].path"},
+		},
+		{
+			name:  "empty mask",
+			paths: nil,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask := NestedMaskFromPaths(tt.paths)
+			fm := mask.ToFieldMask()
+			if !reflect.DeepEqual(fm.GetPaths(), tt.want) {
+				t.Errorf("ToFieldMask() paths = %v, want %v", fm.GetPaths(), tt.want)
+			}
+
+			// The mask survives a round trip through the wire format.
+			data, err := proto.Marshal(fm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := &fieldmaskpb.FieldMask{}
+			if err := proto.Unmarshal(data, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if got := NestedMaskFromFieldMask(decoded); !reflect.DeepEqual(got, mask) {
+				t.Errorf("NestedMaskFromFieldMask() = %v, want %v", got, mask)
+			}
+		})
+	}
+
+	if got := NestedMaskFromFieldMask(nil); len(got) != 0 {
+		t.Errorf("NestedMaskFromFieldMask(nil) = %v, want an empty mask", got)
+	}
+}
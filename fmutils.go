@@ -1,6 +1,9 @@
 package fmutils
 
 import (
+	"fmt"
+	"strconv"
+
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
@@ -13,6 +16,18 @@ func Filter(msg proto.Message, paths []string) {
 	NestedMaskFromPaths(paths).Filter(msg)
 }
 
+// FilterEach keeps the fields listed in the paths in each of the msgs and clears all the rest.
+//
+// The mask is built once and applied to every message, so this is cheaper than calling Filter in a loop.
+// To filter the elements of a repeated field of a parent message, e.g. "gallery", filter the parent message with
+// the paths prefixed with the field name instead, e.g. "gallery.path".
+func FilterEach(msgs []proto.Message, paths []string) {
+	mask := NestedMaskFromPaths(paths)
+	for _, msg := range msgs {
+		mask.Filter(msg)
+	}
+}
+
 // Prune clears all the fields listed in paths from the given msg.
 //
 // This is a handy wrapper for NestedMask.Prune method.
@@ -21,6 +36,28 @@ func Prune(msg proto.Message, paths []string) {
 	NestedMaskFromPaths(paths).Prune(msg)
 }
 
+// PruneExcept clears all the fields from the given msg except the ones listed in keepPaths.
+//
+// This is exactly the same operation as Filter, provided for callers that think in terms of pruning.
+func PruneExcept(msg proto.Message, keepPaths []string) {
+	Filter(msg, keepPaths)
+}
+
+// FilterKeeping keeps the msg fields that are listed in paths or in alwaysKeep and clears all the rest.
+//
+// The alwaysKeep paths are merged into the mask built from paths, so fields like ids are never dropped regardless
+// of the projection requested by a client. Like Filter, it keeps all the fields if paths result in an empty mask.
+func FilterKeeping(msg proto.Message, paths, alwaysKeep []string) {
+	mask := NestedMaskFromPaths(paths)
+	if len(mask) == 0 {
+		return
+	}
+	for name, m := range NestedMaskFromPaths(alwaysKeep) {
+		mask.merge(name, m)
+	}
+	mask.Filter(msg)
+}
+
 // Overwrite overwrites all the fields listed in paths in the dest msg using values from src msg.
 //
 // This is a handy wrapper for NestedMask.Overwrite method.
@@ -29,134 +66,847 @@ func Overwrite(src, dest proto.Message, paths []string) {
 	NestedMaskFromPaths(paths).Overwrite(src, dest)
 }
 
+// MergeFiltered merges the src fields listed in paths into dst using proto.Merge.
+//
+// This is the same as filtering src with the paths and merging the result into dst, except that src is cloned
+// first and is never modified. The proto.Merge semantics apply: populated scalars replace the dst values, messages
+// are merged recursively and repeated fields are appended. Use Overwrite to replace the dst fields instead.
+func MergeFiltered(dst, src proto.Message, paths []string) {
+	if isNil(dst) || isNil(src) {
+		return
+	}
+	filtered := proto.Clone(src)
+	Filter(filtered, paths)
+	proto.Merge(dst, filtered)
+}
+
+// OverwriteWithOptions overwrites all the fields listed in paths in the dest msg using values from src msg.
+//
+// This is a handy wrapper for NestedMask.OverwriteWithOptions method.
+func OverwriteWithOptions(src, dest proto.Message, paths []string, opts OverwriteOptions) {
+	NestedMaskFromPaths(paths).OverwriteWithOptions(src, dest, opts)
+}
+
+// OverwriteE works like OverwriteWithOptions and returns an error if src and dest are of different types or if the
+// opts.MaxNodes limit is exceeded.
+//
+// This is a handy wrapper for NestedMask.OverwriteE method.
+func OverwriteE(src, dest proto.Message, paths []string, opts OverwriteOptions) error {
+	return NestedMaskFromPaths(paths).OverwriteE(src, dest, opts)
+}
+
+// OverwriteFunc overwrites all the fields listed in paths in the dest msg using values from src msg and calls
+// onChange for every dest field it actually changes.
+//
+// This is a handy wrapper for NestedMask.OverwriteFunc method.
+func OverwriteFunc(src, dest proto.Message, paths []string, onChange func(path string, cleared bool)) {
+	NestedMaskFromPaths(paths).OverwriteFunc(src, dest, onChange)
+}
+
 // NestedMask represents a field mask as a recursive map.
+//
+// Applying a mask never modifies it, so the same NestedMask may be used to filter or prune different messages from
+// multiple goroutines concurrently as long as nobody modifies the mask itself.
 type NestedMask map[string]NestedMask
 
+// FilterWithOptions keeps the msg fields that are listed in the paths and clears all the rest.
+//
+// This is a handy wrapper for NestedMask.FilterWithOptions method.
+func FilterWithOptions(msg proto.Message, paths []string, opts FilterOptions) {
+	NestedMaskFromPaths(paths).FilterWithOptions(msg, opts)
+}
+
+// OverwriteSparse overwrites the fields listed in paths in the dest msg using values from src msg only if they
+// are set in src.
+//
+// This is a handy wrapper for NestedMask.OverwriteWithOptions method with OverwriteOptions.Sparse enabled: it
+// gives patch semantics where the fields src doesn't provide are left untouched in dest instead of being cleared.
+func OverwriteSparse(src, dest proto.Message, paths []string) {
+	NestedMaskFromPaths(paths).OverwriteWithOptions(src, dest, OverwriteOptions{Sparse: true})
+}
+
 // NestedMaskFromPaths creates an instance of NestedMask for the given paths.
+//
+// A path segment of a repeated field may be followed by an index in square brackets, e.g. "gallery[1].path".
+// The index is stored in the mask as a separate segment "[1]" nested under the repeated field.
+// If one path is an ancestor of another, e.g. "photo" and "photo.path", the ancestor wins regardless of the order
+// of the paths since it covers the other one. Use NestedMaskFromPathsStrict to reject such paths instead.
+// Empty paths and empty path segments are ignored, so paths holding only empty strings result in an empty mask
+// that keeps all the fields when filtering and doesn't touch any of them when pruning or overwriting.
 func NestedMaskFromPaths(paths []string) NestedMask {
+	mask, _ := nestedMaskFromPaths(paths, false)
+	return mask
+}
+
+// NestedMaskFromPathsStrict works like NestedMaskFromPaths but returns an error if one path is an ancestor of
+// another one, e.g. "photo" and "photo.path", since such a mask is ambiguous.
+func NestedMaskFromPathsStrict(paths []string) (NestedMask, error) {
+	return nestedMaskFromPaths(paths, true)
+}
+
+// NestedMaskFromPathsLimited works like NestedMaskFromPaths but returns an error without building the mask if there
+// are more than maxPaths paths or if the paths have more than maxSegments segments in total.
+//
+// This bounds the memory used by the masks built from untrusted input. A non-positive limit is not enforced.
+func NestedMaskFromPathsLimited(paths []string, maxPaths, maxSegments int) (NestedMask, error) {
+	if maxPaths > 0 && len(paths) > maxPaths {
+		return nil, fmt.Errorf("fmutils: too many paths: %d, the limit is %d", len(paths), maxPaths)
+	}
+	if maxSegments > 0 {
+		segments := 0
+		for _, path := range paths {
+			segments += countSegments(path)
+			if segments > maxSegments {
+				return nil, fmt.Errorf("fmutils: too many path segments: more than %d", maxSegments)
+			}
+		}
+	}
+	return NestedMaskFromPaths(paths), nil
+}
+
+// countSegments returns the number of segments splitPath would split the path into.
+func countSegments(path string) int {
+	n := 0
+	for segment, end := nextSegment(path, 0); segment != ""; segment, end = nextSegment(path, end) {
+		n++
+	}
+	return n
+}
+
+func nestedMaskFromPaths(paths []string, strict bool) (NestedMask, error) {
 	mask := make(NestedMask)
 	for _, path := range paths {
 		curr := mask
-		var letters []rune
-		for _, letter := range path {
-			if letter == '.' {
-				if len(letters) == 0 {
-					continue
+		key, end := nextSegment(path, 0)
+		for key != "" {
+			next, nextEnd := nextSegment(path, end)
+			c, ok := curr[key]
+			if next == "" {
+				if ok && len(c) != 0 && strict {
+					return nil, fmt.Errorf("fmutils: path %q is an ancestor of another path", path)
 				}
-
-				key := string(letters)
-				c, ok := curr[key]
-				if !ok {
-					c = make(NestedMask)
-					curr[key] = c
+				// A leaf covers all the paths nested under it.
+				curr[key] = make(NestedMask)
+				break
+			}
+			if ok && len(c) == 0 {
+				// Intermediate nodes always have children, so this is a leaf that covers the path.
+				if strict {
+					return nil, fmt.Errorf("fmutils: path %q is nested under another path", path)
 				}
-				curr = c
-				letters = nil
-				continue
+				break
 			}
-			letters = append(letters, letter)
-		}
-		if len(letters) != 0 {
-			key := string(letters)
-			if _, ok := curr[key]; !ok {
-				curr[key] = make(NestedMask)
+			if !ok {
+				c = make(NestedMask)
+				curr[key] = c
 			}
+			curr = c
+			key, end = next, nextEnd
 		}
 	}
 
-	return mask
+	return mask, nil
+}
+
+// Sub returns the sub-mask nested under the given field and whether the mask covers the field at all.
+//
+// The field may be a dotted path, e.g. "photo.dimensions". If the mask lists the field (or any of its ancestors)
+// as a leaf, the whole field is covered and an empty mask is returned, which keeps all the fields when used in
+// Filter, e.g. Sub("photo") of the "photo" mask is an empty mask. The returned sub-mask must not be modified since
+// it is shared with the mask.
+func (mask NestedMask) Sub(field string) (NestedMask, bool) {
+	curr := mask
+	for _, segment := range splitPath(field) {
+		if len(curr) == 0 {
+			break
+		}
+		m, ok := curr[segment]
+		if !ok {
+			return nil, false
+		}
+		curr = m
+	}
+	return curr, true
+}
+
+// Clone returns a deep copy of the mask.
+//
+// The copy shares nothing with the mask, so either of them may be modified without affecting the other one, e.g. a
+// mask shared by multiple goroutines may be cloned and then extended by one of them.
+func (mask NestedMask) Clone() NestedMask {
+	if mask == nil {
+		return nil
+	}
+	clone := make(NestedMask, len(mask))
+	for k, m := range mask {
+		if m == nil {
+			clone[k] = nil
+		} else {
+			clone[k] = m.Clone()
+		}
+	}
+	return clone
+}
+
+// Covers reports whether every path of the requested mask is permitted by the allowed mask.
+//
+// A leaf of the allowed mask covers all the paths nested under it, e.g. "photo" covers "photo.path", while a
+// requested leaf is only covered by the same or an ancestor allowed leaf. The "*" map key of the allowed mask covers
+// any requested key. An empty allowed mask covers nothing but an empty requested mask, which makes Covers suitable
+// for checking requested masks against per-role allow-lists.
+func (allowed NestedMask) Covers(requested NestedMask) bool {
+	if len(allowed) == 0 {
+		return len(requested) == 0
+	}
+	return allowed.covers(requested)
+}
+
+func (allowed NestedMask) covers(requested NestedMask) bool {
+	for key, r := range requested {
+		a, ok := allowed.mapKeyMask(key)
+		if !ok {
+			return false
+		}
+		if len(a) == 0 {
+			continue
+		}
+		if len(r) == 0 || !a.covers(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersect returns the mask of the paths covered by both the mask and the other mask.
+//
+// A leaf in one mask intersected with a sub-mask in the other one results in that sub-mask, e.g. "photo" and
+// "photo.path" intersect to "photo.path". The "*" key of one mask matches any key of the other one, e.g.
+// "attributes.*.tags" and "attributes.a1" intersect to "attributes.a1.tags". Like in Covers, an empty mask has no
+// paths, so the intersection with it is empty. Neither mask is modified and the result shares nothing with them.
+func (mask NestedMask) Intersect(other NestedMask) NestedMask {
+	result := make(NestedMask)
+	for key := range mask {
+		mask.intersectKey(other, key, result)
+	}
+	for key := range other {
+		if _, ok := mask[key]; !ok {
+			mask.intersectKey(other, key, result)
+		}
+	}
+	return result
+}
+
+// intersectKey stores the intersection of the sub-masks of both masks for the given key in the result.
+func (mask NestedMask) intersectKey(other NestedMask, key string, result NestedMask) {
+	m, ok := mask.mapKeyMask(key)
+	if !ok {
+		return
+	}
+	o, ok := other.mapKeyMask(key)
+	if !ok {
+		return
+	}
+	switch {
+	case len(m) == 0 && len(o) == 0:
+		result[key] = make(NestedMask)
+	case len(m) == 0:
+		result[key] = o.Clone()
+	case len(o) == 0:
+		result[key] = m.Clone()
+	default:
+		if sub := m.Intersect(o); len(sub) > 0 {
+			result[key] = sub
+		}
+	}
+}
+
+// splitPath splits the dotted path into segments skipping the empty ones.
+// A list index or an extension name in square brackets becomes a separate segment, dots inside of the brackets
+// don't split it.
+func splitPath(path string) []string {
+	var segments []string
+	for segment, end := nextSegment(path, 0); segment != ""; segment, end = nextSegment(path, end) {
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// nextSegment returns the first path segment that starts at or after the start offset and the offset of its end.
+//
+// Segments are separated by dots, and a "[" starts a new segment that lasts at least until the matching "]", so the
+// dots inside the brackets don't split it. An empty segment is returned if there are no segments left.
+// The segment is a substring of the path, so no memory is allocated.
+func nextSegment(path string, start int) (string, int) {
+	for start < len(path) && path[start] == '.' {
+		start++
+	}
+	end := start
+	inBrackets := false
+	for ; end < len(path); end++ {
+		letter := path[end]
+		if inBrackets {
+			inBrackets = letter != ']'
+			continue
+		}
+		if letter == '.' || letter == '[' && end != start {
+			break
+		}
+		inBrackets = letter == '['
+	}
+	return path[start:end], end
 }
 
 // Filter keeps the msg fields that are listed in the paths and clears all the rest.
 //
-// If the mask is empty then all the fields are kept.
+// If the mask is empty or msg is nil then all the fields are kept. Fields with explicit presence are kept if listed
+// even if they hold the default value. Fields are only cleared: Filter never creates messages, so the listed fields
+// that are not set stay unset, and it doesn't reorder the fields. A set oneof member is cleared unless it is listed.
+// A map entry holding a nil message value is kept as is if its key is listed. See the package documentation for the
+// path syntax.
 // Paths are assumed to be valid and normalized otherwise the function may panic.
 // See google.golang.org/protobuf/types/known/fieldmaskpb for details.
 func (mask NestedMask) Filter(msg proto.Message) {
+	if isNil(msg) {
+		return
+	}
+	mask.filterMessage(msg, nil, FilterOptions{})
+}
+
+// FilterRepeated keeps the mask fields in each message element of the list and clears all the rest.
+//
+// The mask is applied to the elements the same way NestedMask.Filter applies the sub-mask of a repeated message
+// field to its elements, e.g. the list of the "gallery" field is filtered by the mask built from "path" like the
+// parent message is filtered by "gallery.path". The list is left untouched if its elements are not messages.
+func (mask NestedMask) FilterRepeated(list protoreflect.List) {
+	for i := 0; i < list.Len(); i++ {
+		item, ok := list.Get(i).Interface().(protoreflect.Message)
+		if !ok {
+			return
+		}
+		mask.filter(item, "", nil, FilterOptions{})
+	}
+}
+
+// FilterFunc works like NestedMask.Filter and calls onClear for every field or map entry it clears.
+//
+// The path passed to onClear is the full dotted path of the cleared field starting from the msg root.
+// Map entries are reported with the map key as the last path segment and the descriptor of the map field.
+func (mask NestedMask) FilterFunc(msg proto.Message, onClear func(path string, fd protoreflect.FieldDescriptor)) {
+	if isNil(msg) {
+		return
+	}
+	mask.filterMessage(msg, onClear, FilterOptions{})
+}
+
+func (mask NestedMask) filter(rft protoreflect.Message, prefix string, onClear func(string, protoreflect.FieldDescriptor), opts FilterOptions) {
 	if len(mask) == 0 {
 		return
 	}
+	if f, ok := rft.Interface().(SelfFilterer); ok {
+		f.FilterFields(mask)
+		return
+	}
+	if rft.Descriptor().FullName() == anyFullName {
+		if inner, ok := unpackAny(rft); ok {
+			mask.filter(inner, prefix, onClear, opts)
+			repackAny(rft, inner)
+		}
+		return
+	}
+	if mask = mask.messageStructMask(rft); len(mask) == 0 {
+		return
+	}
 
-	rft := msg.ProtoReflect()
-	rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
-		m, ok := mask[string(fd.Name())]
-		if ok {
-			if len(m) == 0 {
-				return true
+	// Iterating over the descriptor fields rather than using rft.Range avoids allocating a closure for every message.
+	fields := rft.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); rft.Has(fd) {
+			mask.filterField(rft, fd, prefix, onClear, opts)
+		}
+	}
+	if rft.Descriptor().ExtensionRanges().Len() > 0 {
+		rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.IsExtension() {
+				mask.filterField(rft, fd, prefix, onClear, opts)
 			}
+			return true
+		})
+	}
+}
 
-			if fd.IsMap() {
-				xmap := rft.Get(fd).Map()
-				xmap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
-					if mi, ok := m[mk.String()]; ok {
-						if i, ok := mv.Interface().(protoreflect.Message); ok && len(mi) > 0 {
-							mi.Filter(i.Interface())
-						}
-					} else {
-						xmap.Clear(mk)
-					}
+func (mask NestedMask) filterField(rft protoreflect.Message, fd protoreflect.FieldDescriptor, prefix string, onClear func(string, protoreflect.FieldDescriptor), opts FilterOptions) {
+	m, ok := mask.fieldMask(fd)
+	if !ok {
+		rft.Clear(fd)
+		if onClear != nil {
+			onClear(childPath(prefix, fieldKey(fd), true), fd)
+		}
+		return
+	}
+	if len(m) == 0 {
+		return
+	}
 
-					return true
-				})
-			} else if fd.IsList() {
-				list := rft.Get(fd).List()
-				for i := 0; i < list.Len(); i++ {
-					m.Filter(list.Get(i).Message().Interface())
+	path := childPath(prefix, fieldKey(fd), onClear != nil)
+	if fd.IsMap() {
+		xmap := rft.Get(fd).Map()
+		xmap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+			key := formatMapKey(opts.KeyFormatter, mk)
+			if mi, ok := m.mapKeyMask(key); ok {
+				if i, ok := mv.Interface().(protoreflect.Message); ok && len(mi) > 0 {
+					mi.filter(i, childPath(path, key, onClear != nil), onClear, opts)
+				}
+			} else {
+				xmap.Clear(mk)
+				if onClear != nil {
+					onClear(childPath(path, key, true), fd)
 				}
-			} else if fd.Kind() == protoreflect.MessageKind {
-				m.Filter(rft.Get(fd).Message().Interface())
 			}
+
+			return true
+		})
+	} else if fd.IsList() {
+		if m.hasIndexes() {
+			m.filterListIndexes(rft, fd, path, onClear, opts)
+		} else if fd.Message() == nil {
+			// A sub-mask of a scalar list is invalid and is ignored, so the list is kept as a whole.
+			return
 		} else {
-			rft.Clear(fd)
+			list := rft.Get(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				m.filter(list.Get(i).Message(), path, onClear, opts)
+			}
 		}
-		return true
-	})
+		if opts.DropEmptyElements && fd.Message() != nil && rft.Has(fd) {
+			dropEmptyElements(rft, fd)
+		}
+	} else if fd.Kind() == protoreflect.MessageKind {
+		m.filter(rft.Get(fd).Message(), path, onClear, opts)
+	}
+}
+
+// FilterOptions configures how NestedMask.FilterWithOptions filters the msg.
+//
+// The zero value results in the same behavior as NestedMask.Filter.
+type FilterOptions struct {
+	// DropEmptyElements makes the elements of the repeated message fields that are left without populated fields
+	// after filtering removed from the list, e.g. filtering "gallery.dimensions" drops the photos without dimensions.
+	// A repeated field without elements left is cleared.
+	DropEmptyElements bool
+	// KeyFormatter converts the map keys to the strings matched against the map key path segments. By default the
+	// keys are formatted with protoreflect.MapKey.String.
+	KeyFormatter func(protoreflect.MapKey) string
+
+	// keepUnlistedElements makes the list elements that are not listed by their indexes kept in place instead of
+	// being removed, so that the indexes still refer to the same elements after filtering.
+	keepUnlistedElements bool
+}
+
+// FilterWithOptions works like NestedMask.Filter and allows tuning its behavior with the opts.
+func (mask NestedMask) FilterWithOptions(msg proto.Message, opts FilterOptions) {
+	if isNil(msg) {
+		return
+	}
+	mask.filterMessage(msg, nil, opts)
+}
+
+// filterListIndexes filters the elements of the repeated field fd using the mask that has sub-masks for specific
+// indexes.
+//
+// An element listed by its index is filtered with the union of its own sub-mask and the sub-mask applied to all the
+// elements, so "gallery.path" and "gallery[0].photo_id" keep both fields of the first element and only the path of
+// the others. An index listed without a sub-mask keeps the entire element. If the mask has no sub-mask applied to
+// all the elements then the elements that are not listed by their indexes are removed from the list.
+func (mask NestedMask) filterListIndexes(rft protoreflect.Message, fd protoreflect.FieldDescriptor, path string, onClear func(string, protoreflect.FieldDescriptor), opts FilterOptions) {
+	fieldsMask, indexes := mask.splitIndexes()
+	list := rft.Mutable(fd).List()
+	n := 0
+	for i := 0; i < list.Len(); i++ {
+		item := list.Get(i)
+		m, ok := indexes[i]
+		if !ok && len(fieldsMask) == 0 && !opts.keepUnlistedElements {
+			if onClear != nil {
+				onClear(path+"["+strconv.Itoa(i)+"]", fd)
+			}
+			continue
+		}
+		if fd.Message() != nil {
+			if !ok {
+				m = fieldsMask
+			} else if len(fieldsMask) > 0 {
+				m = unionMasks(fieldsMask, m)
+			}
+			m.filter(item.Message(), path, onClear, opts)
+		}
+		list.Set(n, item)
+		n++
+	}
+	if n == 0 {
+		rft.Clear(fd)
+	} else if n < list.Len() {
+		list.Truncate(n)
+	}
+}
+
+// hasIndexes reports whether the mask of a repeated field has sub-masks for specific indexes.
+func (mask NestedMask) hasIndexes() bool {
+	for k := range mask {
+		if _, ok := parseIndex(k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dropEmptyElements removes the elements without populated fields from the repeated message field fd.
+func dropEmptyElements(rft protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	list := rft.Mutable(fd).List()
+	n := 0
+	for i := 0; i < list.Len(); i++ {
+		item := list.Get(i)
+		if proto.Size(item.Message().Interface()) == 0 {
+			continue
+		}
+		list.Set(n, item)
+		n++
+	}
+	if n == 0 {
+		rft.Clear(fd)
+	} else if n < list.Len() {
+		list.Truncate(n)
+	}
 }
 
 // Prune clears all the fields listed in paths from the given msg.
 //
-// All other fields are kept untouched. If the mask is empty no fields are cleared.
+// All other fields are kept untouched. If the mask is empty or msg is nil no fields are cleared.
 // This operation is the opposite of NestedMask.Filter.
+// Clearing a field with explicit presence (e.g. a proto3 optional field) removes its presence even if it holds the
+// default value.
+// Listing a oneof field clears the oneof if that field is the one that is set. Listing a field nested inside of a
+// oneof message field keeps the oneof case intact.
+// See the package documentation for the path syntax: e.g. "gallery[0].path" clears the path of the first element
+// only and "gallery[0]" removes the first element from the list.
 // Paths are assumed to be valid and normalized otherwise the function may panic.
 // See google.golang.org/protobuf/types/known/fieldmaskpb for details.
 func (mask NestedMask) Prune(msg proto.Message) {
+	if isNil(msg) {
+		return
+	}
+	mask.pruneMessage(msg, nil, nil)
+}
+
+// PruneFunc works like NestedMask.Prune and calls onClear for every field or map entry it clears.
+//
+// The path passed to onClear is the full dotted path of the cleared field starting from the msg root.
+// Map entries are reported with the map key as the last path segment and the descriptor of the map field.
+func (mask NestedMask) PruneFunc(msg proto.Message, onClear func(path string, fd protoreflect.FieldDescriptor)) {
+	if isNil(msg) {
+		return
+	}
+	mask.pruneMessage(msg, onClear, nil)
+}
+
+func (mask NestedMask) prune(rft protoreflect.Message, prefix string, onClear func(string, protoreflect.FieldDescriptor), format func(protoreflect.MapKey) string) {
 	if len(mask) == 0 {
 		return
 	}
+	if r, ok := rft.Interface().(SelfRedactor); ok {
+		r.RedactFields(mask)
+		return
+	}
+	if rft.Descriptor().FullName() == anyFullName {
+		if inner, ok := unpackAny(rft); ok {
+			mask.prune(inner, prefix, onClear, format)
+			repackAny(rft, inner)
+		}
+		return
+	}
+	if mask = mask.messageStructMask(rft); len(mask) == 0 {
+		return
+	}
 
-	rft := msg.ProtoReflect()
-	rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
-		m, ok := mask[string(fd.Name())]
-		if ok {
-			if len(m) == 0 {
-				rft.Clear(fd)
-				return true
+	// Iterating over the descriptor fields rather than using rft.Range avoids allocating a closure for every message.
+	fields := rft.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); rft.Has(fd) {
+			mask.pruneField(rft, fd, prefix, onClear, format)
+		}
+	}
+	if rft.Descriptor().ExtensionRanges().Len() > 0 {
+		rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.IsExtension() {
+				mask.pruneField(rft, fd, prefix, onClear, format)
 			}
+			return true
+		})
+	}
+}
 
-			if fd.IsMap() {
-				xmap := rft.Get(fd).Map()
-				xmap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
-					if mi, ok := m[mk.String()]; ok {
-						if i, ok := mv.Interface().(protoreflect.Message); ok && len(mi) > 0 {
-							mi.Prune(i.Interface())
-						} else {
-							xmap.Clear(mk)
-						}
-					}
+func (mask NestedMask) pruneField(rft protoreflect.Message, fd protoreflect.FieldDescriptor, prefix string, onClear func(string, protoreflect.FieldDescriptor), format func(protoreflect.MapKey) string) {
+	m, ok := mask.fieldMask(fd)
+	if !ok {
+		return
+	}
 
-					return true
-				})
-			} else if fd.IsList() {
-				list := rft.Get(fd).List()
-				for i := 0; i < list.Len(); i++ {
-					m.Prune(list.Get(i).Message().Interface())
+	path := childPath(prefix, fieldKey(fd), onClear != nil)
+	if len(m) == 0 {
+		rft.Clear(fd)
+		if onClear != nil {
+			onClear(path, fd)
+		}
+		return
+	}
+
+	if fd.IsMap() {
+		xmap := rft.Get(fd).Map()
+		xmap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+			key := formatMapKey(format, mk)
+			if mi, ok := m.mapKeyMask(key); ok {
+				if i, ok := mv.Interface().(protoreflect.Message); ok && len(mi) > 0 {
+					mi.prune(i, childPath(path, key, onClear != nil), onClear, format)
+				} else {
+					xmap.Clear(mk)
+					if onClear != nil {
+						onClear(childPath(path, key, true), fd)
+					}
 				}
-			} else if fd.Kind() == protoreflect.MessageKind {
-				m.Prune(rft.Get(fd).Message().Interface())
 			}
+
+			return true
+		})
+	} else if fd.IsList() {
+		if m.hasIndexes() {
+			m.pruneListIndexes(rft, fd, path, onClear, format)
+			return
 		}
-		return true
-	})
+		if fd.Message() == nil {
+			// A sub-mask of a scalar list is invalid and is ignored, so the list is left untouched.
+			return
+		}
+		list := rft.Get(fd).List()
+		for i := 0; i < list.Len(); i++ {
+			m.prune(list.Get(i).Message(), path, onClear, format)
+		}
+	} else if fd.Kind() == protoreflect.MessageKind {
+		m.prune(rft.Get(fd).Message(), path, onClear, format)
+	}
+}
+
+// pruneListIndexes prunes the elements of the repeated field fd using the mask that has sub-masks for specific
+// indexes.
+//
+// An element listed by its index is pruned with the union of its own sub-mask and the sub-mask applied to all the
+// elements. An index listed without a sub-mask removes the entire element from the list. The repeated field is
+// cleared if no elements are left.
+func (mask NestedMask) pruneListIndexes(rft protoreflect.Message, fd protoreflect.FieldDescriptor, path string, onClear func(string, protoreflect.FieldDescriptor), format func(protoreflect.MapKey) string) {
+	fieldsMask, indexes := mask.splitIndexes()
+	list := rft.Mutable(fd).List()
+	n := 0
+	for i := 0; i < list.Len(); i++ {
+		item := list.Get(i)
+		m, ok := indexes[i]
+		if ok && len(m) == 0 {
+			if onClear != nil {
+				onClear(path+"["+strconv.Itoa(i)+"]", fd)
+			}
+			continue
+		}
+		if fd.Message() != nil {
+			if !ok {
+				m = fieldsMask
+			} else if len(fieldsMask) > 0 {
+				m = unionMasks(fieldsMask, m)
+			}
+			m.prune(item.Message(), path, onClear, format)
+		}
+		list.Set(n, item)
+		n++
+	}
+	if n == 0 {
+		rft.Clear(fd)
+	} else if n < list.Len() {
+		list.Truncate(n)
+	}
+}
+
+// rangeLeaves calls fn for every populated field of rft that is a leaf of the mask.
+//
+// The mask is followed the same way as in NestedMask.Prune: wildcards, extension keys, map keys formatted with the
+// format, list indexes and the messages packed into google.protobuf.Any and google.protobuf.Struct fields are
+// supported. Map entries and list elements listed without a sub-mask are not fields, so they are skipped.
+func (mask NestedMask) rangeLeaves(rft protoreflect.Message, format func(protoreflect.MapKey) string, fn func(rft protoreflect.Message, fd protoreflect.FieldDescriptor)) {
+	if len(mask) == 0 {
+		return
+	}
+	if rft.Descriptor().FullName() == anyFullName {
+		if inner, ok := unpackAny(rft); ok {
+			mask.rangeLeaves(inner, format, fn)
+			repackAny(rft, inner)
+		}
+		return
+	}
+	if mask = mask.messageStructMask(rft); len(mask) == 0 {
+		return
+	}
+
+	fields := rft.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); rft.Has(fd) {
+			mask.rangeFieldLeaves(rft, fd, format, fn)
+		}
+	}
+	if rft.Descriptor().ExtensionRanges().Len() > 0 {
+		rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.IsExtension() {
+				mask.rangeFieldLeaves(rft, fd, format, fn)
+			}
+			return true
+		})
+	}
+}
+
+// rangeFieldLeaves calls fn for the populated field fd of rft or for its nested fields that are the leaves of the
+// mask.
+func (mask NestedMask) rangeFieldLeaves(rft protoreflect.Message, fd protoreflect.FieldDescriptor, format func(protoreflect.MapKey) string, fn func(rft protoreflect.Message, fd protoreflect.FieldDescriptor)) {
+	m, ok := mask.fieldMask(fd)
+	if !ok {
+		return
+	}
+	if len(m) == 0 {
+		fn(rft, fd)
+		return
+	}
+
+	switch {
+	case fd.IsMap():
+		if fd.MapValue().Message() == nil {
+			return
+		}
+		rft.Get(fd).Map().Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+			if mi, ok := m.mapKeyMask(formatMapKey(format, mk)); ok && mv.Message().IsValid() {
+				mi.rangeLeaves(mv.Message(), format, fn)
+			}
+			return true
+		})
+	case fd.Message() == nil:
+		return
+	case fd.IsList():
+		list := rft.Get(fd).List()
+		if !m.hasIndexes() {
+			for i := 0; i < list.Len(); i++ {
+				m.rangeLeaves(list.Get(i).Message(), format, fn)
+			}
+			return
+		}
+		fieldsMask, indexes := m.splitIndexes()
+		for i := 0; i < list.Len(); i++ {
+			mi, ok := indexes[i]
+			if !ok {
+				mi = fieldsMask
+			} else if len(mi) > 0 && len(fieldsMask) > 0 {
+				mi = unionMasks(fieldsMask, mi)
+			}
+			mi.rangeLeaves(list.Get(i).Message(), format, fn)
+		}
+	default:
+		m.rangeLeaves(rft.Get(fd).Message(), format, fn)
+	}
+}
+
+// formatMapKey returns the string form of the map key mk produced by the format or by protoreflect.MapKey.String if
+// the format is nil.
+func formatMapKey(format func(protoreflect.MapKey) string, mk protoreflect.MapKey) string {
+	if format == nil {
+		return mk.String()
+	}
+	return format(mk)
+}
+
+// wildcardKey is a path segment that matches all the map keys or all the fields of a message.
+const wildcardKey = "*"
+
+// fieldKey returns the mask key of the field fd: the field name or the full name of an extension in square
+// brackets, e.g. "[testproto.auditor]".
+func fieldKey(fd protoreflect.FieldDescriptor) string {
+	if fd.IsExtension() {
+		return "[" + string(fd.FullName()) + "]"
+	}
+	return string(fd.Name())
+}
+
+// fieldMask returns the sub-mask for the field fd of the message the mask applies to.
+//
+// An explicitly listed field takes precedence over the wildcard "*". The wildcard without a sub-mask matches all
+// the fields. The wildcard with a sub-mask only matches the singular and repeated message fields whose message has
+// some of the fields listed in the sub-mask, so "*.dimensions.width" only refers to the fields that have dimensions.
+func (mask NestedMask) fieldMask(fd protoreflect.FieldDescriptor) (NestedMask, bool) {
+	if m, ok := mask[fieldKey(fd)]; ok {
+		return m, true
+	}
+	m, ok := mask[wildcardKey]
+	if !ok || len(m) == 0 {
+		return m, ok
+	}
+	if fd.IsMap() || fd.Message() == nil || !m.appliesTo(fd.Message()) {
+		return nil, false
+	}
+	return m, true
+}
+
+// appliesTo reports whether some of the mask fields are the fields of the md message.
+//
+// A nested wildcard applies if it matches some field of md.
+func (mask NestedMask) appliesTo(md protoreflect.MessageDescriptor) bool {
+	for name, m := range mask {
+		if name != wildcardKey {
+			if md.Fields().ByName(protoreflect.Name(name)) != nil {
+				return true
+			}
+			continue
+		}
+		if len(m) == 0 {
+			return true
+		}
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if fd := fields.Get(i); !fd.IsMap() && fd.Message() != nil && m.appliesTo(fd.Message()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapKeyMask returns the sub-mask for the given map key.
+//
+// An explicitly listed key takes precedence over the wildcard key "*", which matches any key.
+func (mask NestedMask) mapKeyMask(key string) (NestedMask, bool) {
+	if m, ok := mask[key]; ok {
+		return m, true
+	}
+	m, ok := mask[wildcardKey]
+	return m, ok
+}
+
+// isNil reports whether msg is nil or a typed nil pointer to a message.
+func isNil(msg proto.Message) bool {
+	return msg == nil || !msg.ProtoReflect().IsValid()
+}
+
+// childPath returns the dotted path of the name nested under the prefix.
+// The path is only built if needed to avoid allocations when nobody is interested in it.
+func childPath(prefix, name string, needed bool) string {
+	if !needed {
+		return ""
+	}
+	if prefix == "" {
+		return name
+	}
+	if _, ok := parseIndex(name); ok {
+		return prefix + name
+	}
+	return prefix + "." + name
 }
 
 // Overwrite overwrites all the fields listed in paths in the dest msg using values from src msg.
@@ -165,51 +915,269 @@ func (mask NestedMask) Prune(msg proto.Message) {
 // Supports scalars, messages, repeated fields, and maps.
 // If the parent of the field is nil message, the parent is initiated before overwriting the field
 // If the field in src is empty value, the field in dest is cleared.
+// Maps and repeated fields have no presence, so a nil and an empty src map or list are the same: both clear the dest
+// field. Message fields do have presence: an unset src message clears the dest field, while a src message set to an
+// empty message sets the dest field to an empty message.
+// A map entry may be listed by its key, e.g. "attributes.a1" or "attributes.a1.tags.t1": only that entry is
+// overwritten and the other dest entries are left untouched. A listed key that is missing in src or holds an empty
+// message is deleted from the dest map.
+// The wildcard key "*", e.g. "attributes.*.tags", matches all the src entries that are not listed explicitly: the
+// dest entries missing in src are left untouched.
+// Keys of the maps with integer keys are written in the decimal form, e.g. "attributes.-3.tags" for a
+// map<int64, Attribute>, and bool keys are written as "true" and "false". Keys that can't be parsed as the map key
+// type are ignored.
+// Scalar fields with explicit presence (e.g. proto2 fields or proto3 optional fields) are cleared in dest if they
+// are not set in src and are copied as is otherwise, even if they hold the default value. Since presence is tracked
+// explicitly, a proto2 field set to its custom default value in src is copied rather than cleared in dest.
+// If either src or dest is nil, no fields are overwritten.
+// Messages are processed using reflection only, so dynamicpb messages are supported as well, but src and dest must
+// use the same implementation: e.g. both generated or both dynamicpb messages.
+// An element of a repeated field may be listed by its index, e.g. "login_timestamps[2]" or "gallery[0].path":
+// only that element is overwritten. If the dest list is too short it is grown with zero values up to the index.
+// If the src list is too short the index is ignored and the dest list is left untouched.
+// A oneof may be listed by its name: the field set in src is copied to dest, or the oneof in dest is cleared if
+// no field is set in src. A oneof field with a sub-mask that is set in neither src nor dest is skipped, so that
+// the oneof case set in dest is not switched. Unlike the field paths, oneof names are not accepted by the other
+// functions of the package, e.g. NestedMask.Filter and NestedMask.Validate.
+// The wildcard "*" matches the fields the same way as in NestedMask.Filter, e.g. "*.path" overwrites the path of
+// every message field that has one. Extensions are listed by their full names in square brackets, e.g.
+// "[testproto.note]", and are matched by the wildcard too.
+// The values copied from src are deep copies, so modifying src afterwards doesn't affect dest and vice versa.
 // Paths are assumed to be valid and normalized otherwise the function may panic.
 func (mask NestedMask) Overwrite(src, dest proto.Message) {
-	mask.overwrite(src.ProtoReflect(), dest.ProtoReflect())
+	mask.OverwriteWithOptions(src, dest, OverwriteOptions{})
+}
+
+// OverwriteOptions configures how NestedMask.OverwriteWithOptions overwrites the dest fields.
+//
+// The zero value results in the same behavior as NestedMask.Overwrite.
+type OverwriteOptions struct {
+	// MergeMessages makes the message fields listed without a sub-mask merged into dest using proto.Merge instead of
+	// being replaced: dest sub-fields that are not set in src are preserved. If such a field is not set in src then
+	// the dest field is left untouched.
+	MergeMessages bool
+	// OnlyIfUnset makes the fields listed without a sub-mask copied from src only if they are not set in dest, so
+	// that the values already set in dest are preserved. Scalars holding the default value (unless they have explicit
+	// presence), empty repeated fields and empty maps are considered unset.
+	OnlyIfUnset bool
+	// Sparse makes only the fields that are set in src overwritten, so that the dest fields are never cleared
+	// because src simply doesn't provide them. A field is set if it has explicit presence (e.g. a proto3 optional
+	// field) and is set even to the default value, if it is a scalar without presence holding a non-default value,
+	// if it is a non-empty repeated field or map or if it is a set message field. Sparse also applies to the
+	// parents of the nested fields and to the oneofs listed by name.
+	Sparse bool
+	// PreserveUnknown makes the unknown fields of the src messages that are overwritten using a sub-mask appended to
+	// the unknown fields of the corresponding dest messages, the same way proto.Merge does. This keeps the fields
+	// unknown to this schema version when proxying messages between schema versions. Message fields listed without a
+	// sub-mask are copied along with their unknown fields regardless of this option.
+	PreserveUnknown bool
+	// ReplaceWhole makes all the dest fields that are not listed in the mask cleared the same way NestedMask.Filter
+	// clears them, so that dest holds nothing but the listed fields overwritten from src. By default the fields
+	// that are not listed are left untouched, which gives patch semantics. The dest list elements that are not listed
+	// by their indexes are kept in place rather than removed, so that the listed indexes still refer to the same
+	// elements, e.g. "gallery[1]" only replaces the second element.
+	ReplaceWhole bool
+	// IsEmpty overrides the test deciding whether the src value of a field listed without a sub-mask, or of a listed
+	// map entry, is empty: an empty value clears the dest field or entry instead of being copied. The map entries
+	// are tested with the descriptor of the map value. If IsEmpty reports false then the value is copied as usual,
+	// so unset src fields still clear the dest ones. IsEmpty is not called for the fields merged with MergeMessages.
+	IsEmpty func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool
+	// NoTruncateLists makes the elements of the repeated message fields listed with a sub-mask merged into dest by
+	// index without truncating the dest list to the src length, so the trailing dest elements beyond the src list are
+	// preserved. This allows patches that only touch the first few elements. Repeated fields listed without a
+	// sub-mask are still replaced as a whole.
+	NoTruncateLists bool
+	// MaxNodes limits the number of messages visited following the mask, e.g. the src root, the nested messages and
+	// the elements of the repeated message fields listed with a sub-mask, to bound the cost of overwriting huge
+	// messages supplied by clients. The overwrite stops once the limit is reached, leaving dest partially overwritten:
+	// use NestedMask.OverwriteE to find out about it. The fields listed without a sub-mask are copied as a whole and
+	// count as a single visit. A non-positive limit is not enforced.
+	MaxNodes int
+
+	// nodes is the number of messages visited so far.
+	nodes int
+	// exceeded is set once the MaxNodes limit is reached.
+	exceeded bool
 }
 
-func (mask NestedMask) overwrite(srcRft, destRft protoreflect.Message) {
+// OverwriteWithOptions works like NestedMask.Overwrite and allows tuning its behavior with the opts.
+//
+// It panics if src and dest are of different types: use NestedMask.OverwriteE to get an error instead or
+// NestedMask.OverwriteCompatible to overwrite messages of compatible types.
+func (mask NestedMask) OverwriteWithOptions(src, dest proto.Message, opts OverwriteOptions) {
+	if err := checkSameType(src, dest); err != nil {
+		panic(err)
+	}
+	_ = mask.OverwriteE(src, dest, opts)
+}
+
+// OverwriteE works like NestedMask.OverwriteWithOptions and returns an error if src and dest are of different types
+// or if the opts.MaxNodes limit is exceeded.
+//
+// The type mismatch is reported up front with dest left untouched. The dest is partially overwritten when the
+// MaxNodes error is returned.
+func (mask NestedMask) OverwriteE(src, dest proto.Message, opts OverwriteOptions) error {
+	if isNil(src) || isNil(dest) {
+		return nil
+	}
+	if err := checkSameType(src, dest); err != nil {
+		return err
+	}
+	if opts.ReplaceWhole {
+		mask.filterMessage(dest, nil, FilterOptions{keepUnlistedElements: true})
+	}
+	mask.overwrite(src.ProtoReflect(), dest.ProtoReflect(), &opts, "", nil)
+	if opts.exceeded {
+		return fmt.Errorf("fmutils: overwrite visited more than %d messages", opts.MaxNodes)
+	}
+	return nil
+}
+
+// checkSameType returns an error if the src and dest messages are not nil and are of different types.
+func checkSameType(src, dest proto.Message) error {
+	if isNil(src) || isNil(dest) {
+		return nil
+	}
+	srcMD, destMD := src.ProtoReflect().Descriptor(), dest.ProtoReflect().Descriptor()
+	if srcMD != destMD {
+		return fmt.Errorf("fmutils: cannot overwrite %s with %s: message types differ", destMD.FullName(), srcMD.FullName())
+	}
+	return nil
+}
+
+// OverwriteFunc works like NestedMask.Overwrite and calls onChange for every dest field, map entry or list element
+// whose value it actually changes.
+//
+// The path passed to onChange is the full dotted path of the changed field starting from the dest root, map entries
+// are reported with the map key as the last path segment and list elements with their index, e.g.
+// "gallery[1].path". The cleared argument is true if the field, entry or element was cleared or removed and false
+// if it was set to a new value. Fields that already hold the src value are not reported.
+// It panics if src and dest are of different types, the same way NestedMask.OverwriteWithOptions does.
+func (mask NestedMask) OverwriteFunc(src, dest proto.Message, onChange func(path string, cleared bool)) {
+	if isNil(src) || isNil(dest) {
+		return
+	}
+	if err := checkSameType(src, dest); err != nil {
+		panic(err)
+	}
+	mask.overwrite(src.ProtoReflect(), dest.ProtoReflect(), &OverwriteOptions{}, "", onChange)
+}
+
+func (mask NestedMask) overwrite(srcRft, destRft protoreflect.Message, opts *OverwriteOptions, prefix string, onChange func(string, bool)) {
+	if opts.MaxNodes > 0 {
+		if opts.nodes >= opts.MaxNodes {
+			opts.exceeded = true
+		}
+		opts.nodes++
+	}
 	for srcFDName, submask := range mask {
+		if opts.exceeded {
+			return
+		}
+		if srcFDName == wildcardKey {
+			mask.overwriteWildcard(srcRft, destRft, opts, prefix, onChange)
+			continue
+		}
 		srcFD := srcRft.Descriptor().Fields().ByName(protoreflect.Name(srcFDName))
-		srcVal := srcRft.Get(srcFD)
-		if len(submask) == 0 {
-			if isValid(srcFD, srcVal) {
-				destRft.Set(srcFD, srcVal)
-			} else {
-				destRft.Clear(srcFD)
-			}
-		} else if srcFD.IsMap() && srcFD.Kind() == protoreflect.MessageKind {
-			srcMap := srcRft.Get(srcFD).Map()
-			destMap := destRft.Get(srcFD).Map()
-			if !destMap.IsValid() {
-				destRft.Set(srcFD, protoreflect.ValueOf(srcMap))
-				destMap = destRft.Get(srcFD).Map()
-			}
-			srcMap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
-				if mi, ok := submask[mk.String()]; ok {
-					if i, ok := mv.Interface().(protoreflect.Message); ok && len(mi) > 0 {
-						newVal := protoreflect.ValueOf(i.New())
-						destMap.Set(mk, newVal)
-						mi.overwrite(mv.Message(), newVal.Message())
-					} else {
-
-						destMap.Set(mk, mv)
-					}
-				} else {
-					destMap.Clear(mk)
+		if srcFD == nil {
+			srcFD = extensionField(srcRft.Descriptor(), srcFDName)
+		}
+		if srcFD == nil {
+			if od := srcRft.Descriptor().Oneofs().ByName(protoreflect.Name(srcFDName)); od != nil {
+				if !opts.Sparse || srcRft.WhichOneof(od) != nil {
+					overwriteOneof(od, srcRft, destRft, prefix, onChange)
 				}
-				return true
-			})
-		} else if srcFD.IsList() && srcFD.Kind() == protoreflect.MessageKind {
+			}
+			continue
+		}
+		submask.overwriteField(srcFD, srcRft, destRft, opts, prefix, onChange)
+	}
+}
+
+// overwriteWildcard overwrites the dest fields matched by the wildcard "*" of the mask that are not listed in the
+// mask explicitly.
+//
+// The fields are matched the same way NestedMask.Filter matches them: the wildcard without a sub-mask matches all
+// the fields and the wildcard with a sub-mask only matches the message fields the sub-mask applies to.
+func (mask NestedMask) overwriteWildcard(srcRft, destRft protoreflect.Message, opts *OverwriteOptions, prefix string, onChange func(string, bool)) {
+	var extensions []protoreflect.FieldDescriptor
+	if srcRft.Descriptor().ExtensionRanges().Len() > 0 {
+		// The extensions set in either message are collected first, so that dest is not modified while ranging.
+		seen := make(map[protoreflect.FullName]bool)
+		collect := func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.IsExtension() && !seen[fd.FullName()] {
+				seen[fd.FullName()] = true
+				extensions = append(extensions, fd)
+			}
+			return true
+		}
+		srcRft.Range(collect)
+		destRft.Range(collect)
+	}
+	overwrite := func(fd protoreflect.FieldDescriptor) {
+		if _, ok := mask[fieldKey(fd)]; ok {
+			return
+		}
+		if m, ok := mask.fieldMask(fd); ok {
+			m.overwriteField(fd, srcRft, destRft, opts, prefix, onChange)
+		}
+	}
+	fields := srcRft.Descriptor().Fields()
+	for i := 0; i < fields.Len() && !opts.exceeded; i++ {
+		overwrite(fields.Get(i))
+	}
+	for i := 0; i < len(extensions) && !opts.exceeded; i++ {
+		overwrite(extensions[i])
+	}
+}
+
+// overwriteField overwrites the srcFD field of the dest message using the src message value. The mask is the
+// sub-mask of the field.
+func (mask NestedMask) overwriteField(srcFD protoreflect.FieldDescriptor, srcRft, destRft protoreflect.Message, opts *OverwriteOptions, prefix string, onChange func(string, bool)) {
+	if opts.Sparse && !srcRft.Has(srcFD) {
+		return
+	}
+	path := childPath(prefix, fieldKey(srcFD), onChange != nil)
+	srcVal := srcRft.Get(srcFD)
+	if len(mask) == 0 {
+		if opts.OnlyIfUnset && destRft.Has(srcFD) {
+			return
+		}
+		if opts.MergeMessages && srcFD.Message() != nil && !srcFD.IsList() && !srcFD.IsMap() {
+			if srcVal.Message().IsValid() {
+				proto.Merge(destRft.Mutable(srcFD).Message().Interface(), srcVal.Message().Interface())
+			}
+		} else if (opts.IsEmpty == nil || !opts.IsEmpty(srcFD, srcVal)) &&
+			isValid(srcFD, srcVal) && (srcFD.Message() != nil || !srcFD.HasPresence() || srcRft.Has(srcFD)) {
+			changed := onChange != nil && !fieldsEqual(srcFD, srcRft, destRft)
+			destRft.Set(srcFD, cloneValue(destRft, srcFD, srcVal))
+			if changed {
+				onChange(path, !destRft.Has(srcFD))
+			}
+		} else {
+			changed := onChange != nil && destRft.Has(srcFD)
+			destRft.Clear(srcFD)
+			if changed {
+				onChange(path, true)
+			}
+		}
+	} else if srcFD.IsMap() {
+		overwriteMapKeys(mask, srcFD, srcRft, destRft, opts, path, onChange)
+	} else if srcFD.IsList() {
+		fieldsMask, indexes := mask.splitIndexes()
+		if len(fieldsMask) > 0 && srcFD.Kind() == protoreflect.MessageKind {
 			srcList := srcRft.Get(srcFD).List()
 			destList := destRft.Mutable(srcFD).List()
 			// Truncate anything in dest that exceeds the length of src
-			if srcList.Len() < destList.Len() {
+			if !opts.NoTruncateLists && srcList.Len() < destList.Len() {
+				if onChange != nil {
+					for i := srcList.Len(); i < destList.Len(); i++ {
+						onChange(path+"["+strconv.Itoa(i)+"]", true)
+					}
+				}
 				destList.Truncate(srcList.Len())
 			}
-			for i := 0; i < srcList.Len(); i++ {
+			for i := 0; i < srcList.Len() && !opts.exceeded; i++ {
 				srcListItem := srcList.Get(i)
 				var destListItem protoreflect.Message
 				if destList.Len() > i {
@@ -219,17 +1187,271 @@ func (mask NestedMask) overwrite(srcRft, destRft protoreflect.Message) {
 					// Append new items to overwrite.
 					destListItem = destList.AppendMutable().Message()
 				}
-				submask.overwrite(srcListItem.Message(), destListItem)
+				itemPath := ""
+				if onChange != nil {
+					itemPath = path + "[" + strconv.Itoa(i) + "]"
+				}
+				fieldsMask.overwriteNested(srcListItem.Message(), destListItem, opts, itemPath, onChange)
 			}
+		}
+		if len(indexes) > 0 {
+			overwriteListIndexes(indexes, srcFD, srcRft, destRft, opts, path, onChange)
+		}
+	} else if srcFD.Kind() == protoreflect.MessageKind {
+		if srcFD.ContainingOneof() != nil && !srcRft.Has(srcFD) && !destRft.Has(srcFD) {
+			// Initiating the dest field would switch the dest oneof case to this field.
+			return
+		}
+		// If the dest field is nil
+		if !destRft.Get(srcFD).Message().IsValid() {
+			destRft.Set(srcFD, protoreflect.ValueOf(destRft.Get(srcFD).Message().New()))
+		}
+		mask.overwriteNested(srcRft.Get(srcFD).Message(), destRft.Get(srcFD).Message(), opts, path, onChange)
+	}
+}
+
+// overwriteNested overwrites the dest message nested in a masked field using the src message and copies the src
+// unknown fields if requested in the opts.
+func (mask NestedMask) overwriteNested(srcRft, destRft protoreflect.Message, opts *OverwriteOptions, prefix string, onChange func(string, bool)) {
+	if opts.PreserveUnknown && len(srcRft.GetUnknown()) > 0 {
+		destRft.SetUnknown(append(destRft.GetUnknown(), srcRft.GetUnknown()...))
+	}
+	mask.overwrite(srcRft, destRft, opts, prefix, onChange)
+}
+
+// overwriteMapKeys overwrites the dest map entries listed in the mask using the src map entries.
+//
+// Entries that are listed but missing in src are deleted from dest. Entries that are not listed are left untouched.
+// The wildcard key "*" matches all the src entries that are not listed explicitly.
+func overwriteMapKeys(mask NestedMask, fd protoreflect.FieldDescriptor, srcRft, destRft protoreflect.Message, opts *OverwriteOptions, path string, onChange func(string, bool)) {
+	srcMap := srcRft.Get(fd).Map()
+	for key, mi := range mask {
+		if key == wildcardKey {
+			srcMap.Range(func(mk protoreflect.MapKey, _ protoreflect.Value) bool {
+				if _, ok := mask[mk.String()]; !ok {
+					overwriteMapEntry(mi, fd, mk, mk.String(), srcMap, destRft, opts, path, onChange)
+				}
+				return !opts.exceeded
+			})
+			continue
+		}
+		mk, err := parseMapKey(fd.MapKey(), key)
+		if err != nil {
+			continue
+		}
+		overwriteMapEntry(mi, fd, mk, key, srcMap, destRft, opts, path, onChange)
+	}
+}
+
+// overwriteMapEntry overwrites the dest map entry with the mk key using the srcMap entry. The mask is the sub-mask
+// of the entry listed under the key.
+func overwriteMapEntry(mask NestedMask, fd protoreflect.FieldDescriptor, mk protoreflect.MapKey, key string, srcMap protoreflect.Map, destRft protoreflect.Message, opts *OverwriteOptions, path string, onChange func(string, bool)) {
+	keyPath := childPath(path, key, onChange != nil)
+	if !srcMap.Has(mk) {
+		if !opts.Sparse && destRft.Has(fd) && destRft.Get(fd).Map().Has(mk) {
+			destRft.Mutable(fd).Map().Clear(mk)
+			if onChange != nil {
+				onChange(keyPath, true)
+			}
+		}
+		return
+	}
+	mv := srcMap.Get(mk)
+	destMap := destRft.Mutable(fd).Map()
+	valueMD := fd.MapValue().Message()
+	if valueMD != nil && len(mask) > 0 {
+		mask.overwriteNested(mv.Message(), destMap.Mutable(mk).Message(), opts, keyPath, onChange)
+		return
+	}
+	had := destMap.Has(mk)
+	changed := onChange != nil && (!had || !valuesEqual(fd.MapValue(), destMap.Get(mk), mv))
+	empty := valueMD != nil && proto.Size(mv.Message().Interface()) == 0
+	if opts.IsEmpty != nil {
+		empty = opts.IsEmpty(fd.MapValue(), mv)
+	}
+	if empty {
+		// An empty src message clears the dest entry the same way an empty scalar clears the field.
+		destMap.Clear(mk)
+		changed = onChange != nil && had
+	} else {
+		destMap.Set(mk, cloneSingular(fd.MapValue(), mv))
+	}
+	if changed {
+		onChange(keyPath, !destMap.Has(mk))
+	}
+}
+
+// overwriteListIndexes overwrites the dest list elements at the given indexes using the src list elements.
+//
+// Indexes that are out of the src list bounds are ignored. The dest list is grown with zero values if it is too
+// short to hold an index.
+func overwriteListIndexes(indexes map[int]NestedMask, fd protoreflect.FieldDescriptor, srcRft, destRft protoreflect.Message, opts *OverwriteOptions, path string, onChange func(string, bool)) {
+	srcList := srcRft.Get(fd).List()
+	var destList protoreflect.List
+	for i, m := range indexes {
+		if i >= srcList.Len() {
+			continue
+		}
+		if destList == nil {
+			destList = destRft.Mutable(fd).List()
+		}
+		grown := destList.Len() <= i
+		for destList.Len() <= i {
+			destList.Append(destList.NewElement())
+		}
+		itemPath := ""
+		if onChange != nil {
+			itemPath = path + "[" + strconv.Itoa(i) + "]"
+		}
+		srcItem := srcList.Get(i)
+		if fd.Message() != nil && len(m) > 0 {
+			m.overwriteNested(srcItem.Message(), destList.Get(i).Message(), opts, itemPath, onChange)
+			continue
+		}
+		changed := onChange != nil && (grown || !valuesEqual(fd, destList.Get(i), srcItem))
+		destList.Set(i, cloneSingular(fd, srcItem))
+		if changed {
+			onChange(itemPath, false)
+		}
+	}
+}
 
-		} else if srcFD.Kind() == protoreflect.MessageKind {
-			// If the dest field is nil
-			if !destRft.Get(srcFD).Message().IsValid() {
-				destRft.Set(srcFD, protoreflect.ValueOf(destRft.Get(srcFD).Message().New()))
+// cloneValue returns a deep copy of the value v of the field fd created for the rft message, so that the src
+// lists, maps, messages and bytes copied to dest are not shared between the messages.
+func cloneValue(rft protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value {
+	switch {
+	case fd.IsList():
+		list := rft.NewField(fd).List()
+		src := v.List()
+		for i := 0; i < src.Len(); i++ {
+			list.Append(cloneSingular(fd, src.Get(i)))
+		}
+		return protoreflect.ValueOfList(list)
+	case fd.IsMap():
+		xmap := rft.NewField(fd).Map()
+		v.Map().Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+			xmap.Set(mk, cloneSingular(fd.MapValue(), mv))
+			return true
+		})
+		return protoreflect.ValueOfMap(xmap)
+	}
+	return cloneSingular(fd, v)
+}
+
+// cloneSingular returns a deep copy of the singular value v of the field fd or of an element of the repeated field
+// fd. Scalars other than bytes are immutable, so they are returned as is.
+func cloneSingular(fd protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value {
+	switch {
+	case fd.Message() != nil:
+		return protoreflect.ValueOfMessage(proto.Clone(v.Message().Interface()).ProtoReflect())
+	case fd.Kind() == protoreflect.BytesKind:
+		// A nil slice would make an empty proto2 bytes value unset, so the copy is never nil.
+		return protoreflect.ValueOfBytes(append(make([]byte, 0, len(v.Bytes())), v.Bytes()...))
+	}
+	return v
+}
+
+// splitIndexes splits the mask of a repeated field into the mask applied to all the elements and the masks
+// applied to the elements at specific indexes.
+func (mask NestedMask) splitIndexes() (NestedMask, map[int]NestedMask) {
+	var fields NestedMask
+	var indexes map[int]NestedMask
+	for k, m := range mask {
+		if i, ok := parseIndex(k); ok {
+			if indexes == nil {
+				indexes = make(map[int]NestedMask)
 			}
-			submask.overwrite(srcRft.Get(srcFD).Message(), destRft.Get(srcFD).Message())
+			indexes[i] = m
+			continue
+		}
+		if fields == nil {
+			fields = make(NestedMask, len(mask))
 		}
+		fields[k] = m
 	}
+	return fields, indexes
+}
+
+// unionMasks returns the mask covering the paths of both a and b submasks without modifying them.
+// An empty submask is a leaf and covers all the paths nested under it.
+func unionMasks(a, b NestedMask) NestedMask {
+	if len(a) == 0 || len(b) == 0 {
+		return NestedMask{}
+	}
+	union := make(NestedMask, len(a)+len(b))
+	for key, m := range a {
+		union[key] = m
+	}
+	for key, m := range b {
+		if existing, ok := union[key]; ok {
+			union[key] = unionMasks(existing, m)
+		} else {
+			union[key] = m
+		}
+	}
+	return union
+}
+
+// merge adds the submask under the given name or unites it with the submask already listed under the name.
+func (mask NestedMask) merge(name string, submask NestedMask) {
+	if existing, ok := mask[name]; ok {
+		submask = unionMasks(existing, submask)
+	}
+	mask[name] = submask
+}
+
+// parseIndex parses a list index path segment like "[2]".
+func parseIndex(segment string) (int, bool) {
+	if len(segment) < 3 || segment[0] != '[' || segment[len(segment)-1] != ']' {
+		return 0, false
+	}
+	i, err := strconv.Atoi(segment[1 : len(segment)-1])
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
+
+func overwriteOneof(od protoreflect.OneofDescriptor, srcRft, destRft protoreflect.Message, prefix string, onChange func(string, bool)) {
+	if fd := srcRft.WhichOneof(od); fd != nil {
+		changed := onChange != nil && !fieldsEqual(fd, srcRft, destRft)
+		destRft.Set(fd, cloneValue(destRft, fd, srcRft.Get(fd)))
+		if changed {
+			onChange(childPath(prefix, string(fd.Name()), true), false)
+		}
+	} else if fd := destRft.WhichOneof(od); fd != nil {
+		destRft.Clear(fd)
+		if onChange != nil {
+			onChange(childPath(prefix, string(fd.Name()), true), true)
+		}
+	}
+}
+
+// fieldsEqual reports whether the field fd is set in both a and b messages to equal values or is set in neither.
+func fieldsEqual(fd protoreflect.FieldDescriptor, a, b protoreflect.Message) bool {
+	if a.Has(fd) != b.Has(fd) {
+		return false
+	}
+	if !a.Has(fd) {
+		return true
+	}
+	va, vb := a.Get(fd), b.Get(fd)
+	switch {
+	case fd.IsMap():
+		ma, mb := va.Map(), vb.Map()
+		if ma.Len() != mb.Len() {
+			return false
+		}
+		equal := true
+		ma.Range(func(mk protoreflect.MapKey, v protoreflect.Value) bool {
+			equal = mb.Has(mk) && valuesEqual(fd.MapValue(), v, mb.Get(mk))
+			return equal
+		})
+		return equal
+	case fd.IsList():
+		return listsEqual(fd, va.List(), vb.List())
+	}
+	return valuesEqual(fd, va, vb)
 }
 
 func isValid(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
@@ -242,3 +1464,108 @@ func isValid(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
 	}
 	return true
 }
+
+// FilterToSchema keeps the msg fields that are also defined in the schema message and clears all the rest.
+//
+// Fields are matched by their numbers. A field is also cleared if its kind or cardinality differs from the schema.
+// Nested messages (including oneofs, repeated fields and map values) are processed recursively using the
+// corresponding message types from the schema.
+// This is useful when forwarding messages to a service that uses an older version of the schema.
+func FilterToSchema(msg, schema proto.Message) {
+	if isNil(msg) || schema == nil {
+		return
+	}
+	filterToSchema(msg.ProtoReflect(), schema.ProtoReflect().Descriptor())
+}
+
+func filterToSchema(rft protoreflect.Message, schema protoreflect.MessageDescriptor) {
+	rft.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		sfd := schema.Fields().ByNumber(fd.Number())
+		if sfd == nil || sfd.Kind() != fd.Kind() || sfd.Cardinality() != fd.Cardinality() || sfd.IsMap() != fd.IsMap() {
+			rft.Clear(fd)
+			return true
+		}
+
+		if fd.IsMap() {
+			if sfd.MapKey().Kind() != fd.MapKey().Kind() || sfd.MapValue().Kind() != fd.MapValue().Kind() {
+				rft.Clear(fd)
+				return true
+			}
+			if fd.MapValue().Message() == nil {
+				return true
+			}
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				filterToSchema(mv.Message(), sfd.MapValue().Message())
+				return true
+			})
+		} else if fd.Message() != nil {
+			if fd.IsList() {
+				list := v.List()
+				for i := 0; i < list.Len(); i++ {
+					filterToSchema(list.Get(i).Message(), sfd.Message())
+				}
+			} else {
+				filterToSchema(v.Message(), sfd.Message())
+			}
+		}
+		return true
+	})
+}
+
+// FilterByNumbers keeps the top level msg fields with the given field numbers and clears all the rest.
+//
+// Nested fields are not affected. Unlike Filter, all the fields are cleared if no numbers are given.
+func FilterByNumbers(msg proto.Message, numbers ...int) {
+	if isNil(msg) {
+		return
+	}
+	keep := make(map[protoreflect.FieldNumber]bool, len(numbers))
+	for _, n := range numbers {
+		keep[protoreflect.FieldNumber(n)] = true
+	}
+	rft := msg.ProtoReflect()
+	rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if !keep[fd.Number()] {
+			rft.Clear(fd)
+		}
+		return true
+	})
+}
+
+// PathsFromFieldNumbers returns the paths of the top level msg fields with the given field numbers.
+//
+// The paths are returned in the order of the numbers. Numbers that don't correspond to a field of msg are skipped,
+// use PathsFromFieldNumbersStrict to detect them. Only the msg type is inspected, so a typed nil msg is fine.
+func PathsFromFieldNumbers(msg proto.Message, numbers ...int) []string {
+	paths, _ := pathsFromFieldNumbers(msg, numbers)
+	return paths
+}
+
+// PathsFromFieldNumbersStrict works like PathsFromFieldNumbers but returns an error listing all the numbers that
+// don't correspond to a field of msg.
+func PathsFromFieldNumbersStrict(msg proto.Message, numbers ...int) ([]string, error) {
+	paths, unknown := pathsFromFieldNumbers(msg, numbers)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("fmutils: message %s has no fields with numbers %v",
+			msg.ProtoReflect().Descriptor().FullName(), unknown)
+	}
+	return paths, nil
+}
+
+// pathsFromFieldNumbers returns the paths of the msg fields with the given numbers and the numbers without fields.
+func pathsFromFieldNumbers(msg proto.Message, numbers []int) ([]string, []int) {
+	if msg == nil {
+		return nil, nil
+	}
+	fields := msg.ProtoReflect().Descriptor().Fields()
+	paths := make([]string, 0, len(numbers))
+	var unknown []int
+	for _, n := range numbers {
+		if fd := fields.ByNumber(protoreflect.FieldNumber(n)); fd != nil {
+			paths = append(paths, string(fd.Name()))
+		} else {
+			unknown = append(unknown, n)
+		}
+	}
+	return paths, unknown
+}
@@ -1,11 +1,25 @@
 package fmutils
 
 import (
+	"fmt"
+	"math"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/mennanov/fmutils/testproto"
 )
@@ -47,6 +61,29 @@ func Test_NestedMaskFromPaths(t *testing.T) {
 			args: args{paths: []string{".", "..", "..."}},
 			want: NestedMask{},
 		},
+		{
+			name: "ancestor path listed first covers nested paths",
+			args: args{paths: []string{"a", "a.b.c", "d.e", "d.e.f"}},
+			want: NestedMask{"a": NestedMask{}, "d": NestedMask{"e": NestedMask{}}},
+		},
+		{
+			name: "ancestor path listed last covers nested paths",
+			args: args{paths: []string{"a.b.c", "a", "d.e.f", "d.e"}},
+			want: NestedMask{"a": NestedMask{}, "d": NestedMask{"e": NestedMask{}}},
+		},
+		{
+			name: "duplicate paths",
+			args: args{paths: []string{"a.b", "a.b", "a.c"}},
+			want: NestedMask{"a": NestedMask{"b": NestedMask{}, "c": NestedMask{}}},
+		},
+		{
+			name: "list indexes",
+			args: args{paths: []string{"a[1]", "b.c[0].d", "b.c[12]"}},
+			want: NestedMask{
+				"a": NestedMask{"[1]": NestedMask{}},
+				"b": NestedMask{"c": NestedMask{"[0]": NestedMask{"d": NestedMask{}}, "[12]": NestedMask{}}},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -57,9 +94,325 @@ func Test_NestedMaskFromPaths(t *testing.T) {
 	}
 }
 
+func TestNestedMaskFromPathsStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		want    NestedMask
+		wantErr bool
+	}{
+		{
+			name:  "distinct paths",
+			paths: []string{"photo.path", "photo.dimensions", "user"},
+			want: NestedMask{
+				"photo": NestedMask{"path": NestedMask{}, "dimensions": NestedMask{}},
+				"user":  NestedMask{},
+			},
+		},
+		{
+			name:  "duplicate paths",
+			paths: []string{"photo.path", "photo.path"},
+			want:  NestedMask{"photo": NestedMask{"path": NestedMask{}}},
+		},
+		{
+			name:    "ancestor path listed last",
+			paths:   []string{"photo.path", "photo"},
+			wantErr: true,
+		},
+		{
+			name:    "ancestor path listed first",
+			paths:   []string{"photo", "photo.path"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NestedMaskFromPathsStrict(tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NestedMaskFromPathsStrict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedMaskFromPathsLimited(t *testing.T) {
+	tests := []struct {
+		name        string
+		paths       []string
+		maxPaths    int
+		maxSegments int
+		want        NestedMask
+		wantErr     bool
+	}{
+		{
+			name:        "within limits",
+			paths:       []string{"photo.path", "gallery[1].path", "user"},
+			maxPaths:    3,
+			maxSegments: 6,
+			want: NestedMask{
+				"photo":   NestedMask{"path": NestedMask{}},
+				"gallery": NestedMask{"[1]": NestedMask{"path": NestedMask{}}},
+				"user":    NestedMask{},
+			},
+		},
+		{
+			name:  "no limits",
+			paths: []string{"photo.path", "user"},
+			want: NestedMask{
+				"photo": NestedMask{"path": NestedMask{}},
+				"user":  NestedMask{},
+			},
+		},
+		{
+			name:     "too many paths",
+			paths:    []string{"photo", "user", "gallery"},
+			maxPaths: 2,
+			wantErr:  true,
+		},
+		{
+			name:        "too many segments",
+			paths:       []string{"photo.dimensions.width", "gallery[1].path"},
+			maxSegments: 5,
+			wantErr:     true,
+		},
+		{
+			name:        "empty segments are not counted",
+			paths:       []string{"..photo..path.", ""},
+			maxSegments: 2,
+			want:        NestedMask{"photo": NestedMask{"path": NestedMask{}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NestedMaskFromPathsLimited(tt.paths, tt.maxPaths, tt.maxSegments)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NestedMaskFromPathsLimited() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedMask_Sub(t *testing.T) {
+	mask := NestedMaskFromPaths([]string{"photo.path", "photo.dimensions.width", "user", "gallery[1].path"})
+	tests := []struct {
+		field  string
+		want   NestedMask
+		wantOk bool
+	}{
+		{
+			field:  "photo",
+			want:   NestedMask{"path": NestedMask{}, "dimensions": NestedMask{"width": NestedMask{}}},
+			wantOk: true,
+		},
+		{
+			field:  "photo.dimensions",
+			want:   NestedMask{"width": NestedMask{}},
+			wantOk: true,
+		},
+		{
+			field:  "photo.path",
+			want:   NestedMask{},
+			wantOk: true,
+		},
+		{
+			field:  "user",
+			want:   NestedMask{},
+			wantOk: true,
+		},
+		{
+			field:  "user.name",
+			want:   NestedMask{},
+			wantOk: true,
+		},
+		{
+			field:  "gallery[1]",
+			want:   NestedMask{"path": NestedMask{}},
+			wantOk: true,
+		},
+		{
+			field:  "photo.photo_id",
+			wantOk: false,
+		},
+		{
+			field:  "attributes",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			got, ok := mask.Sub(tt.field)
+			if ok != tt.wantOk {
+				t.Fatalf("Sub() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sub() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedMask_Clone(t *testing.T) {
+	mask := NestedMaskFromPaths([]string{"user.name", "photo", "attributes.*.tags.t1"})
+	clone := mask.Clone()
+	if !reflect.DeepEqual(clone, mask) {
+		t.Fatalf("Clone() = %v, want %v", clone, mask)
+	}
+
+	clone["gallery"] = NestedMask{}
+	clone["user"]["user_id"] = NestedMask{}
+	clone["photo"]["path"] = NestedMask{}
+	delete(clone["attributes"]["*"]["tags"], "t1")
+	want := NestedMaskFromPaths([]string{"user.name", "photo", "attributes.*.tags.t1"})
+	if !reflect.DeepEqual(mask, want) {
+		t.Errorf("original mask is modified: %v, want %v", mask, want)
+	}
+
+	mask["user"]["foo"] = NestedMask{}
+	if _, ok := clone["user"]["foo"]; ok {
+		t.Errorf("clone is modified: %v", clone)
+	}
+
+	if got := NestedMask(nil).Clone(); got != nil {
+		t.Errorf("Clone() of nil mask = %v, want nil", got)
+	}
+}
+
+func TestNestedMask_Intersect(t *testing.T) {
+	tests := []struct {
+		name  string
+		mask  []string
+		other []string
+		want  []string
+	}{
+		{
+			name:  "overlapping",
+			mask:  []string{"user.name", "photo.path", "gallery"},
+			other: []string{"user.name", "photo.photo_id", "login_timestamps"},
+			want:  []string{"user.name"},
+		},
+		{
+			name:  "disjoint",
+			mask:  []string{"user", "photo.path"},
+			other: []string{"gallery", "photo.dimensions"},
+			want:  []string{},
+		},
+		{
+			name:  "leaf intersected with a sub-mask",
+			mask:  []string{"photo", "user.name"},
+			other: []string{"photo.path", "photo.dimensions.width", "user"},
+			want:  []string{"photo.path", "photo.dimensions.width", "user.name"},
+		},
+		{
+			name:  "nested overlap",
+			mask:  []string{"photo.dimensions.width", "photo.dimensions.height", "photo.path"},
+			other: []string{"photo.dimensions.width", "photo.photo_id"},
+			want:  []string{"photo.dimensions.width"},
+		},
+		{
+			name:  "wildcard key",
+			mask:  []string{"attributes.*.tags", "attributes.a2"},
+			other: []string{"attributes.a1", "attributes.a2.tags.t1", "attributes.*.tags.t2"},
+			want:  []string{"attributes.a1.tags", "attributes.a2.tags.t1", "attributes.*.tags.t2"},
+		},
+		{
+			name:  "empty mask",
+			mask:  []string{},
+			other: []string{"user"},
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask, other := NestedMaskFromPaths(tt.mask), NestedMaskFromPaths(tt.other)
+			want := NestedMaskFromPaths(tt.want)
+			if got := mask.Intersect(other); !reflect.DeepEqual(got, want) {
+				t.Errorf("Intersect() = %v, want %v", got, want)
+			}
+			if got := other.Intersect(mask); !reflect.DeepEqual(got, want) {
+				t.Errorf("reversed Intersect() = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(mask, NestedMaskFromPaths(tt.mask)) || !reflect.DeepEqual(other, NestedMaskFromPaths(tt.other)) {
+				t.Error("Intersect() modified the masks")
+			}
+		})
+	}
+}
+
+func TestNestedMask_Covers(t *testing.T) {
+	allowed := NestedMaskFromPaths([]string{"user.name", "photo", "attributes.*.tags", "gallery.path"})
+	tests := []struct {
+		name      string
+		allowed   NestedMask
+		requested []string
+		want      bool
+	}{
+		{
+			name:      "equal paths",
+			allowed:   allowed,
+			requested: []string{"user.name", "photo", "gallery.path"},
+			want:      true,
+		},
+		{
+			name:      "deeper paths",
+			allowed:   allowed,
+			requested: []string{"photo.dimensions.width", "attributes.a1.tags.t1"},
+			want:      true,
+		},
+		{
+			name:      "wider path",
+			allowed:   allowed,
+			requested: []string{"user"},
+			want:      false,
+		},
+		{
+			name:      "sibling path",
+			allowed:   allowed,
+			requested: []string{"user.user_id"},
+			want:      false,
+		},
+		{
+			name:      "outside path",
+			allowed:   allowed,
+			requested: []string{"photo", "login_timestamps"},
+			want:      false,
+		},
+		{
+			name:      "map key not covered by wildcard sub-mask",
+			allowed:   allowed,
+			requested: []string{"attributes.a1"},
+			want:      false,
+		},
+		{
+			name:      "empty requested mask",
+			allowed:   allowed,
+			requested: nil,
+			want:      true,
+		},
+		{
+			name:      "empty allowed mask",
+			allowed:   NestedMask{},
+			requested: []string{"user"},
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.allowed.Covers(NestedMaskFromPaths(tt.requested)); got != tt.want {
+				t.Errorf("Covers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func createAny(m proto.Message) *anypb.Any {
-	any, err := anypb.New(m)
-	if err != nil {
+	any := &anypb.Any{}
+	if err := anypb.MarshalFrom(any, m, proto.MarshalOptions{AllowPartial: true}); err != nil {
 		panic(err)
 	}
 	return any
@@ -208,6 +561,33 @@ func TestFilter(t *testing.T) {
 				}},
 			},
 		},
+		{
+			name:  "mask without oneof members clears the active member",
+			paths: []string{"event_id"},
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_User{User: &testproto.User{UserId: 1}},
+			},
+			want: &testproto.Event{EventId: 1},
+		},
+		{
+			name:  "mask with a non-active oneof member clears the active member",
+			paths: []string{"event_id", "photo"},
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_User{User: &testproto.User{UserId: 1}},
+			},
+			want: &testproto.Event{EventId: 1},
+		},
+		{
+			name:  "mask with a sub-mask of a non-active oneof member clears the active member",
+			paths: []string{"photo.path", "status"},
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Profile{Profile: &testproto.Profile{User: &testproto.User{UserId: 1}}},
+			},
+			want: &testproto.Event{},
+		},
 		{
 			name:  "mask with nested oneof fields keeps listed fields only",
 			paths: []string{"profile.photo.dimensions", "profile.user.user_id", "profile.login_timestamps"},
@@ -425,100 +805,425 @@ func TestFilter(t *testing.T) {
 				},
 			},
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			Filter(tt.msg, tt.paths)
-			if !proto.Equal(tt.msg, tt.want) {
-				t.Errorf("msg %v, want %v", tt.msg, tt.want)
-			}
-		})
-	}
-}
-
-func TestPrune(t *testing.T) {
-	tests := []struct {
-		name  string
-		paths []string
-		msg   proto.Message
-		want  proto.Message
-	}{
 		{
-			name:  "empty mask keeps all the fields",
-			paths: []string{},
-			msg: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 1,
-					Name:   "user name",
+			name:  "mask with optional field keeps the field set to default value",
+			paths: []string{"optional_string"},
+			msg: &testproto.Options{
+				OptionalString: proto.String(""),
+				OptionalInt:    proto.Int64(0),
+			},
+			want: &testproto.Options{
+				OptionalString: proto.String(""),
+			},
+		},
+		{
+			name:  "mask without optional field clears the field set to default value",
+			paths: []string{"optional_int"},
+			msg: &testproto.Options{
+				OptionalString: proto.String(""),
+			},
+			want: &testproto.Options{},
+		},
+		{
+			name:  "mask with nested Any field filters the packed message",
+			paths: []string{"details.name"},
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Details{
+					Details: createAny(&testproto.User{UserId: 1, Name: "name"}),
 				},
-				Photo: &testproto.Photo{
-					PhotoId: 2,
-					Path:    "photo path",
-					Dimensions: &testproto.Dimensions{
-						Width:  100,
-						Height: 120,
-					},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_Details{
+					Details: createAny(&testproto.User{Name: "name"}),
 				},
 			},
-			want: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 1,
-					Name:   "user name",
+		},
+		{
+			name:  "mask with repeated Any field filters every packed message",
+			paths: []string{"payloads.name", "payloads.path"},
+			msg: &testproto.Event{
+				EventId: 1,
+				Payloads: []*anypb.Any{
+					createAny(&testproto.User{UserId: 1, Name: "name"}),
+					createAny(&testproto.Photo{PhotoId: 2, Path: "path"}),
+					{TypeUrl: "type.googleapis.com/unknown.Type", Value: []byte{8, 1}},
 				},
-				Photo: &testproto.Photo{
-					PhotoId: 2,
-					Path:    "photo path",
-					Dimensions: &testproto.Dimensions{
-						Width:  100,
-						Height: 120,
-					},
+			},
+			want: &testproto.Event{
+				Payloads: []*anypb.Any{
+					createAny(&testproto.User{Name: "name"}),
+					createAny(&testproto.Photo{Path: "path"}),
+					{TypeUrl: "type.googleapis.com/unknown.Type", Value: []byte{8, 1}},
 				},
 			},
 		},
 		{
-			name:  "mask all root fields clears all fields",
-			paths: []string{"user", "photo"},
-			msg: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 1,
-					Name:   "user name",
+			name:  "mask with nested Any field clears the required fields of the packed proto2 message",
+			paths: []string{"details.name"},
+			msg: &testproto.Event{
+				Changed: &testproto.Event_Details{
+					Details: createAny(&testproto.Owner{Email: proto.String("email"), Name: proto.String("name")}),
 				},
-				Photo: &testproto.Photo{
-					PhotoId: 2,
-					Path:    "photo path",
-					Dimensions: &testproto.Dimensions{
-						Width:  100,
-						Height: 120,
-					},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_Details{
+					Details: createAny(&testproto.Owner{Name: proto.String("name")}),
 				},
 			},
-			want: &testproto.Profile{},
 		},
 		{
-			name:  "mask with single root field clears that field only",
-			paths: []string{"user"},
+			name:  "mask with map wildcard key filters all the entries",
+			paths: []string{"attributes.*.tags.t1", "attributes.a1"},
 			msg: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 1,
-					Name:   "user name",
-				},
-				Photo: &testproto.Photo{
-					PhotoId: 2,
-					Path:    "photo path",
-					Dimensions: &testproto.Dimensions{
-						Width:  100,
-						Height: 120,
-					},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+					"a2": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+					"a3": {Tags: map[string]string{"t2": "2"}},
 				},
 			},
 			want: &testproto.Profile{
-				Photo: &testproto.Photo{
-					PhotoId: 2,
-					Path:    "photo path",
-					Dimensions: &testproto.Dimensions{
-						Width:  100,
-						Height: 120,
-					},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+					"a2": {Tags: map[string]string{"t1": "1"}},
+					"a3": {},
+				},
+			},
+		},
+		{
+			name:  "mask with well-known type fields keeps the listed fields only",
+			paths: []string{"created_at.seconds", "session_length"},
+			msg: &testproto.Profile{
+				CreatedAt:     &timestamppb.Timestamp{Seconds: 10, Nanos: 20},
+				SessionLength: &durationpb.Duration{Seconds: 30, Nanos: 40},
+			},
+			want: &testproto.Profile{
+				CreatedAt:     &timestamppb.Timestamp{Seconds: 10},
+				SessionLength: &durationpb.Duration{Seconds: 30, Nanos: 40},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Filter(tt.msg, tt.paths)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_doesNotCreateUnsetMessages(t *testing.T) {
+	paths := []string{
+		"user.name",
+		"photo.dimensions.width",
+		"gallery.dimensions.height",
+		"attributes.a1.tags.t1",
+		"attributes.a2.tags",
+		"created_at.seconds",
+	}
+	msg := &testproto.Profile{
+		Photo:      &testproto.Photo{Path: "path"},
+		Gallery:    []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2, Dimensions: &testproto.Dimensions{Width: 10}}},
+		Attributes: map[string]*testproto.Attribute{"a2": {}},
+	}
+	Filter(msg, paths)
+	want := &testproto.Profile{
+		Photo:      &testproto.Photo{},
+		Gallery:    []*testproto.Photo{{}, {Dimensions: &testproto.Dimensions{}}},
+		Attributes: map[string]*testproto.Attribute{"a2": {}},
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+	if msg.User != nil || msg.CreatedAt != nil {
+		t.Errorf("unset message fields are allocated: user %v, created_at %v", msg.User, msg.CreatedAt)
+	}
+	if msg.Photo.Dimensions != nil || msg.Gallery[0].Dimensions != nil {
+		t.Errorf("unset nested message fields are allocated: %v", msg)
+	}
+	if _, ok := msg.Attributes["a1"]; ok {
+		t.Error("unset map entry is created")
+	}
+
+	event := &testproto.Event{EventId: 1}
+	Filter(event, []string{"profile.user.name", "details", "payload.user"})
+	if !proto.Equal(event, &testproto.Event{}) || event.Changed != nil || event.Payload != nil {
+		t.Errorf("event %v, want no fields allocated", event)
+	}
+	profile := &testproto.Profile{}
+	FilterAt(profile, "photo", []string{"path"})
+	if profile.Photo != nil {
+		t.Errorf("FilterAt allocated the root message %v", profile.Photo)
+	}
+}
+
+func TestFilterPrune_optionalPresence(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         *testproto.Options
+		paths       []string
+		prune       bool
+		wantPresent bool
+	}{
+		{
+			name:        "filter keeps presence of the default value",
+			msg:         &testproto.Options{OptionalString: proto.String("")},
+			paths:       []string{"optional_string"},
+			wantPresent: true,
+		},
+		{
+			name:        "filter doesn't add presence to an unset field",
+			msg:         &testproto.Options{},
+			paths:       []string{"optional_string"},
+			wantPresent: false,
+		},
+		{
+			name:        "filter without the field removes presence",
+			msg:         &testproto.Options{OptionalString: proto.String("")},
+			paths:       []string{"optional_int"},
+			wantPresent: false,
+		},
+		{
+			name:        "prune removes presence of the default value",
+			msg:         &testproto.Options{OptionalString: proto.String("")},
+			paths:       []string{"optional_string"},
+			prune:       true,
+			wantPresent: false,
+		},
+		{
+			name:        "prune of another field keeps presence",
+			msg:         &testproto.Options{OptionalString: proto.String(""), OptionalInt: proto.Int64(0)},
+			paths:       []string{"optional_int"},
+			prune:       true,
+			wantPresent: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prune {
+				Prune(tt.msg, tt.paths)
+			} else {
+				Filter(tt.msg, tt.paths)
+			}
+			rft := tt.msg.ProtoReflect()
+			present := rft.Has(rft.Descriptor().Fields().ByName("optional_string"))
+			if present != tt.wantPresent || (tt.msg.OptionalString != nil) != tt.wantPresent {
+				t.Errorf("optional_string presence %v, want %v", present, tt.wantPresent)
+			}
+			// The presence of the default value is visible on the wire.
+			data, err := proto.Marshal(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := &testproto.Options{}
+			if err := proto.Unmarshal(data, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if (decoded.OptionalString != nil) != tt.wantPresent {
+				t.Errorf("decoded optional_string presence %v, want %v", decoded.OptionalString != nil, tt.wantPresent)
+			}
+		})
+	}
+}
+
+func TestFilter_fieldOrder(t *testing.T) {
+	msg := &testproto.Profile{
+		User:            &testproto.User{UserId: 1, Name: "user name"},
+		Photo:           &testproto.Photo{PhotoId: 2, Path: "path", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+		LoginTimestamps: []int64{1, 2},
+		Gallery:         []*testproto.Photo{{PhotoId: 3, Path: "gallery path"}},
+		SessionLength:   durationpb.New(time.Second),
+	}
+	// Listed in the reverse order of the fields to make sure the order of the paths doesn't matter.
+	Filter(msg, []string{"session_length", "gallery.path", "gallery.photo_id", "photo.dimensions.height", "photo.photo_id", "user"})
+
+	// The marshalers randomize the whitespace, so only the order of the field names is compared.
+	fieldNames := regexp.MustCompile(`(?m)^\s*"?(\w+)"?:`)
+	names := func(b []byte) []string {
+		var names []string
+		for _, m := range fieldNames.FindAllSubmatch(b, -1) {
+			names = append(names, string(m[1]))
+		}
+		return names
+	}
+
+	text, err := prototext.MarshalOptions{Multiline: true}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"user", "user_id", "name", "photo", "photo_id", "dimensions", "height", "gallery", "photo_id", "path", "session_length", "seconds"}
+	if got := names(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("textproto field order %v, want %v", got, want)
+	}
+
+	jsonData, err := protojson.MarshalOptions{Multiline: true, UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"user", "user_id", "name", "photo", "photo_id", "dimensions", "height", "gallery", "photo_id", "path", "session_length"}
+	if got := names(jsonData); !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON field order %v, want %v", got, want)
+	}
+}
+
+func TestFilterPrune_repeatedScalars(t *testing.T) {
+	newEvent := func() *testproto.Event {
+		return &testproto.Event{
+			EventId:  1,
+			Changed:  &testproto.Event_Status{Status: testproto.Status_OK},
+			Statuses: []testproto.Status{testproto.Status_OK, testproto.Status_FAILED, testproto.Status_UNKNOWN},
+		}
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		prune bool
+		msg   proto.Message
+		want  proto.Message
+	}{
+		{
+			name:  "filter keeps repeated enum",
+			paths: []string{"statuses"},
+			msg:   newEvent(),
+			want: &testproto.Event{
+				Statuses: []testproto.Status{testproto.Status_OK, testproto.Status_FAILED, testproto.Status_UNKNOWN},
+			},
+		},
+		{
+			name:  "filter clears repeated enum",
+			paths: []string{"event_id", "status"},
+			msg:   newEvent(),
+			want:  &testproto.Event{EventId: 1, Changed: &testproto.Event_Status{Status: testproto.Status_OK}},
+		},
+		{
+			name:  "prune clears repeated enum",
+			paths: []string{"statuses"},
+			prune: true,
+			msg:   newEvent(),
+			want:  &testproto.Event{EventId: 1, Changed: &testproto.Event_Status{Status: testproto.Status_OK}},
+		},
+		{
+			name:  "prune keeps repeated enum",
+			paths: []string{"event_id"},
+			prune: true,
+			msg:   newEvent(),
+			want: &testproto.Event{
+				Changed:  &testproto.Event_Status{Status: testproto.Status_OK},
+				Statuses: []testproto.Status{testproto.Status_OK, testproto.Status_FAILED, testproto.Status_UNKNOWN},
+			},
+		},
+		{
+			name:  "filter keeps repeated scalar",
+			paths: []string{"login_timestamps"},
+			msg:   &testproto.Profile{User: &testproto.User{UserId: 1}, LoginTimestamps: []int64{1, 2}},
+			want:  &testproto.Profile{LoginTimestamps: []int64{1, 2}},
+		},
+		{
+			name:  "prune clears repeated scalar",
+			paths: []string{"login_timestamps"},
+			prune: true,
+			msg:   &testproto.Profile{User: &testproto.User{UserId: 1}, LoginTimestamps: []int64{1, 2}},
+			want:  &testproto.Profile{User: &testproto.User{UserId: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prune {
+				Prune(tt.msg, tt.paths)
+			} else {
+				Filter(tt.msg, tt.paths)
+			}
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		msg   proto.Message
+		want  proto.Message
+	}{
+		{
+			name:  "empty mask keeps all the fields",
+			paths: []string{},
+			msg: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+					Name:   "user name",
+				},
+				Photo: &testproto.Photo{
+					PhotoId: 2,
+					Path:    "photo path",
+					Dimensions: &testproto.Dimensions{
+						Width:  100,
+						Height: 120,
+					},
+				},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+					Name:   "user name",
+				},
+				Photo: &testproto.Photo{
+					PhotoId: 2,
+					Path:    "photo path",
+					Dimensions: &testproto.Dimensions{
+						Width:  100,
+						Height: 120,
+					},
+				},
+			},
+		},
+		{
+			name:  "mask all root fields clears all fields",
+			paths: []string{"user", "photo"},
+			msg: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+					Name:   "user name",
+				},
+				Photo: &testproto.Photo{
+					PhotoId: 2,
+					Path:    "photo path",
+					Dimensions: &testproto.Dimensions{
+						Width:  100,
+						Height: 120,
+					},
+				},
+			},
+			want: &testproto.Profile{},
+		},
+		{
+			name:  "mask with single root field clears that field only",
+			paths: []string{"user"},
+			msg: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+					Name:   "user name",
+				},
+				Photo: &testproto.Photo{
+					PhotoId: 2,
+					Path:    "photo path",
+					Dimensions: &testproto.Dimensions{
+						Width:  100,
+						Height: 120,
+					},
+				},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{
+					PhotoId: 2,
+					Path:    "photo path",
+					Dimensions: &testproto.Dimensions{
+						Width:  100,
+						Height: 120,
+					},
 				},
 			},
 		},
@@ -757,356 +1462,3236 @@ func TestPrune(t *testing.T) {
 				},
 			},
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			Prune(tt.msg, tt.paths)
-			if !proto.Equal(tt.msg, tt.want) {
-				t.Errorf("msg %v, want %v", tt.msg, tt.want)
-			}
-		})
-	}
-}
-
-func TestOverwrite(t *testing.T) {
-	tests := []struct {
-		name  string
-		paths []string
-		src   proto.Message
-		dest  proto.Message
-		want  proto.Message
-	}{
 		{
-			name: "overwrite scalar/message/map/list",
-			paths: []string{
-				"user.user_id", "photo", "login_timestamps", "attributes",
-			},
-			src: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 567,
-					Name:   "different-name",
+			name:  "mask with repeated Any field prunes every packed message",
+			paths: []string{"payloads.name", "payloads.path"},
+			msg: &testproto.Event{
+				EventId: 1,
+				Payloads: []*anypb.Any{
+					createAny(&testproto.User{UserId: 1, Name: "name"}),
+					createAny(&testproto.Photo{PhotoId: 2, Path: "path"}),
+					{TypeUrl: "type.googleapis.com/unknown.Type", Value: []byte{8, 1}},
 				},
-				Photo: &testproto.Photo{
-					Path: "photo-path",
+			},
+			want: &testproto.Event{
+				EventId: 1,
+				Payloads: []*anypb.Any{
+					createAny(&testproto.User{UserId: 1}),
+					createAny(&testproto.Photo{PhotoId: 2}),
+					{TypeUrl: "type.googleapis.com/unknown.Type", Value: []byte{8, 1}},
 				},
-				LoginTimestamps: []int64{1, 2, 3},
-				Attributes: map[string]*testproto.Attribute{
-					"src": {},
+			},
+		},
+		{
+			name:  "mask with nested Any field prunes the required fields of the packed proto2 message",
+			paths: []string{"details.email"},
+			msg: &testproto.Event{
+				Changed: &testproto.Event_Details{
+					Details: createAny(&testproto.Owner{Email: proto.String("email"), Name: proto.String("name")}),
 				},
 			},
-			dest: &testproto.Profile{
-				User: &testproto.User{
-					Name: "name",
+			want: &testproto.Event{
+				Changed: &testproto.Event_Details{
+					Details: createAny(&testproto.Owner{Name: proto.String("name")}),
 				},
-				LoginTimestamps: []int64{4},
+			},
+		},
+		{
+			name:  "mask with map wildcard key prunes all the entries",
+			paths: []string{"attributes.*.tags.secret"},
+			msg: &testproto.Profile{
 				Attributes: map[string]*testproto.Attribute{
-					"dest": {},
+					"a1": {Tags: map[string]string{"secret": "1", "t2": "2"}},
+					"a2": {Tags: map[string]string{"secret": "1"}},
+					"a3": {Tags: map[string]string{"t2": "2"}},
 				},
 			},
 			want: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 567,
-					Name:   "name",
-				},
-				Photo: &testproto.Photo{
-					Path: "photo-path",
-				},
-				LoginTimestamps: []int64{1, 2, 3},
 				Attributes: map[string]*testproto.Attribute{
-					"src": {},
+					"a1": {Tags: map[string]string{"t2": "2"}},
+					"a2": {},
+					"a3": {Tags: map[string]string{"t2": "2"}},
 				},
 			},
 		},
 		{
-			name:  "field inside nil message",
-			paths: []string{"photo.path"},
-			src: &testproto.Profile{
-				Photo: &testproto.Photo{
-					Path: "photo-path",
+			name:  "mask with map wildcard key and explicit key prunes explicit key entirely",
+			paths: []string{"attributes.*.tags.secret", "attributes.a2"},
+			msg: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"secret": "1", "t2": "2"}},
+					"a2": {Tags: map[string]string{"secret": "1", "t2": "2"}},
 				},
 			},
-			dest: &testproto.Profile{
-				Photo: nil,
-			},
 			want: &testproto.Profile{
-				Photo: &testproto.Photo{
-					Path: "photo-path",
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t2": "2"}},
 				},
 			},
 		},
 		{
-			name:  "empty message/map/list fields",
-			paths: []string{"user", "photo.photo_id", "attributes", "login_timestamps"},
-
-			src: &testproto.Profile{
-				User: nil, // Empty message
-				Photo: &testproto.Photo{
-					PhotoId: 0, // Empty scalar
-				},
-				Attributes:      make(map[string]*testproto.Attribute), // Empty map
-				LoginTimestamps: make([]int64, 0),                      // Empty list
-			},
-			dest: &testproto.Profile{
-				User: &testproto.User{
-					Name: "name",
-				},
-				Photo: &testproto.Photo{
-					PhotoId: 1234,
-				},
-				Attributes: map[string]*testproto.Attribute{
-					"attribute": {
-						Tags: map[string]string{
-							"tag": "val",
-						},
-					},
-				},
-				LoginTimestamps: []int64{1, 2, 3},
-				Gallery: []*testproto.Photo{
-					{
-						PhotoId: 567,
-						Path:    "path",
+			name:  "mask with nested field inside oneof message keeps the oneof case",
+			paths: []string{"profile.user.name"},
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Profile{
+					Profile: &testproto.Profile{
+						User: &testproto.User{UserId: 1, Name: "name"},
 					},
 				},
 			},
-			want: &testproto.Profile{
-				User: nil, // Empty message
-				Photo: &testproto.Photo{
-					PhotoId: 0, // Empty scalar
-				},
-				Attributes:      make(map[string]*testproto.Attribute), // Empty map
-				LoginTimestamps: make([]int64, 0),                      // Empty list
-				Gallery: []*testproto.Photo{
-					{
-						PhotoId: 567,
-						Path:    "path",
+			want: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Profile{
+					Profile: &testproto.Profile{
+						User: &testproto.User{UserId: 1},
 					},
 				},
 			},
 		},
 		{
-			name:  "overwrite map with message values",
-			paths: []string{"attributes.src1.tags.key1", "attributes.src2"},
-			src: &testproto.Profile{
-				User: nil,
-				Attributes: map[string]*testproto.Attribute{
-					"src1": {
-						Tags: map[string]string{"key1": "value1", "key2": "value2"},
-					},
-					"src2": {
-						Tags: map[string]string{"key3": "value3"},
+			name:  "mask with oneof field that is not set keeps the oneof case",
+			paths: []string{"user"},
+			msg: &testproto.Event{
+				Changed: &testproto.Event_Profile{
+					Profile: &testproto.Profile{
+						User: &testproto.User{Name: "name"},
 					},
 				},
 			},
-			dest: &testproto.Profile{
-				User: &testproto.User{
-					Name: "name",
-				},
-				Attributes: map[string]*testproto.Attribute{
-					"dest1": {
-						Tags: map[string]string{"key4": "value4"},
+			want: &testproto.Event{
+				Changed: &testproto.Event_Profile{
+					Profile: &testproto.Profile{
+						User: &testproto.User{Name: "name"},
 					},
 				},
 			},
+		},
+		{
+			name:  "mask with well-known type fields clears the listed fields only",
+			paths: []string{"created_at.nanos", "session_length.seconds"},
+			msg: &testproto.Profile{
+				CreatedAt:     &timestamppb.Timestamp{Seconds: 10, Nanos: 20},
+				SessionLength: &durationpb.Duration{Seconds: 30, Nanos: 40},
+			},
 			want: &testproto.Profile{
-				User: &testproto.User{
-					Name: "name",
-				},
-				Attributes: map[string]*testproto.Attribute{
-					"src1": {
-						Tags: map[string]string{"key1": "value1"},
-					},
-					"src2": {
-						Tags: map[string]string{"key3": "value3"},
-					},
-					"dest1": {
-						Tags: map[string]string{"key4": "value4"},
-					},
-				},
+				CreatedAt:     &timestamppb.Timestamp{Seconds: 10},
+				SessionLength: &durationpb.Duration{Nanos: 40},
 			},
 		},
 		{
-			name:  "overwrite repeated message fields",
-			paths: []string{"gallery.path"},
-			src: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 567,
-					Name:   "different-name",
-				},
-				Photo: &testproto.Photo{
-					Path: "photo-path",
-				},
+			name:  "mask with list indexes prunes the listed elements only",
+			paths: []string{"gallery[0].path", "gallery[2]", "login_timestamps[1]"},
+			msg: &testproto.Profile{
 				LoginTimestamps: []int64{1, 2, 3},
-				Attributes: map[string]*testproto.Attribute{
-					"src": {},
-				},
-				Gallery: []*testproto.Photo{
-					{
-						PhotoId: 123,
-						Path:    "test-path-1",
-						Dimensions: &testproto.Dimensions{
-							Width:  345,
-							Height: 456,
-						},
-					},
-					{
-						PhotoId: 234,
-						Path:    "test-path-2",
-						Dimensions: &testproto.Dimensions{
-							Width:  3456,
-							Height: 4567,
-						},
-					},
-					{
-						PhotoId: 345,
-						Path:    "test-path-3",
-						Dimensions: &testproto.Dimensions{
-							Width:  34567,
-							Height: 45678,
-						},
-					},
-				},
-			},
-			dest: &testproto.Profile{
-				User: &testproto.User{
-					Name: "name",
-				},
 				Gallery: []*testproto.Photo{
-					{
-						PhotoId: 123,
-						Path:    "test-path-7",
-						Dimensions: &testproto.Dimensions{
-							Width:  345,
-							Height: 456,
-						},
-					},
-					{
-						PhotoId: 234,
-						Path:    "test-path-6",
-						Dimensions: &testproto.Dimensions{
-							Width:  3456,
-							Height: 4567,
-						},
-					},
-					{
-						PhotoId: 345,
-						Path:    "test-path-5",
-						Dimensions: &testproto.Dimensions{
-							Width:  34567,
-							Height: 45678,
-						},
-					},
-					{
-						PhotoId: 345,
-						Path:    "test-path-4",
-						Dimensions: &testproto.Dimensions{
-							Width:  34567,
-							Height: 45678,
-						},
-					},
+					{PhotoId: 1, Path: "path1"},
+					{PhotoId: 2, Path: "path2"},
+					{PhotoId: 3, Path: "path3"},
 				},
 			},
 			want: &testproto.Profile{
-				User: &testproto.User{
-					Name: "name",
-				},
+				LoginTimestamps: []int64{1, 3},
 				Gallery: []*testproto.Photo{
-					{
-						PhotoId: 123,
-						Path:    "test-path-1",
-						Dimensions: &testproto.Dimensions{
-							Width:  345,
-							Height: 456,
-						},
-					},
-					{
-						PhotoId: 234,
-						Path:    "test-path-2",
-						Dimensions: &testproto.Dimensions{
-							Width:  3456,
-							Height: 4567,
-						},
-					},
-					{
-						PhotoId: 345,
-						Path:    "test-path-3",
-						Dimensions: &testproto.Dimensions{
-							Width:  34567,
-							Height: 45678,
-						},
-					},
+					{PhotoId: 1},
+					{PhotoId: 2, Path: "path2"},
 				},
 			},
 		},
 		{
-			name:  "overwrite repeated message fields to empty list",
-			paths: []string{"gallery.path"},
-			src: &testproto.Profile{
-				User: &testproto.User{
-					UserId: 567,
-					Name:   "different-name",
-				},
-				Photo: &testproto.Photo{
-					Path: "photo-path",
-				},
-				LoginTimestamps: []int64{1, 2, 3},
-				Attributes: map[string]*testproto.Attribute{
-					"src": {},
-				},
+			name:  "mask with list indexes and a sub-mask of all the elements",
+			paths: []string{"gallery.path", "gallery[1].photo_id"},
+			msg: &testproto.Profile{
 				Gallery: []*testproto.Photo{
-					{
-						PhotoId: 123,
-						Path:    "test-path-1",
-						Dimensions: &testproto.Dimensions{
-							Width:  345,
-							Height: 456,
-						},
-					},
-					{
-						PhotoId: 234,
-						Path:    "test-path-2",
-						Dimensions: &testproto.Dimensions{
-							Width:  3456,
-							Height: 4567,
-						},
-					},
-					{
-						PhotoId: 345,
-						Path:    "test-path-3",
-						Dimensions: &testproto.Dimensions{
-							Width:  34567,
-							Height: 45678,
-						},
-					},
+					{PhotoId: 1, Path: "path1"},
+					{PhotoId: 2, Path: "path2", Thumbnail: []byte("thumb")},
 				},
 			},
-			dest: &testproto.Profile{},
 			want: &testproto.Profile{
 				Gallery: []*testproto.Photo{
-					{
-						Path: "test-path-1",
-					},
-					{
-						Path: "test-path-2",
-					},
-					{
-						Path: "test-path-3",
-					},
+					{PhotoId: 1},
+					{Thumbnail: []byte("thumb")},
 				},
 			},
 		},
+		{
+			name:  "mask with all the list indexes clears the list",
+			paths: []string{"login_timestamps[0]", "login_timestamps[1]"},
+			msg: &testproto.Profile{
+				User:            &testproto.User{UserId: 1},
+				LoginTimestamps: []int64{1, 2},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{UserId: 1},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			Overwrite(tt.src, tt.dest, tt.paths)
-			if !proto.Equal(tt.dest, tt.want) {
+			Prune(tt.msg, tt.paths)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneExcept(t *testing.T) {
+	paths := []string{"user.name", "gallery.path"}
+	msg := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+			Name:   "user name",
+		},
+		Photo: &testproto.Photo{
+			PhotoId: 2,
+		},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 3, Path: "gallery path"},
+		},
+	}
+	want := proto.Clone(msg)
+	Filter(want, paths)
+	PruneExcept(msg, paths)
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
+
+func TestFilterWithOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		opts  FilterOptions
+		msg   proto.Message
+		want  proto.Message
+	}{
+		{
+			name:  "emptied elements are kept by default",
+			paths: []string{"gallery.dimensions"},
+			msg: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1},
+					{PhotoId: 2, Dimensions: &testproto.Dimensions{Width: 100}},
+				},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{},
+					{Dimensions: &testproto.Dimensions{Width: 100}},
+				},
+			},
+		},
+		{
+			name:  "emptied elements are dropped",
+			paths: []string{"gallery.dimensions"},
+			opts:  FilterOptions{DropEmptyElements: true},
+			msg: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1},
+					{PhotoId: 2, Dimensions: &testproto.Dimensions{Width: 100}},
+					{},
+					{PhotoId: 3, Dimensions: &testproto.Dimensions{Height: 50}},
+				},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{Dimensions: &testproto.Dimensions{Width: 100}},
+					{Dimensions: &testproto.Dimensions{Height: 50}},
+				},
+			},
+		},
+		{
+			name:  "list without elements left is cleared",
+			paths: []string{"gallery.dimensions", "user"},
+			opts:  FilterOptions{DropEmptyElements: true},
+			msg: &testproto.Profile{
+				User:    &testproto.User{Name: "name"},
+				Gallery: []*testproto.Photo{{PhotoId: 1}, {Path: "path"}},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{Name: "name"},
+			},
+		},
+		{
+			name:  "nested lists",
+			paths: []string{"profile.gallery.path"},
+			opts:  FilterOptions{DropEmptyElements: true},
+			msg: &testproto.Event{
+				Changed: &testproto.Event_Profile{Profile: &testproto.Profile{
+					Gallery: []*testproto.Photo{{PhotoId: 1}, {Path: "path"}},
+				}},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_Profile{Profile: &testproto.Profile{
+					Gallery: []*testproto.Photo{{Path: "path"}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			FilterWithOptions(tt.msg, tt.paths, tt.opts)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverwriteWithOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		opts  OverwriteOptions
+		src   proto.Message
+		dest  proto.Message
+		want  proto.Message
+	}{
+		{
+			name:  "merge messages preserves dest sub-fields not set in src",
+			paths: []string{"photo", "user.name"},
+			opts:  OverwriteOptions{MergeMessages: true},
+			src: &testproto.Profile{
+				User: &testproto.User{UserId: 1, Name: "src name"},
+				Photo: &testproto.Photo{
+					Path:       "src path",
+					Dimensions: &testproto.Dimensions{Width: 50},
+				},
+			},
+			dest: &testproto.Profile{
+				User: &testproto.User{UserId: 2, Name: "dest name"},
+				Photo: &testproto.Photo{
+					PhotoId:    3,
+					Path:       "dest path",
+					Dimensions: &testproto.Dimensions{Width: 100, Height: 120},
+				},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{UserId: 2, Name: "src name"},
+				Photo: &testproto.Photo{
+					PhotoId:    3,
+					Path:       "src path",
+					Dimensions: &testproto.Dimensions{Width: 50, Height: 120},
+				},
+			},
+		},
+		{
+			name:  "merge messages initiates nil dest message",
+			paths: []string{"photo"},
+			opts:  OverwriteOptions{MergeMessages: true},
+			src: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "src path"},
+			},
+			dest: &testproto.Profile{},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "src path"},
+			},
+		},
+		{
+			name:  "merge messages keeps dest message if src message is not set",
+			paths: []string{"photo"},
+			opts:  OverwriteOptions{MergeMessages: true},
+			src:   &testproto.Profile{},
+			dest: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "dest path"},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "dest path"},
+			},
+		},
+		{
+			name:  "merge messages does not affect lists",
+			paths: []string{"gallery"},
+			opts:  OverwriteOptions{MergeMessages: true},
+			src: &testproto.Profile{
+				Gallery: []*testproto.Photo{{Path: "src path"}},
+			},
+			dest: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2}},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{{Path: "src path"}},
+			},
+		},
+		{
+			name:  "only if unset preserves set dest fields",
+			paths: []string{"user.user_id", "user.name", "photo", "gallery", "login_timestamps", "attributes"},
+			opts:  OverwriteOptions{OnlyIfUnset: true},
+			src: &testproto.Profile{
+				User:            &testproto.User{UserId: 1, Name: "src name"},
+				Photo:           &testproto.Photo{Path: "src path"},
+				Gallery:         []*testproto.Photo{{Path: "src path"}},
+				LoginTimestamps: []int64{1, 2},
+				Attributes: map[string]*testproto.Attribute{
+					"src": {},
+				},
+			},
+			dest: &testproto.Profile{
+				User:            &testproto.User{Name: "dest name"},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+				LoginTimestamps: []int64{},
+			},
+			want: &testproto.Profile{
+				User:            &testproto.User{UserId: 1, Name: "dest name"},
+				Photo:           &testproto.Photo{Path: "src path"},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+				LoginTimestamps: []int64{1, 2},
+				Attributes: map[string]*testproto.Attribute{
+					"src": {},
+				},
+			},
+		},
+		{
+			name:  "only if unset respects optional field presence",
+			paths: []string{"optional_string", "optional_int"},
+			opts:  OverwriteOptions{OnlyIfUnset: true},
+			src: &testproto.Options{
+				OptionalString: proto.String("src"),
+				OptionalInt:    proto.Int64(1),
+			},
+			dest: &testproto.Options{
+				OptionalString: proto.String(""),
+			},
+			want: &testproto.Options{
+				OptionalString: proto.String(""),
+				OptionalInt:    proto.Int64(1),
+			},
+		},
+		{
+			name:  "sparse skips fields absent in src",
+			paths: []string{"user.name", "photo", "login_timestamps", "attributes", "gallery"},
+			opts:  OverwriteOptions{Sparse: true},
+			src: &testproto.Profile{
+				User:            &testproto.User{UserId: 1},
+				LoginTimestamps: []int64{},
+				Attributes:      map[string]*testproto.Attribute{},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+			},
+			dest: &testproto.Profile{
+				User:            &testproto.User{UserId: 2, Name: "dest name"},
+				Photo:           &testproto.Photo{Path: "dest path"},
+				LoginTimestamps: []int64{1, 2},
+				Attributes:      map[string]*testproto.Attribute{"a1": {}},
+			},
+			want: &testproto.Profile{
+				User:            &testproto.User{UserId: 2, Name: "dest name"},
+				Photo:           &testproto.Photo{Path: "dest path"},
+				LoginTimestamps: []int64{1, 2},
+				Attributes:      map[string]*testproto.Attribute{"a1": {}},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+			},
+		},
+		{
+			name:  "sparse skips nested fields of absent messages",
+			paths: []string{"photo.path", "user.name"},
+			opts:  OverwriteOptions{Sparse: true},
+			src: &testproto.Profile{
+				User: &testproto.User{Name: "src name"},
+			},
+			dest: &testproto.Profile{
+				User:  &testproto.User{Name: "dest name"},
+				Photo: &testproto.Photo{Path: "dest path"},
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{Name: "src name"},
+				Photo: &testproto.Photo{Path: "dest path"},
+			},
+		},
+		{
+			name:  "sparse copies present but zero optional fields",
+			paths: []string{"optional_string", "optional_int"},
+			opts:  OverwriteOptions{Sparse: true},
+			src: &testproto.Options{
+				OptionalInt: proto.Int64(0),
+			},
+			dest: &testproto.Options{
+				OptionalString: proto.String("dest"),
+				OptionalInt:    proto.Int64(1),
+			},
+			want: &testproto.Options{
+				OptionalString: proto.String("dest"),
+				OptionalInt:    proto.Int64(0),
+			},
+		},
+		{
+			name:  "sparse skips oneof not set in src",
+			paths: []string{"changed", "event_id"},
+			opts:  OverwriteOptions{Sparse: true},
+			src:   &testproto.Event{EventId: 1},
+			dest: &testproto.Event{
+				Changed: &testproto.Event_Status{Status: testproto.Status_OK},
+			},
+			want: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Status{Status: testproto.Status_OK},
+			},
+		},
+		{
+			name:  "replace whole clears fields not listed",
+			paths: []string{"user.name", "photo", "attributes.a1"},
+			opts:  OverwriteOptions{ReplaceWhole: true},
+			src: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "src name"},
+				Photo: &testproto.Photo{Path: "src path"},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "src"}},
+				},
+			},
+			dest: &testproto.Profile{
+				User:            &testproto.User{UserId: 2, Name: "dest name"},
+				Photo:           &testproto.Photo{PhotoId: 3, Path: "dest path"},
+				LoginTimestamps: []int64{1, 2},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "dest"}},
+					"a2": {Tags: map[string]string{"t2": "dest"}},
+				},
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{Name: "src name"},
+				Photo: &testproto.Photo{Path: "src path"},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "src"}},
+				},
+			},
+		},
+		{
+			name:  "replace whole with oneof listed by name",
+			paths: []string{"changed"},
+			opts:  OverwriteOptions{ReplaceWhole: true},
+			src:   &testproto.Event{EventId: 1, Changed: &testproto.Event_User{User: &testproto.User{UserId: 1}}},
+			dest: &testproto.Event{
+				EventId: 2,
+				Changed: &testproto.Event_Status{Status: testproto.Status_OK},
+			},
+			want: &testproto.Event{Changed: &testproto.Event_User{User: &testproto.User{UserId: 1}}},
+		},
+		{
+			name:  "replace whole with list indexes",
+			paths: []string{"gallery[1]", "photo.path"},
+			opts:  OverwriteOptions{ReplaceWhole: true},
+			src: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 10}, {PhotoId: 20}},
+			},
+			dest: &testproto.Profile{
+				User:    &testproto.User{UserId: 1},
+				Photo:   &testproto.Photo{PhotoId: 3, Path: "dest path"},
+				Gallery: []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2, Path: "dest path 2"}, {PhotoId: 3}},
+			},
+			want: &testproto.Profile{
+				Photo:   &testproto.Photo{},
+				Gallery: []*testproto.Photo{{PhotoId: 1}, {PhotoId: 20}, {PhotoId: 3}},
+			},
+		},
+		{
+			name:  "replace whole with a sub-mask of a list index",
+			paths: []string{"gallery[1].path"},
+			opts:  OverwriteOptions{ReplaceWhole: true},
+			src: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 10}, {PhotoId: 20, Path: "src path"}},
+			},
+			dest: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2, Path: "dest path"}},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 1}, {Path: "src path"}},
+			},
+		},
+		{
+			name:  "custom emptiness test",
+			paths: []string{"user", "photo.path", "photo.photo_id", "attributes.a1", "attributes.a2"},
+			opts: OverwriteOptions{IsEmpty: func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+				switch fd.FullName() {
+				case "testproto.Profile.user":
+					return v.Message().Interface().(*testproto.User).GetName() == ""
+				case "testproto.Photo.path":
+					return v.String() == "-"
+				}
+				if fd.Message() != nil && fd.Message().FullName() == "testproto.Attribute" {
+					_, ok := v.Message().Interface().(*testproto.Attribute).GetTags()["t1"]
+					return !ok
+				}
+				return false
+			}},
+			src: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "-"},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t2": "src"}},
+					"a2": {Tags: map[string]string{"t1": "src"}},
+				},
+			},
+			dest: &testproto.Profile{
+				User:  &testproto.User{UserId: 3, Name: "dest name"},
+				Photo: &testproto.Photo{PhotoId: 4, Path: "dest path"},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "dest"}},
+				},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{PhotoId: 2},
+				Attributes: map[string]*testproto.Attribute{
+					"a2": {Tags: map[string]string{"t1": "src"}},
+				},
+			},
+		},
+		{
+			name:  "custom emptiness test keeps empty messages",
+			paths: []string{"user", "photo"},
+			opts: OverwriteOptions{IsEmpty: func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+				return false
+			}},
+			src: &testproto.Profile{Photo: &testproto.Photo{}},
+			dest: &testproto.Profile{
+				User:  &testproto.User{UserId: 3},
+				Photo: &testproto.Photo{PhotoId: 4},
+			},
+			want: &testproto.Profile{Photo: &testproto.Photo{}},
+		},
+		{
+			name:  "replace whole and sparse",
+			paths: []string{"user.name", "user.user_id"},
+			opts:  OverwriteOptions{ReplaceWhole: true, Sparse: true},
+			src:   &testproto.Profile{User: &testproto.User{Name: "src name"}},
+			dest: &testproto.Profile{
+				User:  &testproto.User{UserId: 2, Name: "dest name"},
+				Photo: &testproto.Photo{PhotoId: 3},
+			},
+			want: &testproto.Profile{User: &testproto.User{UserId: 2, Name: "src name"}},
+		},
+		{
+			name:  "no truncate lists preserves trailing dest elements",
+			paths: []string{"gallery.path"},
+			opts:  OverwriteOptions{NoTruncateLists: true},
+			src: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 1, Path: "src path 1"}},
+			},
+			dest: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 2, Path: "dest path 1"},
+					{PhotoId: 3, Path: "dest path 2"},
+					{PhotoId: 4, Path: "dest path 3"},
+				},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 2, Path: "src path 1"},
+					{PhotoId: 3, Path: "dest path 2"},
+					{PhotoId: 4, Path: "dest path 3"},
+				},
+			},
+		},
+		{
+			name:  "no truncate lists appends extra src elements",
+			paths: []string{"gallery.path"},
+			opts:  OverwriteOptions{NoTruncateLists: true},
+			src: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 1, Path: "src path 1"}, {PhotoId: 2, Path: "src path 2"}},
+			},
+			dest: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 3, Path: "dest path 1"}},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{{PhotoId: 3, Path: "src path 1"}, {Path: "src path 2"}},
+			},
+		},
+		{
+			name:  "no truncate lists still replaces lists listed without a sub-mask",
+			paths: []string{"gallery", "login_timestamps"},
+			opts:  OverwriteOptions{NoTruncateLists: true},
+			src: &testproto.Profile{
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+				LoginTimestamps: []int64{1},
+			},
+			dest: &testproto.Profile{
+				Gallery:         []*testproto.Photo{{PhotoId: 2}, {PhotoId: 3}},
+				LoginTimestamps: []int64{2, 3},
+			},
+			want: &testproto.Profile{
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+				LoginTimestamps: []int64{1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			OverwriteWithOptions(tt.src, tt.dest, tt.paths, tt.opts)
+			if !proto.Equal(tt.dest, tt.want) {
+				t.Errorf("dest %v, want %v", tt.dest, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverwrite_unsetVsEmpty(t *testing.T) {
+	newDest := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:            &testproto.User{UserId: 1},
+			LoginTimestamps: []int64{1},
+			Gallery:         []*testproto.Photo{{PhotoId: 1}},
+			Attributes:      map[string]*testproto.Attribute{"a1": {Tags: map[string]string{"t1": "1"}}},
+		}
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		opts  OverwriteOptions
+		src   *testproto.Profile
+		want  *testproto.Profile
+	}{
+		{
+			name:  "nil message clears dest",
+			paths: []string{"user"},
+			src:   &testproto.Profile{},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{1},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+				Attributes:      map[string]*testproto.Attribute{"a1": {Tags: map[string]string{"t1": "1"}}},
+			},
+		},
+		{
+			name:  "empty message sets an empty dest message",
+			paths: []string{"user"},
+			src:   &testproto.Profile{User: &testproto.User{}},
+			want: &testproto.Profile{
+				User:            &testproto.User{},
+				LoginTimestamps: []int64{1},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+				Attributes:      map[string]*testproto.Attribute{"a1": {Tags: map[string]string{"t1": "1"}}},
+			},
+		},
+		{
+			name:  "nil map and lists clear dest",
+			paths: []string{"attributes", "gallery", "login_timestamps"},
+			src:   &testproto.Profile{},
+			want:  &testproto.Profile{User: &testproto.User{UserId: 1}},
+		},
+		{
+			name:  "empty map and lists clear dest",
+			paths: []string{"attributes", "gallery", "login_timestamps"},
+			src: &testproto.Profile{
+				LoginTimestamps: []int64{},
+				Gallery:         []*testproto.Photo{},
+				Attributes:      map[string]*testproto.Attribute{},
+			},
+			want: &testproto.Profile{User: &testproto.User{UserId: 1}},
+		},
+		{
+			name:  "sparse skips nil and empty maps and lists",
+			paths: []string{"attributes", "gallery", "login_timestamps"},
+			opts:  OverwriteOptions{Sparse: true},
+			src:   &testproto.Profile{Attributes: map[string]*testproto.Attribute{}},
+			want:  newDest(),
+		},
+		{
+			name:  "sparse copies empty messages",
+			paths: []string{"user"},
+			opts:  OverwriteOptions{Sparse: true},
+			src:   &testproto.Profile{User: &testproto.User{}},
+			want: &testproto.Profile{
+				User:            &testproto.User{},
+				LoginTimestamps: []int64{1},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+				Attributes:      map[string]*testproto.Attribute{"a1": {Tags: map[string]string{"t1": "1"}}},
+			},
+		},
+		{
+			name:  "nil and empty map values",
+			paths: []string{"attributes.a1", "attributes.a2"},
+			src:   &testproto.Profile{Attributes: map[string]*testproto.Attribute{"a2": {}}},
+			want: &testproto.Profile{
+				User:            &testproto.User{UserId: 1},
+				LoginTimestamps: []int64{1},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := newDest()
+			OverwriteWithOptions(tt.src, dest, tt.paths, tt.opts)
+			if !proto.Equal(dest, tt.want) {
+				t.Errorf("dest %v, want %v", dest, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverwrite_deepCopy(t *testing.T) {
+	newSrc := func() *testproto.Profile {
+		return &testproto.Profile{
+			Photo:   &testproto.Photo{Path: "photo path", Thumbnail: []byte("thumbnail")},
+			Gallery: []*testproto.Photo{{PhotoId: 1, Path: "path 1"}, {PhotoId: 2, Path: "path 2"}},
+			Attributes: map[string]*testproto.Attribute{
+				"a1": {Tags: map[string]string{"t1": "1"}},
+			},
+		}
+	}
+	mutate := func(src *testproto.Profile) {
+		src.Photo.Path = "mutated"
+		src.Photo.Thumbnail[0] = 'X'
+		src.Gallery[0].Path = "mutated"
+		src.Gallery = append(src.Gallery, &testproto.Photo{PhotoId: 3})
+		src.Attributes["a1"].Tags["t1"] = "mutated"
+		src.Attributes["a2"] = &testproto.Attribute{}
+	}
+	tests := []struct {
+		name  string
+		paths []string
+	}{
+		{name: "whole fields", paths: []string{"photo", "gallery", "attributes"}},
+		{name: "nested leaves", paths: []string{"photo.thumbnail", "photo.path", "gallery[0]", "gallery[1]", "attributes.a1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newSrc()
+			dest := &testproto.Profile{}
+			Overwrite(src, dest, tt.paths)
+			want := proto.Clone(dest)
+			mutate(src)
+			if !proto.Equal(dest, want) {
+				t.Errorf("dest %v is modified along with src, want %v", dest, want)
+			}
+			if !proto.Equal(want, newSrc()) {
+				t.Errorf("dest %v, want %v", want, newSrc())
+			}
+		})
+	}
+
+	src := &testproto.Event{Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}}}
+	dest := &testproto.Event{}
+	Overwrite(src, dest, []string{"changed"})
+	src.GetPhoto().Path = "mutated"
+	if got := dest.GetPhoto().GetPath(); got != "path" {
+		t.Errorf("dest oneof photo path %q, want %q", got, "path")
+	}
+}
+
+func TestOverwriteE_maxNodes(t *testing.T) {
+	src := &testproto.Node{Name: "root"}
+	for i := 0; i < 100; i++ {
+		src.Children = append(src.Children, &testproto.Node{Name: fmt.Sprintf("child %d", i)})
+	}
+	paths := []string{"name", "children.name"}
+	tests := []struct {
+		name     string
+		maxNodes int
+		wantErr  bool
+	}{
+		{name: "no limit", maxNodes: 0},
+		{name: "limit is not exceeded", maxNodes: 101},
+		{name: "limit is exceeded", maxNodes: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := &testproto.Node{}
+			err := OverwriteE(src, dest, paths, OverwriteOptions{MaxNodes: tt.maxNodes})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OverwriteE() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if want := "fmutils: overwrite visited more than 10 messages"; err.Error() != want {
+					t.Errorf("error %q, want %q", err, want)
+				}
+				if len(dest.Children) > tt.maxNodes {
+					t.Errorf("dest has %d children, want at most %d", len(dest.Children), tt.maxNodes)
+				}
+				return
+			}
+			if !proto.Equal(dest, src) {
+				t.Errorf("dest %v, want %v", dest, src)
+			}
+		})
+	}
+}
+
+func TestOverwriteE_typeMismatch(t *testing.T) {
+	src := &testproto.User{UserId: 1, Name: "name"}
+	dest := &testproto.Photo{PhotoId: 2, Path: "path"}
+	err := OverwriteE(src, dest, []string{"user_id", "name"}, OverwriteOptions{})
+	if err == nil {
+		t.Fatal("OverwriteE() error = nil, want a type mismatch error")
+	}
+	if want := "fmutils: cannot overwrite testproto.Photo with testproto.User: message types differ"; err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+	if want := (&testproto.Photo{PhotoId: 2, Path: "path"}); !proto.Equal(dest, want) {
+		t.Errorf("dest %v, want %v", dest, want)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Overwrite() did not panic on mismatched types")
+		}
+	}()
+	Overwrite(src, dest, []string{"user_id"})
+}
+
+func TestOverwriteE_wildcard(t *testing.T) {
+	src := &testproto.Profile{
+		User:       &testproto.User{UserId: 1, Name: "name"},
+		Gallery:    []*testproto.Photo{{PhotoId: 2}},
+		Attributes: map[string]*testproto.Attribute{"a1": {}},
+	}
+	dest := &testproto.Profile{Photo: &testproto.Photo{PhotoId: 3}}
+	if err := OverwriteE(src, dest, []string{"*"}, OverwriteOptions{}); err != nil {
+		t.Fatalf("OverwriteE() error = %v", err)
+	}
+	if !proto.Equal(dest, src) {
+		t.Errorf("dest %v, want %v", dest, src)
+	}
+}
+
+func TestFilterPruneOverwrite_nilMapValues(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			Attributes: map[string]*testproto.Attribute{
+				"a1": nil,
+				"a2": {Tags: map[string]string{"t1": "1"}},
+			},
+		}
+	}
+	tests := []struct {
+		name  string
+		fn    func(msg *testproto.Profile)
+		wantA map[string]*testproto.Attribute
+	}{
+		{
+			name:  "filter with a sub-mask keeps the nil value",
+			fn:    func(msg *testproto.Profile) { Filter(msg, []string{"attributes.a1.tags"}) },
+			wantA: map[string]*testproto.Attribute{"a1": nil},
+		},
+		{
+			name:  "filter with a wildcard sub-mask keeps the nil value",
+			fn:    func(msg *testproto.Profile) { Filter(msg, []string{"attributes.*.tags"}) },
+			wantA: map[string]*testproto.Attribute{"a1": nil, "a2": {Tags: map[string]string{"t1": "1"}}},
+		},
+		{
+			name:  "filter without the key clears the nil value",
+			fn:    func(msg *testproto.Profile) { Filter(msg, []string{"attributes.a2"}) },
+			wantA: map[string]*testproto.Attribute{"a2": {Tags: map[string]string{"t1": "1"}}},
+		},
+		{
+			name:  "prune with a sub-mask keeps the nil value",
+			fn:    func(msg *testproto.Profile) { Prune(msg, []string{"attributes.*.tags"}) },
+			wantA: map[string]*testproto.Attribute{"a1": nil, "a2": {}},
+		},
+		{
+			name:  "prune the key deletes the nil value",
+			fn:    func(msg *testproto.Profile) { Prune(msg, []string{"attributes.a1"}) },
+			wantA: map[string]*testproto.Attribute{"a2": {Tags: map[string]string{"t1": "1"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newProfile()
+			tt.fn(msg)
+			if len(msg.Attributes) != len(tt.wantA) {
+				t.Fatalf("attributes %v, want %v", msg.Attributes, tt.wantA)
+			}
+			for key, want := range tt.wantA {
+				got, ok := msg.Attributes[key]
+				if !ok || (got == nil) != (want == nil) || !proto.Equal(got, want) {
+					t.Errorf("attributes[%q] = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+
+	// A nil src value is an empty message: it clears the listed dest sub-fields or deletes the listed dest entry.
+	src := &testproto.Profile{Attributes: map[string]*testproto.Attribute{"a1": nil, "a2": nil}}
+	dest := &testproto.Profile{Attributes: map[string]*testproto.Attribute{
+		"a1": {Tags: map[string]string{"t1": "1"}},
+		"a2": {Tags: map[string]string{"t2": "2"}},
+	}}
+	Overwrite(src, dest, []string{"attributes.a1.tags", "attributes.a2"})
+	want := &testproto.Profile{Attributes: map[string]*testproto.Attribute{"a1": {}}}
+	if !proto.Equal(dest, want) {
+		t.Errorf("dest %v, want %v", dest, want)
+	}
+}
+
+func TestOverwriteSparse(t *testing.T) {
+	src := &testproto.Profile{
+		User: &testproto.User{Name: "src name"},
+	}
+	dest := &testproto.Profile{
+		User:  &testproto.User{UserId: 1, Name: "dest name"},
+		Photo: &testproto.Photo{Path: "dest path"},
+	}
+	OverwriteSparse(src, dest, []string{"user.user_id", "user.name", "photo"})
+	want := &testproto.Profile{
+		User:  &testproto.User{UserId: 1, Name: "src name"},
+		Photo: &testproto.Photo{Path: "dest path"},
+	}
+	if !proto.Equal(dest, want) {
+		t.Errorf("dest %v, want %v", dest, want)
+	}
+}
+
+func TestNestedMask_FilterFunc(t *testing.T) {
+	msg := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+			Name:   "user name",
+		},
+		Photo: &testproto.Photo{
+			PhotoId: 2,
+			Path:    "photo path",
+		},
+		LoginTimestamps: []int64{1, 2},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 3, Path: "gallery path"},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+			"a2": {},
+		},
+	}
+	var cleared []string
+	NestedMaskFromPaths([]string{"user.name", "photo", "gallery.path", "attributes.a1.tags.t1"}).FilterFunc(msg,
+		func(path string, _ protoreflect.FieldDescriptor) {
+			cleared = append(cleared, path)
+		})
+	sort.Strings(cleared)
+	want := []string{
+		"attributes.a1.tags.t2",
+		"attributes.a2",
+		"gallery.photo_id",
+		"login_timestamps",
+		"user.user_id",
+	}
+	if !reflect.DeepEqual(cleared, want) {
+		t.Errorf("cleared %v, want %v", cleared, want)
+	}
+}
+
+func TestNestedMask_PruneFunc(t *testing.T) {
+	msg := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+			Name:   "user name",
+		},
+		Photo: &testproto.Photo{
+			PhotoId: 2,
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+			"a2": {},
+		},
+	}
+	var cleared []string
+	NestedMaskFromPaths([]string{"user.name", "photo", "gallery", "attributes.a1.tags.t1", "attributes.a2"}).PruneFunc(msg,
+		func(path string, _ protoreflect.FieldDescriptor) {
+			cleared = append(cleared, path)
+		})
+	sort.Strings(cleared)
+	want := []string{
+		"attributes.a1.tags.t1",
+		"attributes.a2",
+		"photo",
+		"user.name",
+	}
+	if !reflect.DeepEqual(cleared, want) {
+		t.Errorf("cleared %v, want %v", cleared, want)
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		src   proto.Message
+		dest  proto.Message
+		want  proto.Message
+	}{
+		{
+			name: "overwrite scalar/message/map/list",
+			paths: []string{
+				"user.user_id", "photo", "login_timestamps", "attributes",
+			},
+			src: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 567,
+					Name:   "different-name",
+				},
+				Photo: &testproto.Photo{
+					Path: "photo-path",
+				},
+				LoginTimestamps: []int64{1, 2, 3},
+				Attributes: map[string]*testproto.Attribute{
+					"src": {},
+				},
+			},
+			dest: &testproto.Profile{
+				User: &testproto.User{
+					Name: "name",
+				},
+				LoginTimestamps: []int64{4},
+				Attributes: map[string]*testproto.Attribute{
+					"dest": {},
+				},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 567,
+					Name:   "name",
+				},
+				Photo: &testproto.Photo{
+					Path: "photo-path",
+				},
+				LoginTimestamps: []int64{1, 2, 3},
+				Attributes: map[string]*testproto.Attribute{
+					"src": {},
+				},
+			},
+		},
+		{
+			name:  "field inside nil message",
+			paths: []string{"photo.path"},
+			src: &testproto.Profile{
+				Photo: &testproto.Photo{
+					Path: "photo-path",
+				},
+			},
+			dest: &testproto.Profile{
+				Photo: nil,
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{
+					Path: "photo-path",
+				},
+			},
+		},
+		{
+			name:  "empty message/map/list fields",
+			paths: []string{"user", "photo.photo_id", "attributes", "login_timestamps"},
+
+			src: &testproto.Profile{
+				User: nil, // Empty message
+				Photo: &testproto.Photo{
+					PhotoId: 0, // Empty scalar
+				},
+				Attributes:      make(map[string]*testproto.Attribute), // Empty map
+				LoginTimestamps: make([]int64, 0),                      // Empty list
+			},
+			dest: &testproto.Profile{
+				User: &testproto.User{
+					Name: "name",
+				},
+				Photo: &testproto.Photo{
+					PhotoId: 1234,
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"attribute": {
+						Tags: map[string]string{
+							"tag": "val",
+						},
+					},
+				},
+				LoginTimestamps: []int64{1, 2, 3},
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 567,
+						Path:    "path",
+					},
+				},
+			},
+			want: &testproto.Profile{
+				User: nil, // Empty message
+				Photo: &testproto.Photo{
+					PhotoId: 0, // Empty scalar
+				},
+				Attributes:      make(map[string]*testproto.Attribute), // Empty map
+				LoginTimestamps: make([]int64, 0),                      // Empty list
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 567,
+						Path:    "path",
+					},
+				},
+			},
+		},
+		{
+			name:  "overwrite map with message values",
+			paths: []string{"attributes.src1.tags.key1", "attributes.src2"},
+			src: &testproto.Profile{
+				User: nil,
+				Attributes: map[string]*testproto.Attribute{
+					"src1": {
+						Tags: map[string]string{"key1": "value1", "key2": "value2"},
+					},
+					"src2": {
+						Tags: map[string]string{"key3": "value3"},
+					},
+				},
+			},
+			dest: &testproto.Profile{
+				User: &testproto.User{
+					Name: "name",
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"dest1": {
+						Tags: map[string]string{"key4": "value4"},
+					},
+				},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{
+					Name: "name",
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"src1": {
+						Tags: map[string]string{"key1": "value1"},
+					},
+					"src2": {
+						Tags: map[string]string{"key3": "value3"},
+					},
+					"dest1": {
+						Tags: map[string]string{"key4": "value4"},
+					},
+				},
+			},
+		},
+		{
+			name:  "overwrite repeated message fields",
+			paths: []string{"gallery.path"},
+			src: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 567,
+					Name:   "different-name",
+				},
+				Photo: &testproto.Photo{
+					Path: "photo-path",
+				},
+				LoginTimestamps: []int64{1, 2, 3},
+				Attributes: map[string]*testproto.Attribute{
+					"src": {},
+				},
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 123,
+						Path:    "test-path-1",
+						Dimensions: &testproto.Dimensions{
+							Width:  345,
+							Height: 456,
+						},
+					},
+					{
+						PhotoId: 234,
+						Path:    "test-path-2",
+						Dimensions: &testproto.Dimensions{
+							Width:  3456,
+							Height: 4567,
+						},
+					},
+					{
+						PhotoId: 345,
+						Path:    "test-path-3",
+						Dimensions: &testproto.Dimensions{
+							Width:  34567,
+							Height: 45678,
+						},
+					},
+				},
+			},
+			dest: &testproto.Profile{
+				User: &testproto.User{
+					Name: "name",
+				},
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 123,
+						Path:    "test-path-7",
+						Dimensions: &testproto.Dimensions{
+							Width:  345,
+							Height: 456,
+						},
+					},
+					{
+						PhotoId: 234,
+						Path:    "test-path-6",
+						Dimensions: &testproto.Dimensions{
+							Width:  3456,
+							Height: 4567,
+						},
+					},
+					{
+						PhotoId: 345,
+						Path:    "test-path-5",
+						Dimensions: &testproto.Dimensions{
+							Width:  34567,
+							Height: 45678,
+						},
+					},
+					{
+						PhotoId: 345,
+						Path:    "test-path-4",
+						Dimensions: &testproto.Dimensions{
+							Width:  34567,
+							Height: 45678,
+						},
+					},
+				},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{
+					Name: "name",
+				},
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 123,
+						Path:    "test-path-1",
+						Dimensions: &testproto.Dimensions{
+							Width:  345,
+							Height: 456,
+						},
+					},
+					{
+						PhotoId: 234,
+						Path:    "test-path-2",
+						Dimensions: &testproto.Dimensions{
+							Width:  3456,
+							Height: 4567,
+						},
+					},
+					{
+						PhotoId: 345,
+						Path:    "test-path-3",
+						Dimensions: &testproto.Dimensions{
+							Width:  34567,
+							Height: 45678,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "overwrite repeated message fields to empty list",
+			paths: []string{"gallery.path"},
+			src: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 567,
+					Name:   "different-name",
+				},
+				Photo: &testproto.Photo{
+					Path: "photo-path",
+				},
+				LoginTimestamps: []int64{1, 2, 3},
+				Attributes: map[string]*testproto.Attribute{
+					"src": {},
+				},
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 123,
+						Path:    "test-path-1",
+						Dimensions: &testproto.Dimensions{
+							Width:  345,
+							Height: 456,
+						},
+					},
+					{
+						PhotoId: 234,
+						Path:    "test-path-2",
+						Dimensions: &testproto.Dimensions{
+							Width:  3456,
+							Height: 4567,
+						},
+					},
+					{
+						PhotoId: 345,
+						Path:    "test-path-3",
+						Dimensions: &testproto.Dimensions{
+							Width:  34567,
+							Height: 45678,
+						},
+					},
+				},
+			},
+			dest: &testproto.Profile{},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{
+						Path: "test-path-1",
+					},
+					{
+						Path: "test-path-2",
+					},
+					{
+						Path: "test-path-3",
+					},
+				},
+			},
+		},
+		{
+			name:  "oneof name switches the dest oneof case",
+			paths: []string{"changed"},
+			src: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{Name: "name"}},
+			},
+			dest: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+			want: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_User{User: &testproto.User{Name: "name"}},
+			},
+		},
+		{
+			name:  "oneof name with unset src oneof clears the dest oneof",
+			paths: []string{"changed"},
+			src:   &testproto.Event{EventId: 2},
+			dest: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+			want: &testproto.Event{
+				EventId: 1,
+			},
+		},
+		{
+			name:  "oneof field switches the dest oneof case",
+			paths: []string{"user"},
+			src: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{Name: "name"}},
+			},
+			dest: &testproto.Event{
+				Changed: &testproto.Event_Status{Status: testproto.Status_OK},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{Name: "name"}},
+			},
+		},
+		{
+			name:  "nested oneof field switches the dest oneof case",
+			paths: []string{"user.name"},
+			src: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{UserId: 1, Name: "name"}},
+			},
+			dest: &testproto.Event{
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{Name: "name"}},
+			},
+		},
+		{
+			name:  "nested oneof field unset in src keeps a different dest oneof case",
+			paths: []string{"user.name"},
+			src: &testproto.Event{
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "src path"}},
+			},
+			dest: &testproto.Event{
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+		},
+		{
+			name:  "nested oneof field unset in src clears the nested field in the same dest oneof case",
+			paths: []string{"user.name"},
+			src: &testproto.Event{
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "src path"}},
+			},
+			dest: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{UserId: 1, Name: "name"}},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{UserId: 1}},
+			},
+		},
+		{
+			name:  "scalar list index grows the dest list",
+			paths: []string{"login_timestamps[2]"},
+			src: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2, 3},
+			},
+			dest: &testproto.Profile{
+				LoginTimestamps: []int64{4},
+			},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{4, 0, 3},
+			},
+		},
+		{
+			name:  "scalar list index overwrites a single element",
+			paths: []string{"login_timestamps[1]"},
+			src: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2, 3},
+			},
+			dest: &testproto.Profile{
+				LoginTimestamps: []int64{4, 5, 6, 7},
+			},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{4, 2, 6, 7},
+			},
+		},
+		{
+			name:  "scalar list index out of src bounds is ignored",
+			paths: []string{"login_timestamps[3]"},
+			src: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2, 3},
+			},
+			dest: &testproto.Profile{
+				LoginTimestamps: []int64{4, 5},
+			},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{4, 5},
+			},
+		},
+		{
+			name:  "message list index overwrites a single element",
+			paths: []string{"gallery[1].path", "gallery[2]"},
+			src: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1, Path: "src path 1"},
+					{PhotoId: 2, Path: "src path 2"},
+					{PhotoId: 3, Path: "src path 3"},
+				},
+			},
+			dest: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 4, Path: "dest path 1"},
+					{PhotoId: 5, Path: "dest path 2"},
+				},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 4, Path: "dest path 1"},
+					{PhotoId: 5, Path: "src path 2"},
+					{PhotoId: 3, Path: "src path 3"},
+				},
+			},
+		},
+		{
+			name:  "optional fields explicitly set to default value",
+			paths: []string{"optional_string", "optional_int"},
+			src: &testproto.Options{
+				OptionalString: proto.String(""),
+				OptionalInt:    proto.Int64(0),
+			},
+			dest: &testproto.Options{
+				OptionalString: proto.String("dest"),
+			},
+			want: &testproto.Options{
+				OptionalString: proto.String(""),
+				OptionalInt:    proto.Int64(0),
+			},
+		},
+		{
+			name:  "optional fields not set in src",
+			paths: []string{"optional_string", "optional_int"},
+			src:   &testproto.Options{},
+			dest: &testproto.Options{
+				OptionalString: proto.String("dest"),
+				OptionalInt:    proto.Int64(0),
+			},
+			want: &testproto.Options{},
+		},
+		{
+			name:  "scalar oneof field not set in src",
+			paths: []string{"status"},
+			src: &testproto.Event{
+				Changed: &testproto.Event_User{User: &testproto.User{Name: "name"}},
+			},
+			dest: &testproto.Event{
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_Photo{Photo: &testproto.Photo{Path: "path"}},
+			},
+		},
+		{
+			name:  "overwrite scalar map values by key",
+			paths: []string{"attributes.a1.tags.t1", "attributes.a1.tags.t2", "attributes.a2.tags.t3"},
+			src: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "src1", "t4": "src4"}},
+					"a2": {Tags: map[string]string{"t3": "src3"}},
+				},
+			},
+			dest: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "dest1", "t2": "dest2", "t5": "dest5"}},
+					"a3": {Tags: map[string]string{"t6": "dest6"}},
+				},
+			},
+			want: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "src1", "t5": "dest5"}},
+					"a2": {Tags: map[string]string{"t3": "src3"}},
+					"a3": {Tags: map[string]string{"t6": "dest6"}},
+				},
+			},
+		},
+		{
+			name:  "overwrite int and bool keyed map entries",
+			paths: []string{"attributes.7.tags.t1", "attributes.-3", "attributes.9", "flags.true"},
+			src: &testproto.Counters{
+				Flags: map[bool]string{true: "src true", false: "src false"},
+				Attributes: map[int64]*testproto.Attribute{
+					7:  {Tags: map[string]string{"t1": "src1", "t2": "src2"}},
+					-3: {Tags: map[string]string{"t3": "src3"}},
+					8:  {Tags: map[string]string{"t8": "src8"}},
+				},
+			},
+			dest: &testproto.Counters{
+				Flags: map[bool]string{false: "dest false"},
+				Attributes: map[int64]*testproto.Attribute{
+					7: {Tags: map[string]string{"t1": "dest1", "t2": "dest2"}},
+					9: {Tags: map[string]string{"t9": "dest9"}},
+				},
+			},
+			want: &testproto.Counters{
+				Flags: map[bool]string{true: "src true", false: "dest false"},
+				Attributes: map[int64]*testproto.Attribute{
+					7:  {Tags: map[string]string{"t1": "src1", "t2": "dest2"}},
+					-3: {Tags: map[string]string{"t3": "src3"}},
+				},
+			},
+		},
+		{
+			name:  "proto2 fields set to custom defaults in src are copied",
+			paths: []string{"name", "limit", "enabled"},
+			src: &testproto.Settings{
+				Name:    proto.String("unnamed"),
+				Limit:   proto.Int64(10),
+				Enabled: proto.Bool(false),
+			},
+			dest: &testproto.Settings{
+				Name:        proto.String("dest"),
+				Enabled:     proto.Bool(true),
+				Description: proto.String("dest"),
+			},
+			want: &testproto.Settings{
+				Name:        proto.String("unnamed"),
+				Limit:       proto.Int64(10),
+				Enabled:     proto.Bool(false),
+				Description: proto.String("dest"),
+			},
+		},
+		{
+			name:  "proto2 fields not set in src are cleared in dest",
+			paths: []string{"name", "limit", "description"},
+			src:   &testproto.Settings{},
+			dest: &testproto.Settings{
+				Name:        proto.String("dest"),
+				Limit:       proto.Int64(0),
+				Enabled:     proto.Bool(false),
+				Description: proto.String("dest"),
+			},
+			want: &testproto.Settings{
+				Enabled: proto.Bool(false),
+			},
+		},
+		{
+			name:  "empty map message value clears dest key",
+			paths: []string{"attributes.a1", "attributes.a2"},
+			src: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {},
+					"a2": {Tags: map[string]string{"t2": "src"}},
+				},
+			},
+			dest: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "dest"}},
+					"a3": {Tags: map[string]string{"t3": "dest"}},
+				},
+			},
+			want: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a2": {Tags: map[string]string{"t2": "src"}},
+					"a3": {Tags: map[string]string{"t3": "dest"}},
+				},
+			},
+		},
+		{
+			name:  "overwrite wildcard with sub-mask",
+			paths: []string{"*.path"},
+			src: &testproto.Profile{
+				User:    &testproto.User{UserId: 1, Name: "src name"},
+				Photo:   &testproto.Photo{PhotoId: 2, Path: "src path"},
+				Gallery: []*testproto.Photo{{PhotoId: 3, Path: "src path 3"}},
+			},
+			dest: &testproto.Profile{
+				User:    &testproto.User{UserId: 4, Name: "dest name"},
+				Photo:   &testproto.Photo{PhotoId: 5, Path: "dest path"},
+				Gallery: []*testproto.Photo{{PhotoId: 6, Path: "dest path 6"}, {PhotoId: 7}},
+			},
+			want: &testproto.Profile{
+				User:    &testproto.User{UserId: 4, Name: "dest name"},
+				Photo:   &testproto.Photo{PhotoId: 5, Path: "src path"},
+				Gallery: []*testproto.Photo{{PhotoId: 6, Path: "src path 3"}},
+			},
+		},
+		{
+			name:  "overwrite wildcard with an explicitly listed field",
+			paths: []string{"*", "user.name"},
+			src: &testproto.Profile{
+				User:            &testproto.User{UserId: 1, Name: "src name"},
+				LoginTimestamps: []int64{1},
+			},
+			dest: &testproto.Profile{
+				User:  &testproto.User{UserId: 2, Name: "dest name"},
+				Photo: &testproto.Photo{PhotoId: 3},
+			},
+			want: &testproto.Profile{
+				User:            &testproto.User{UserId: 2, Name: "src name"},
+				LoginTimestamps: []int64{1},
+			},
+		},
+		{
+			name:  "overwrite map wildcard with sub-mask",
+			paths: []string{"attributes.*.tags"},
+			src: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2"}},
+				},
+			},
+			dest: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"x": "y"}},
+					"a3": {Tags: map[string]string{"t3": "3"}},
+				},
+			},
+			want: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2"}},
+					"a3": {Tags: map[string]string{"t3": "3"}},
+				},
+			},
+		},
+		{
+			name:  "overwrite map wildcard with an explicitly listed key",
+			paths: []string{"attributes.*", "attributes.-1.tags.t1"},
+			src: &testproto.Counters{
+				Attributes: map[int64]*testproto.Attribute{
+					-1: {Tags: map[string]string{"t1": "1", "t2": "2"}},
+					2:  {Tags: map[string]string{"t3": "3"}},
+				},
+			},
+			dest: &testproto.Counters{
+				Attributes: map[int64]*testproto.Attribute{
+					-1: {Tags: map[string]string{"t4": "4"}},
+					3:  {Tags: map[string]string{"t5": "5"}},
+				},
+			},
+			want: &testproto.Counters{
+				Attributes: map[int64]*testproto.Attribute{
+					-1: {Tags: map[string]string{"t1": "1", "t4": "4"}},
+					2:  {Tags: map[string]string{"t3": "3"}},
+					3:  {Tags: map[string]string{"t5": "5"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Overwrite(tt.src, tt.dest, tt.paths)
+			if !proto.Equal(tt.dest, tt.want) {
+				t.Errorf("dest %v, want %v", tt.dest, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterToSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    proto.Message
+		schema proto.Message
+		want   proto.Message
+	}{
+		{
+			name: "fields missing in schema are cleared recursively",
+			msg: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+					Name:   "user name",
+				},
+				Photo: &testproto.Photo{
+					PhotoId: 2,
+					Path:    "photo path",
+					Dimensions: &testproto.Dimensions{
+						Width:  100,
+						Height: 120,
+					},
+				},
+				LoginTimestamps: []int64{1, 2},
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 3,
+						Dimensions: &testproto.Dimensions{
+							Width: 50,
+						},
+					},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {},
+				},
+			},
+			schema: &testproto.ProfileV1{},
+			want: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+					Name:   "user name",
+				},
+				Photo: &testproto.Photo{
+					PhotoId: 2,
+					Path:    "photo path",
+				},
+				Gallery: []*testproto.Photo{
+					{
+						PhotoId: 3,
+					},
+				},
+			},
+		},
+		{
+			name: "oneof field present in schema is filtered recursively",
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Photo{
+					Photo: &testproto.Photo{
+						Path: "photo path",
+						Dimensions: &testproto.Dimensions{
+							Width: 100,
+						},
+					},
+				},
+			},
+			schema: &testproto.EventV1{},
+			want: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Photo{
+					Photo: &testproto.Photo{
+						Path: "photo path",
+					},
+				},
+			},
+		},
+		{
+			name: "oneof field missing in schema is cleared",
+			msg: &testproto.Event{
+				EventId: 1,
+				Changed: &testproto.Event_Status{
+					Status: testproto.Status_OK,
+				},
+			},
+			schema: &testproto.EventV1{},
+			want: &testproto.Event{
+				EventId: 1,
+			},
+		},
+		{
+			name: "same schema keeps all the fields",
+			msg: &testproto.Profile{
+				Photo: &testproto.Photo{
+					Dimensions: &testproto.Dimensions{
+						Width: 100,
+					},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+				},
+			},
+			schema: &testproto.Profile{},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{
+					Dimensions: &testproto.Dimensions{
+						Width: 100,
+					},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			FilterToSchema(tt.msg, tt.schema)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedMask_ConcurrentUse(t *testing.T) {
+	mask := NestedMaskFromPaths([]string{"user.name", "photo.dimensions.width", "gallery.path", "attributes.a1.tags.t1"})
+	want := benchmarkProfile()
+	mask.Filter(want)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				msg := benchmarkProfile()
+				mask.Filter(msg)
+				if !proto.Equal(msg, want) {
+					t.Errorf("msg %v, want %v", msg, want)
+					return
+				}
+				mask.Prune(msg)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFilterByNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		numbers []int
+		msg     proto.Message
+		want    proto.Message
+	}{
+		{
+			name:    "all numbers keep all the fields",
+			numbers: []int{1, 2},
+			msg:     &testproto.User{UserId: 1, Name: "name"},
+			want:    &testproto.User{UserId: 1, Name: "name"},
+		},
+		{
+			name:    "single number keeps that field only",
+			numbers: []int{2},
+			msg:     &testproto.User{UserId: 1, Name: "name"},
+			want:    &testproto.User{Name: "name"},
+		},
+		{
+			name:    "unknown numbers are ignored",
+			numbers: []int{1, 100},
+			msg:     &testproto.User{UserId: 1, Name: "name"},
+			want:    &testproto.User{UserId: 1},
+		},
+		{
+			name:    "no numbers clear all the fields",
+			numbers: nil,
+			msg:     &testproto.User{UserId: 1, Name: "name"},
+			want:    &testproto.User{},
+		},
+		{
+			name:    "nested fields are kept",
+			numbers: []int{2},
+			msg: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path"},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			FilterByNumbers(tt.msg, tt.numbers...)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathsFromFieldNumbers(t *testing.T) {
+	tests := []struct {
+		name       string
+		msg        proto.Message
+		numbers    []int
+		want       []string
+		wantStrict []string
+		wantErr    string
+	}{
+		{
+			name:       "valid numbers",
+			msg:        &testproto.Profile{},
+			numbers:    []int{4, 1, 5},
+			want:       []string{"gallery", "user", "attributes"},
+			wantStrict: []string{"gallery", "user", "attributes"},
+		},
+		{
+			name:    "mix of valid and invalid numbers",
+			msg:     &testproto.Profile{},
+			numbers: []int{1, 42, 2, 0, -1},
+			want:    []string{"user", "photo"},
+			wantErr: "fmutils: message testproto.Profile has no fields with numbers [42 0 -1]",
+		},
+		{
+			name:       "oneof member",
+			msg:        (*testproto.Event)(nil),
+			numbers:    []int{3},
+			want:       []string{"photo"},
+			wantStrict: []string{"photo"},
+		},
+		{
+			name:       "no numbers",
+			msg:        &testproto.Profile{},
+			want:       []string{},
+			wantStrict: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PathsFromFieldNumbers(tt.msg, tt.numbers...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PathsFromFieldNumbers() = %v, want %v", got, tt.want)
+			}
+			got, err := PathsFromFieldNumbersStrict(tt.msg, tt.numbers...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("PathsFromFieldNumbersStrict() error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantStrict) {
+				t.Errorf("PathsFromFieldNumbersStrict() = %v, want %v", got, tt.wantStrict)
+			}
+		})
+	}
+}
+
+func TestDynamicMessage(t *testing.T) {
+	profile := &testproto.Profile{
+		User:  &testproto.User{UserId: 1, Name: "name"},
+		Photo: &testproto.Photo{Path: "path", Dimensions: &testproto.Dimensions{Width: 100}},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 2, Path: "gallery path"},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "v1", "t2": "v2"}},
+		},
+	}
+	// toDynamic converts the msg into a dynamicpb message of the same type.
+	toDynamic := func(msg proto.Message) *dynamicpb.Message {
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dyn := dynamicpb.NewMessage(msg.ProtoReflect().Descriptor())
+		if err := proto.Unmarshal(b, dyn); err != nil {
+			t.Fatal(err)
+		}
+		return dyn
+	}
+	tests := []struct {
+		name string
+		fn   func(msg proto.Message)
+		want proto.Message
+	}{
+		{
+			name: "Filter",
+			fn:   func(msg proto.Message) { Filter(msg, []string{"user.name", "gallery.path", "attributes.a1.tags.t1"}) },
+			want: &testproto.Profile{
+				User:    &testproto.User{Name: "name"},
+				Gallery: []*testproto.Photo{{Path: "gallery path"}},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "v1"}},
+				},
+			},
+		},
+		{
+			name: "Prune",
+			fn: func(msg proto.Message) {
+				Prune(msg, []string{"user.name", "photo.dimensions", "gallery", "attributes"})
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{Path: "path"},
+			},
+		},
+		{
+			name: "Overwrite",
+			fn: func(msg proto.Message) {
+				src := toDynamic(&testproto.Profile{
+					User:    &testproto.User{Name: "src name"},
+					Gallery: []*testproto.Photo{{Path: "src path"}},
+				})
+				Overwrite(src, msg, []string{"user.name", "photo.dimensions", "gallery"})
+			},
+			want: &testproto.Profile{
+				User:    &testproto.User{UserId: 1, Name: "src name"},
+				Photo:   &testproto.Photo{Path: "path"},
+				Gallery: []*testproto.Photo{{Path: "src path"}},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "v1", "t2": "v2"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := toDynamic(profile)
+			tt.fn(msg)
+			if want := toDynamic(tt.want); !proto.Equal(msg, want) {
+				t.Errorf("msg %v, want %v", msg, want)
+			}
+		})
+	}
+}
+
+func TestEmptyPaths(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:            &testproto.User{UserId: 1, Name: "name"},
+			Photo:           &testproto.Photo{Path: "path"},
+			LoginTimestamps: []int64{1, 2},
+			Attributes: map[string]*testproto.Attribute{
+				"a1": {Tags: map[string]string{"t1": "v1"}},
+			},
+		}
+	}
+	for _, paths := range [][]string{{""}, {"", ""}} {
+		tests := []struct {
+			name string
+			fn   func(msg proto.Message) error
+		}{
+			{
+				name: "Filter",
+				fn:   func(msg proto.Message) error { Filter(msg, paths); return nil },
+			},
+			{
+				name: "FilterE",
+				fn:   func(msg proto.Message) error { return FilterE(msg, paths) },
+			},
+			{
+				name: "Prune",
+				fn:   func(msg proto.Message) error { Prune(msg, paths); return nil },
+			},
+			{
+				name: "PruneE",
+				fn:   func(msg proto.Message) error { return PruneE(msg, paths) },
+			},
+			{
+				name: "Overwrite",
+				fn:   func(msg proto.Message) error { Overwrite(&testproto.Profile{}, msg, paths); return nil },
+			},
+			{
+				name: "Validate",
+				fn:   func(msg proto.Message) error { return Validate(msg, paths) },
+			},
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s %q", tt.name, paths), func(t *testing.T) {
+				msg := newProfile()
+				if err := tt.fn(msg); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if want := newProfile(); !proto.Equal(msg, want) {
+					t.Errorf("msg %v, want %v", msg, want)
+				}
+			})
+		}
+	}
+}
+
+func TestNilMessage(t *testing.T) {
+	paths := []string{"user.name", "photo", "attributes.a1"}
+	var typedNil *testproto.Profile
+	tests := []struct {
+		name string
+		fn   func(msg proto.Message)
+	}{
+		{
+			name: "Filter",
+			fn:   func(msg proto.Message) { Filter(msg, paths) },
+		},
+		{
+			name: "FilterFunc",
+			fn: func(msg proto.Message) {
+				NestedMaskFromPaths(paths).FilterFunc(msg, func(string, protoreflect.FieldDescriptor) {
+					t.Error("unexpected onClear call")
+				})
+			},
+		},
+		{
+			name: "Prune",
+			fn:   func(msg proto.Message) { Prune(msg, paths) },
+		},
+		{
+			name: "PruneFunc",
+			fn: func(msg proto.Message) {
+				NestedMaskFromPaths(paths).PruneFunc(msg, func(string, protoreflect.FieldDescriptor) {
+					t.Error("unexpected onClear call")
+				})
+			},
+		},
+		{
+			name: "Overwrite nil dest",
+			fn: func(msg proto.Message) {
+				Overwrite(&testproto.Profile{User: &testproto.User{Name: "name"}}, msg, paths)
+			},
+		},
+		{
+			name: "Overwrite nil src",
+			fn: func(msg proto.Message) {
+				dest := &testproto.Profile{User: &testproto.User{Name: "name"}}
+				Overwrite(msg, dest, paths)
+				if dest.GetUser().GetName() != "name" {
+					t.Errorf("dest was modified: %v", dest)
+				}
+			},
+		},
+		{
+			name: "FilterToSchema",
+			fn:   func(msg proto.Message) { FilterToSchema(msg, &testproto.ProfileV1{}) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" typed nil", func(t *testing.T) {
+			tt.fn(typedNil)
+		})
+		t.Run(tt.name+" nil", func(t *testing.T) {
+			tt.fn(nil)
+		})
+	}
+}
+
+func TestFilterPrune_scalarListSubmask(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:            &testproto.User{UserId: 1},
+			LoginTimestamps: []int64{1, 2},
+		}
+	}
+	paths := []string{"login_timestamps.foo"}
+
+	msg := newProfile()
+	Filter(msg, paths)
+	if want := (&testproto.Profile{LoginTimestamps: []int64{1, 2}}); !proto.Equal(msg, want) {
+		t.Errorf("Filter() msg %v, want %v", msg, want)
+	}
+
+	msg = newProfile()
+	FilterWithOptions(msg, paths, FilterOptions{DropEmptyElements: true})
+	if want := (&testproto.Profile{LoginTimestamps: []int64{1, 2}}); !proto.Equal(msg, want) {
+		t.Errorf("FilterWithOptions() msg %v, want %v", msg, want)
+	}
+
+	msg = newProfile()
+	Prune(msg, paths)
+	if want := newProfile(); !proto.Equal(msg, want) {
+		t.Errorf("Prune() msg %v, want %v", msg, want)
+	}
+
+	msg = newProfile()
+	if err := FilterE(msg, paths); err == nil {
+		t.Error("FilterE() error is nil, want an invalid path error")
+	}
+	if want := newProfile(); !proto.Equal(msg, want) {
+		t.Errorf("FilterE() msg %v, want %v", msg, want)
+	}
+}
+
+func TestOverwriteWithOptions_preserveUnknown(t *testing.T) {
+	unknown := protowire.AppendTag(nil, 100, protowire.VarintType)
+	unknown = protowire.AppendVarint(unknown, 42)
+	withUnknown := func(m proto.Message) proto.Message {
+		m.ProtoReflect().SetUnknown(unknown)
+		return m
+	}
+	newSrc := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:    withUnknown(&testproto.User{UserId: 1, Name: "src name"}).(*testproto.User),
+			Photo:   withUnknown(&testproto.Photo{Path: "src path"}).(*testproto.Photo),
+			Gallery: []*testproto.Photo{withUnknown(&testproto.Photo{PhotoId: 2}).(*testproto.Photo)},
+			Attributes: map[string]*testproto.Attribute{
+				"a1": withUnknown(&testproto.Attribute{Tags: map[string]string{"t1": "1"}}).(*testproto.Attribute),
+			},
+		}
+	}
+	paths := []string{"user.name", "photo", "gallery.photo_id", "attributes.a1.tags"}
+
+	dest := &testproto.Profile{User: &testproto.User{UserId: 3}}
+	OverwriteWithOptions(newSrc(), dest, paths, OverwriteOptions{PreserveUnknown: true})
+	want := &testproto.Profile{
+		User:    withUnknown(&testproto.User{UserId: 3, Name: "src name"}).(*testproto.User),
+		Photo:   withUnknown(&testproto.Photo{Path: "src path"}).(*testproto.Photo),
+		Gallery: []*testproto.Photo{withUnknown(&testproto.Photo{PhotoId: 2}).(*testproto.Photo)},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": withUnknown(&testproto.Attribute{Tags: map[string]string{"t1": "1"}}).(*testproto.Attribute),
+		},
+	}
+	if !proto.Equal(dest, want) {
+		t.Errorf("dest %v, want %v", dest, want)
+	}
+
+	dest = &testproto.Profile{User: &testproto.User{UserId: 3}}
+	OverwriteWithOptions(newSrc(), dest, paths, OverwriteOptions{})
+	want = &testproto.Profile{
+		User:    &testproto.User{UserId: 3, Name: "src name"},
+		Photo:   withUnknown(&testproto.Photo{Path: "src path"}).(*testproto.Photo),
+		Gallery: []*testproto.Photo{{PhotoId: 2}},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "1"}},
+		},
+	}
+	if !proto.Equal(dest, want) {
+		t.Errorf("dest without PreserveUnknown %v, want %v", dest, want)
+	}
+}
+
+func TestFilter_listIndexes(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:            &testproto.User{UserId: 1},
+			LoginTimestamps: []int64{1, 2, 3},
+			Gallery: []*testproto.Photo{
+				{PhotoId: 1, Path: "path 1", Dimensions: &testproto.Dimensions{Width: 10}},
+				{PhotoId: 2, Path: "path 2", Dimensions: &testproto.Dimensions{Width: 20}},
+				{PhotoId: 3, Path: "path 3"},
+			},
+		}
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		opts  FilterOptions
+		want  *testproto.Profile
+	}{
+		{
+			name:  "different sub-masks per element",
+			paths: []string{"gallery[0].path", "gallery[1].photo_id"},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{Path: "path 1"},
+					{PhotoId: 2},
+				},
+			},
+		},
+		{
+			name:  "indexed sub-masks are merged with the sub-mask for all elements",
+			paths: []string{"gallery.path", "gallery[0].photo_id", "gallery[1].dimensions.width"},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1, Path: "path 1"},
+					{Path: "path 2", Dimensions: &testproto.Dimensions{Width: 20}},
+					{Path: "path 3"},
+				},
+			},
+		},
+		{
+			name:  "index without a sub-mask keeps the entire element",
+			paths: []string{"gallery.path", "gallery[1]"},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{Path: "path 1"},
+					{PhotoId: 2, Path: "path 2", Dimensions: &testproto.Dimensions{Width: 20}},
+					{Path: "path 3"},
+				},
+			},
+		},
+		{
+			name:  "entire list wins over indexes",
+			paths: []string{"gallery", "gallery[0].path"},
+			want:  &testproto.Profile{Gallery: newProfile().Gallery},
+		},
+		{
+			name:  "out of range index",
+			paths: []string{"gallery[5]", "user"},
+			want:  &testproto.Profile{User: &testproto.User{UserId: 1}},
+		},
+		{
+			name:  "scalar list indexes",
+			paths: []string{"login_timestamps[0]", "login_timestamps[2]"},
+			want:  &testproto.Profile{LoginTimestamps: []int64{1, 3}},
+		},
+		{
+			name:  "drop empty elements",
+			paths: []string{"gallery.dimensions", "gallery[0].path"},
+			opts:  FilterOptions{DropEmptyElements: true},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{Path: "path 1", Dimensions: &testproto.Dimensions{Width: 10}},
+					{Dimensions: &testproto.Dimensions{Width: 20}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newProfile()
+			FilterWithOptions(msg, tt.paths, tt.opts)
+			if !proto.Equal(msg, tt.want) {
+				t.Errorf("msg %v, want %v", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterFunc_listIndexes(t *testing.T) {
+	msg := &testproto.Profile{
+		Gallery: []*testproto.Photo{{PhotoId: 1, Path: "path 1"}, {PhotoId: 2}, {PhotoId: 3}},
+	}
+	var cleared []string
+	NestedMaskFromPaths([]string{"gallery[1]", "gallery[0].path"}).FilterFunc(msg, func(path string, _ protoreflect.FieldDescriptor) {
+		cleared = append(cleared, path)
+	})
+	if want := []string{"gallery.photo_id", "gallery[2]"}; !reflect.DeepEqual(cleared, want) {
+		t.Errorf("cleared %v, want %v", cleared, want)
+	}
+	want := &testproto.Profile{Gallery: []*testproto.Photo{{Path: "path 1"}, {PhotoId: 2}}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
+
+func TestFilterPrune_selfReferentialMessage(t *testing.T) {
+	newTree := func() *testproto.Node {
+		return &testproto.Node{
+			Name: "root",
+			Next: &testproto.Node{Name: "next", Next: &testproto.Node{Name: "next next"}},
+			Children: []*testproto.Node{
+				{Name: "child 1", Children: []*testproto.Node{{Name: "grandchild 1"}, {Name: "grandchild 2"}}},
+				{Name: "child 2", Next: &testproto.Node{Name: "child 2 next"}},
+			},
+		}
+	}
+
+	msg := newTree()
+	Filter(msg, []string{"children.children.name", "next.next"})
+	want := &testproto.Node{
+		Next: &testproto.Node{Next: &testproto.Node{Name: "next next"}},
+		Children: []*testproto.Node{
+			{Children: []*testproto.Node{{Name: "grandchild 1"}, {Name: "grandchild 2"}}},
+			{},
+		},
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("Filter() msg %v, want %v", msg, want)
+	}
+
+	msg = newTree()
+	Prune(msg, []string{"children.children.name", "next.next"})
+	want = newTree()
+	want.Next.Next = nil
+	want.Children[0].Children = []*testproto.Node{{}, {}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("Prune() msg %v, want %v", msg, want)
+	}
+
+	// The mask depth bounds the traversal even if the message references itself.
+	cyclic := &testproto.Node{Name: "cyclic"}
+	cyclic.Next = cyclic
+	Prune(cyclic, []string{"next.next.next.name"})
+	if cyclic.Name != "" || cyclic.Next != cyclic {
+		t.Errorf("Prune() msg name %q, want the name cleared and the cycle kept", cyclic.Name)
+	}
+}
+
+func TestOverwriteFunc(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		src   proto.Message
+		dest  proto.Message
+		want  map[string]bool
+	}{
+		{
+			name:  "set and cleared fields",
+			paths: []string{"user.name", "user.user_id", "photo", "login_timestamps"},
+			src: &testproto.Profile{
+				User:            &testproto.User{UserId: 1, Name: "src name"},
+				LoginTimestamps: []int64{1, 2},
+			},
+			dest: &testproto.Profile{
+				User:            &testproto.User{UserId: 1, Name: "dest name"},
+				Photo:           &testproto.Photo{PhotoId: 2},
+				LoginTimestamps: []int64{1, 2},
+			},
+			want: map[string]bool{"user.name": false, "photo": true},
+		},
+		{
+			name:  "map entries",
+			paths: []string{"attributes.a1", "attributes.a2", "attributes.a3.tags.t1", "attributes.a4"},
+			src: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a3": {Tags: map[string]string{"t1": "3"}},
+					"a4": {Tags: map[string]string{"t1": "4"}},
+				},
+			},
+			dest: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a2": {Tags: map[string]string{"t1": "2"}},
+					"a4": {Tags: map[string]string{"t1": "4"}},
+				},
+			},
+			want: map[string]bool{"attributes.a1": false, "attributes.a2": true, "attributes.a3.tags.t1": false},
+		},
+		{
+			name:  "list elements",
+			paths: []string{"gallery.path", "login_timestamps[1]"},
+			src: &testproto.Profile{
+				Gallery:         []*testproto.Photo{{Path: "path 1"}, {Path: "src path 2"}},
+				LoginTimestamps: []int64{1, 5},
+			},
+			dest: &testproto.Profile{
+				Gallery:         []*testproto.Photo{{Path: "path 1"}, {Path: "dest path 2"}, {Path: "path 3"}},
+				LoginTimestamps: []int64{1, 2},
+			},
+			want: map[string]bool{"gallery[1].path": false, "gallery[2]": true, "login_timestamps[1]": false},
+		},
+		{
+			name:  "oneof",
+			paths: []string{"changed", "event_id"},
+			src:   &testproto.Event{EventId: 1},
+			dest:  &testproto.Event{EventId: 1, Changed: &testproto.Event_Status{Status: testproto.Status_OK}},
+			want:  map[string]bool{"status": true},
+		},
+		{
+			name:  "nothing changed",
+			paths: []string{"user", "photo.path"},
+			src:   &testproto.Profile{User: &testproto.User{UserId: 1}, Photo: &testproto.Photo{Path: "path"}},
+			dest:  &testproto.Profile{User: &testproto.User{UserId: 1}, Photo: &testproto.Photo{Path: "path"}},
+			want:  map[string]bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := proto.Clone(tt.dest)
+			Overwrite(tt.src, want, tt.paths)
+			got := make(map[string]bool)
+			OverwriteFunc(tt.src, tt.dest, tt.paths, func(path string, cleared bool) {
+				got[path] = cleared
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes %v, want %v", got, tt.want)
+			}
+			if !proto.Equal(tt.dest, want) {
+				t.Errorf("dest %v, want %v", tt.dest, want)
+			}
+		})
+	}
+}
+
+func TestOverwriteFunc_typeMismatch(t *testing.T) {
+	defer func() {
+		err, ok := recover().(error)
+		if !ok {
+			t.Fatal("OverwriteFunc() did not panic with an error on mismatched types")
+		}
+		if want := "fmutils: cannot overwrite testproto.Photo with testproto.Profile: message types differ"; err.Error() != want {
+			t.Errorf("panic %q, want %q", err, want)
+		}
+	}()
+	OverwriteFunc(&testproto.Profile{User: &testproto.User{UserId: 1}}, &testproto.Photo{}, []string{"user"},
+		func(string, bool) {})
+}
+
+func TestOverwrite_floats(t *testing.T) {
+	negZero := math.Copysign(0, -1)
+	tests := []struct {
+		name string
+		src  float64
+	}{
+		{name: "NaN", src: math.NaN()},
+		{name: "positive infinity", src: math.Inf(1)},
+		{name: "negative infinity", src: math.Inf(-1)},
+		{name: "negative zero", src: negZero},
+		{name: "zero", src: 0},
+	}
+	sameFloat := func(a, b float64) bool {
+		return math.IsNaN(a) && math.IsNaN(b) || a == b && math.Signbit(a) == math.Signbit(b)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &testproto.Measurement{Value: tt.src, Ratio: float32(tt.src), OptionalValue: proto.Float64(tt.src)}
+			dest := &testproto.Measurement{Value: 5, Ratio: 5, OptionalValue: proto.Float64(5)}
+			paths := []string{"value", "ratio", "optional_value"}
+			var changes []string
+			OverwriteFunc(src, dest, paths, func(path string, _ bool) {
+				changes = append(changes, path)
+			})
+			if !sameFloat(dest.Value, tt.src) || !sameFloat(float64(dest.Ratio), tt.src) || !sameFloat(dest.GetOptionalValue(), tt.src) {
+				t.Errorf("dest %v, want all the fields set to %v", dest, tt.src)
+			}
+			if dest.OptionalValue == nil {
+				t.Error("optional_value is cleared, want it set")
+			}
+			if len(changes) != len(paths) {
+				t.Errorf("changes %v, want %v", changes, paths)
+			}
+
+			// Overwriting the same values again is not a change.
+			changes = nil
+			OverwriteFunc(src, dest, paths, func(path string, _ bool) {
+				changes = append(changes, path)
+			})
+			if len(changes) != 0 {
+				t.Errorf("repeated overwrite changes %v, want none", changes)
+			}
+		})
+	}
+
+	// Both 0.0 and -0.0 are kept when written to an optional field, but only -0.0 has presence in a proto3 field.
+	dest := &testproto.Measurement{Value: 5, OptionalValue: proto.Float64(5)}
+	Overwrite(&testproto.Measurement{OptionalValue: proto.Float64(0)}, dest, []string{"value", "optional_value"})
+	want := &testproto.Measurement{OptionalValue: proto.Float64(0)}
+	if !proto.Equal(dest, want) {
+		t.Errorf("dest %v, want %v", dest, want)
+	}
+	dest.Value = 5
+	Overwrite(&testproto.Measurement{Value: negZero}, dest, []string{"value"})
+	if !dest.ProtoReflect().Has(dest.ProtoReflect().Descriptor().Fields().ByName("value")) || !math.Signbit(dest.Value) {
+		t.Errorf("value %v, want -0 to be set", dest.Value)
+	}
+}
+
+func TestMergeFiltered(t *testing.T) {
+	profile := &testproto.Profile{
+		User: &testproto.User{UserId: 64, Name: "user name"},
+		Photo: &testproto.Photo{
+			PhotoId:    2,
+			Path:       "photo path",
+			Dimensions: &testproto.Dimensions{Width: 100, Height: 120},
+		},
+		LoginTimestamps: []int64{1, 2, 3},
+	}
+	req := &testproto.Profile{
+		User: &testproto.User{UserId: 65, Name: "new user name"},
+		Photo: &testproto.Photo{
+			PhotoId:    3,
+			Path:       "new photo path",
+			Dimensions: &testproto.Dimensions{Width: 50},
+		},
+		LoginTimestamps: []int64{4, 5},
+	}
+	reqCopy := proto.Clone(req)
+
+	MergeFiltered(profile, req, []string{"user.name", "photo.path", "photo.dimensions.width", "login_timestamps"})
+	want := &testproto.Profile{
+		User: &testproto.User{UserId: 64, Name: "new user name"},
+		Photo: &testproto.Photo{
+			PhotoId:    2,
+			Path:       "new photo path",
+			Dimensions: &testproto.Dimensions{Width: 50, Height: 120},
+		},
+		LoginTimestamps: []int64{1, 2, 3, 4, 5},
+	}
+	if !proto.Equal(profile, want) {
+		t.Errorf("dst %v, want %v", profile, want)
+	}
+	if !proto.Equal(req, reqCopy) {
+		t.Errorf("src is modified: %v, want %v", req, reqCopy)
+	}
+
+	MergeFiltered(profile, nil, []string{"user"})
+	MergeFiltered(nil, req, []string{"user"})
+	if !proto.Equal(profile, want) {
+		t.Errorf("dst %v, want %v", profile, want)
+	}
+}
+
+func TestFilterPrune_fieldWildcard(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User: &testproto.User{UserId: 1, Name: "name"},
+			Photo: &testproto.Photo{
+				PhotoId:    2,
+				Path:       "path",
+				Dimensions: &testproto.Dimensions{Width: 10, Height: 20},
+			},
+			Gallery: []*testproto.Photo{
+				{PhotoId: 3, Dimensions: &testproto.Dimensions{Width: 30, Height: 40}},
+				{PhotoId: 4},
+			},
+			LoginTimestamps: []int64{1},
+		}
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		prune bool
+		want  *testproto.Profile
+	}{
+		{
+			name:  "filter mid-path wildcard",
+			paths: []string{"*.dimensions.width"},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{Dimensions: &testproto.Dimensions{Width: 10}},
+				Gallery: []*testproto.Photo{
+					{Dimensions: &testproto.Dimensions{Width: 30}},
+					{},
+				},
+			},
+		},
+		{
+			name:  "filter explicit field wins over wildcard",
+			paths: []string{"*.dimensions.width", "photo.path", "user"},
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{Path: "path"},
+				Gallery: []*testproto.Photo{
+					{Dimensions: &testproto.Dimensions{Width: 30}},
+					{},
+				},
+			},
+		},
+		{
+			name:  "filter trailing wildcard",
+			paths: []string{"photo.*", "user.*"},
+			want: &testproto.Profile{
+				User: &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{
+					PhotoId:    2,
+					Path:       "path",
+					Dimensions: &testproto.Dimensions{Width: 10, Height: 20},
+				},
+			},
+		},
+		{
+			name:  "prune mid-path wildcard",
+			paths: []string{"*.dimensions"},
+			prune: true,
+			want: &testproto.Profile{
+				User:            &testproto.User{UserId: 1, Name: "name"},
+				Photo:           &testproto.Photo{PhotoId: 2, Path: "path"},
+				Gallery:         []*testproto.Photo{{PhotoId: 3}, {PhotoId: 4}},
+				LoginTimestamps: []int64{1},
+			},
+		},
+		{
+			name:  "prune nested wildcards",
+			paths: []string{"*.*.height"},
+			prune: true,
+			want: &testproto.Profile{
+				User: &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{
+					PhotoId:    2,
+					Path:       "path",
+					Dimensions: &testproto.Dimensions{Width: 10},
+				},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 3, Dimensions: &testproto.Dimensions{Width: 30}},
+					{PhotoId: 4},
+				},
+				LoginTimestamps: []int64{1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newProfile()
+			if tt.prune {
+				Prune(msg, tt.paths)
+			} else {
+				Filter(msg, tt.paths)
+			}
+			if !proto.Equal(msg, tt.want) {
+				t.Errorf("msg %v, want %v", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterPrune_optionalEnum(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		prune bool
+		msg   *testproto.Options
+		want  *testproto.Options
+	}{
+		{
+			name:  "filter keeps listed zero enum",
+			paths: []string{"optional_status"},
+			msg: &testproto.Options{
+				OptionalStatus: testproto.Status_UNKNOWN.Enum(),
+				OptionalInt:    proto.Int64(1),
+			},
+			want: &testproto.Options{OptionalStatus: testproto.Status_UNKNOWN.Enum()},
+		},
+		{
+			name:  "filter clears unlisted zero enum",
+			paths: []string{"optional_int"},
+			msg: &testproto.Options{
+				OptionalStatus: testproto.Status_UNKNOWN.Enum(),
+				OptionalInt:    proto.Int64(1),
+			},
+			want: &testproto.Options{OptionalInt: proto.Int64(1)},
+		},
+		{
+			name:  "filter keeps unset enum unset",
+			paths: []string{"optional_status"},
+			msg:   &testproto.Options{OptionalInt: proto.Int64(1)},
+			want:  &testproto.Options{},
+		},
+		{
+			name:  "prune removes zero enum presence",
+			paths: []string{"optional_status"},
+			prune: true,
+			msg: &testproto.Options{
+				OptionalStatus: testproto.Status_UNKNOWN.Enum(),
+				OptionalInt:    proto.Int64(0),
+			},
+			want: &testproto.Options{OptionalInt: proto.Int64(0)},
+		},
+		{
+			name:  "prune keeps unlisted zero enum",
+			paths: []string{"optional_int"},
+			prune: true,
+			msg: &testproto.Options{
+				OptionalStatus: testproto.Status_UNKNOWN.Enum(),
+				OptionalInt:    proto.Int64(0),
+			},
+			want: &testproto.Options{OptionalStatus: testproto.Status_UNKNOWN.Enum()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prune {
+				Prune(tt.msg, tt.paths)
+			} else {
+				Filter(tt.msg, tt.paths)
+			}
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+			if got, want := tt.msg.OptionalStatus != nil, tt.want.OptionalStatus != nil; got != want {
+				t.Errorf("optional_status presence %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFilterKeeping(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:            &testproto.User{UserId: 1, Name: "name"},
+			Photo:           &testproto.Photo{PhotoId: 2, Path: "path"},
+			LoginTimestamps: []int64{1},
+		}
+	}
+	alwaysKeep := []string{"user.user_id", "photo.photo_id"}
+	tests := []struct {
+		name  string
+		paths []string
+		want  *testproto.Profile
+	}{
+		{
+			name:  "client mask omits always kept fields",
+			paths: []string{"user.name", "login_timestamps"},
+			want: &testproto.Profile{
+				User:            &testproto.User{UserId: 1, Name: "name"},
+				Photo:           &testproto.Photo{PhotoId: 2},
+				LoginTimestamps: []int64{1},
+			},
+		},
+		{
+			name:  "client mask covers always kept fields",
+			paths: []string{"user", "photo.path"},
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path"},
+			},
+		},
+		{
+			name:  "empty client mask keeps everything",
+			paths: []string{},
+			want:  newProfile(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newProfile()
+			FilterKeeping(msg, tt.paths, alwaysKeep)
+			if !proto.Equal(msg, tt.want) {
+				t.Errorf("msg %v, want %v", msg, tt.want)
+			}
+		})
+	}
+}
+func TestFilterEach(t *testing.T) {
+	msgs := []proto.Message{
+		&testproto.Photo{PhotoId: 1, Path: "path 1", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+		&testproto.Photo{PhotoId: 2, Path: "path 2"},
+		nil,
+	}
+	FilterEach(msgs, []string{"path", "dimensions.width"})
+	want := []proto.Message{
+		&testproto.Photo{Path: "path 1", Dimensions: &testproto.Dimensions{Width: 10}},
+		&testproto.Photo{Path: "path 2"},
+	}
+	for i, w := range want {
+		if !proto.Equal(msgs[i], w) {
+			t.Errorf("msgs[%d] %v, want %v", i, msgs[i], w)
+		}
+	}
+}
+
+func TestNestedMask_FilterRepeated(t *testing.T) {
+	profile := &testproto.Profile{
+		LoginTimestamps: []int64{1, 2},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 1, Path: "path 1", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+			{PhotoId: 2, Path: "path 2"},
+		},
+	}
+	rft := profile.ProtoReflect()
+	fields := rft.Descriptor().Fields()
+
+	NestedMaskFromPaths([]string{"photo_id", "dimensions.height"}).FilterRepeated(rft.Get(fields.ByName("gallery")).List())
+	NestedMaskFromPaths([]string{"photo_id"}).FilterRepeated(rft.Get(fields.ByName("login_timestamps")).List())
+
+	want := &testproto.Profile{
+		LoginTimestamps: []int64{1, 2},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 1, Dimensions: &testproto.Dimensions{Height: 20}},
+			{PhotoId: 2},
+		},
+	}
+	if !proto.Equal(profile, want) {
+		t.Errorf("profile %v, want %v", profile, want)
+	}
+
+	// Filtering the list directly is the same as filtering its parent with the prefixed paths.
+	viaParent := &testproto.Profile{Gallery: []*testproto.Photo{{PhotoId: 1, Path: "path 1"}}}
+	viaList := proto.Clone(viaParent).(*testproto.Profile)
+	Filter(viaParent, []string{"gallery.path"})
+	NestedMaskFromPaths([]string{"path"}).FilterRepeated(viaList.ProtoReflect().Get(fields.ByName("gallery")).List())
+	if !proto.Equal(viaParent, viaList) {
+		t.Errorf("filtered list %v, want %v", viaList, viaParent)
+	}
+}
+
+func TestFilterPrune_deeplyNestedMaps(t *testing.T) {
+	newCatalog := func() *testproto.Catalog {
+		return &testproto.Catalog{
+			Sections: map[string]*testproto.Section{
+				"s1": {
+					Title: "section 1",
+					Shelves: map[string]*testproto.Shelf{
+						"sh1": {
+							Label: "shelf 1",
+							Items: map[string]*testproto.Attribute{
+								"i1": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+								"i2": {Tags: map[string]string{"t1": "3"}},
+							},
+						},
+						"sh2": {Label: "shelf 2"},
+					},
+				},
+				"s2": {Title: "section 2"},
+			},
+		}
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		prune bool
+		want  *testproto.Catalog
+	}{
+		{
+			name:  "filter leaf three map levels deep",
+			paths: []string{"sections.s1.shelves.sh1.items.i1.tags.t2"},
+			want: &testproto.Catalog{
+				Sections: map[string]*testproto.Section{
+					"s1": {
+						Shelves: map[string]*testproto.Shelf{
+							"sh1": {
+								Items: map[string]*testproto.Attribute{
+									"i1": {Tags: map[string]string{"t2": "2"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "filter with wildcards on every map level",
+			paths: []string{"sections.*.shelves.*.items.*.tags.t1", "sections.s2"},
+			want: &testproto.Catalog{
+				Sections: map[string]*testproto.Section{
+					"s1": {
+						Shelves: map[string]*testproto.Shelf{
+							"sh1": {
+								Items: map[string]*testproto.Attribute{
+									"i1": {Tags: map[string]string{"t1": "1"}},
+									"i2": {Tags: map[string]string{"t1": "3"}},
+								},
+							},
+							"sh2": {},
+						},
+					},
+					"s2": {Title: "section 2"},
+				},
+			},
+		},
+		{
+			name:  "prune leaf three map levels deep",
+			paths: []string{"sections.s1.shelves.sh1.items.i1.tags.t2", "sections.s1.shelves.sh1.items.i2"},
+			prune: true,
+			want: func() *testproto.Catalog {
+				c := newCatalog()
+				items := c.Sections["s1"].Shelves["sh1"].Items
+				delete(items["i1"].Tags, "t2")
+				delete(items, "i2")
+				return c
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newCatalog()
+			if tt.prune {
+				Prune(msg, tt.paths)
+			} else {
+				Filter(msg, tt.paths)
+			}
+			if !proto.Equal(msg, tt.want) {
+				t.Errorf("msg %v, want %v", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterPrune_extensions(t *testing.T) {
+	newAccount := func() *testproto.Account {
+		account := &testproto.Account{
+			Id:    proto.Int64(1),
+			Owner: &testproto.Owner{Email: proto.String("owner@example.com")},
+		}
+		proto.SetExtension(account, testproto.E_Auditor, &testproto.Owner{
+			Email: proto.String("auditor@example.com"),
+			Name:  proto.String("auditor"),
+		})
+		proto.SetExtension(account, testproto.E_Note, "note")
+		return account
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		prune bool
+		want  func() *testproto.Account
+	}{
+		{
+			name:  "filter extension sub-field",
+			paths: []string{"id", "[testproto.auditor].email"},
+			want: func() *testproto.Account {
+				account := &testproto.Account{Id: proto.Int64(1)}
+				proto.SetExtension(account, testproto.E_Auditor, &testproto.Owner{Email: proto.String("auditor@example.com")})
+				return account
+			},
+		},
+		{
+			name:  "filter whole extensions",
+			paths: []string{"[testproto.note]", "[testproto.auditor]"},
+			want: func() *testproto.Account {
+				account := newAccount()
+				account.Id = nil
+				account.Owner = nil
+				return account
+			},
+		},
+		{
+			name:  "prune extension sub-field",
+			paths: []string{"[testproto.auditor].name"},
+			prune: true,
+			want: func() *testproto.Account {
+				account := newAccount()
+				proto.SetExtension(account, testproto.E_Auditor, &testproto.Owner{Email: proto.String("auditor@example.com")})
+				return account
+			},
+		},
+		{
+			name:  "prune whole extension",
+			paths: []string{"[testproto.auditor]", "owner"},
+			prune: true,
+			want: func() *testproto.Account {
+				account := &testproto.Account{Id: proto.Int64(1)}
+				proto.SetExtension(account, testproto.E_Note, "note")
+				return account
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newAccount()
+			if tt.prune {
+				Prune(msg, tt.paths)
+			} else {
+				Filter(msg, tt.paths)
+			}
+			if want := tt.want(); !proto.Equal(msg, want) {
+				t.Errorf("msg %v, want %v", msg, want)
+			}
+		})
+	}
+
+	msg := newAccount()
+	Prune(msg, []string{"[testproto.auditor]"})
+	if proto.HasExtension(msg, testproto.E_Auditor) {
+		t.Error("pruned extension is still present")
+	}
+}
+
+func TestOverwrite_extensions(t *testing.T) {
+	newAccount := func(note, auditorEmail, auditorName string) *testproto.Account {
+		account := &testproto.Account{Id: proto.Int64(1)}
+		if note != "" {
+			proto.SetExtension(account, testproto.E_Note, note)
+		}
+		if auditorEmail != "" {
+			proto.SetExtension(account, testproto.E_Auditor, &testproto.Owner{
+				Email: proto.String(auditorEmail),
+				Name:  proto.String(auditorName),
+			})
+		}
+		return account
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		src   *testproto.Account
+		dest  *testproto.Account
+		want  *testproto.Account
+	}{
+		{
+			name:  "extension and extension sub-field",
+			paths: []string{"[testproto.note]", "[testproto.auditor].name"},
+			src:   newAccount("src note", "src@example.com", "src auditor"),
+			dest:  newAccount("dest note", "dest@example.com", "dest auditor"),
+			want:  newAccount("src note", "dest@example.com", "src auditor"),
+		},
+		{
+			name:  "extension missing in src is cleared",
+			paths: []string{"[testproto.note]"},
+			src:   newAccount("", "", ""),
+			dest:  newAccount("dest note", "dest@example.com", "dest auditor"),
+			want:  newAccount("", "dest@example.com", "dest auditor"),
+		},
+		{
+			name:  "wildcard matches extensions",
+			paths: []string{"*"},
+			src:   newAccount("", "src@example.com", "src auditor"),
+			dest:  newAccount("dest note", "", ""),
+			want:  newAccount("", "src@example.com", "src auditor"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Overwrite(tt.src, tt.dest, tt.paths)
+			if !proto.Equal(tt.dest, tt.want) {
 				t.Errorf("dest %v, want %v", tt.dest, tt.want)
 			}
 		})
 	}
 }
 
+func TestValidate_extensions(t *testing.T) {
+	if err := Validate(&testproto.Account{}, []string{"[testproto.auditor].email", "[testproto.note]"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Validate(&testproto.Account{}, []string{"[testproto.auditor].foo"}); err == nil ||
+		!strings.Contains(err.Error(), `message testproto.Owner has no field "foo"`) {
+		t.Errorf("error %v, want an unknown field error", err)
+	}
+	if err := Validate(&testproto.Account{}, []string{"[testproto.unknown]"}); err == nil ||
+		!strings.Contains(err.Error(), `message testproto.Account has no field "[testproto.unknown]"`) {
+		t.Errorf("error %v, want an unknown extension error", err)
+	}
+	if err := Validate(&testproto.Owner{}, []string{"[testproto.note]"}); err == nil {
+		t.Error("Validate() error is nil, want an error for an extension of another message")
+	}
+	want := NestedMask{"[testproto.auditor]": NestedMask{"email": NestedMask{}}, "id": NestedMask{}}
+	if got := NestedMaskFromPaths([]string{"id", "[testproto.auditor].email"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("NestedMaskFromPaths() = %v, want %v", got, want)
+	}
+}
+
 func BenchmarkNestedMaskFromPaths(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		NestedMaskFromPaths([]string{"aaa.bbb.c.d.e.f", "aa.b.cc.ddddddd", "e", "f", "g.h.i.j.k"})
 	}
 }
+
+func BenchmarkNestedMaskFromPaths_wide(b *testing.B) {
+	var paths []string
+	for i := 0; i < 150; i++ {
+		paths = append(paths, fmt.Sprintf("field_%d.sub_%d.leaf", i%10, i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NestedMaskFromPaths(paths)
+	}
+}
+
+func BenchmarkNestedMaskFromPaths_deep(b *testing.B) {
+	var paths []string
+	for i := 0; i < 100; i++ {
+		paths = append(paths, strings.Repeat("level.", 20)+fmt.Sprintf("gallery[%d].leaf_%d", i%5, i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NestedMaskFromPaths(paths)
+	}
+}
+
+func benchmarkProfile() *testproto.Profile {
+	profile := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+			Name:   "user name",
+		},
+		Photo: &testproto.Photo{
+			PhotoId: 2,
+			Path:    "photo path",
+			Dimensions: &testproto.Dimensions{
+				Width:  100,
+				Height: 120,
+			},
+		},
+		LoginTimestamps: []int64{1, 2, 3, 4, 5},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+			"a2": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+		},
+	}
+	for i := 0; i < 10; i++ {
+		profile.Gallery = append(profile.Gallery, &testproto.Photo{
+			PhotoId: int64(i),
+			Path:    "gallery path",
+			Dimensions: &testproto.Dimensions{
+				Width:  100,
+				Height: 120,
+			},
+		})
+	}
+	return profile
+}
+
+func BenchmarkNestedMask_Filter(b *testing.B) {
+	mask := NestedMaskFromPaths([]string{"user.name", "photo.dimensions.width", "gallery.path", "attributes.a1.tags.t1"})
+	profile := benchmarkProfile()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		msg := proto.Clone(profile)
+		b.StartTimer()
+		mask.Filter(msg)
+	}
+}
+
+func BenchmarkNestedMask_Prune(b *testing.B) {
+	mask := NestedMaskFromPaths([]string{"user.name", "photo.dimensions.width", "gallery.path", "attributes.a1.tags.t1"})
+	profile := benchmarkProfile()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		msg := proto.Clone(profile)
+		b.StartTimer()
+		mask.Prune(msg)
+	}
+}
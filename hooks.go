@@ -0,0 +1,98 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Operation is the name of an operation reported to the Hooks.
+type Operation string
+
+const (
+	// OperationFilter is reported by HookedMask.Filter.
+	OperationFilter Operation = "filter"
+	// OperationPrune is reported by HookedMask.Prune.
+	OperationPrune Operation = "prune"
+	// OperationOverwrite is reported by HookedMask.Overwrite.
+	OperationOverwrite Operation = "overwrite"
+)
+
+// Hooks are the callbacks called around the operations of a HookedMask, e.g. to record tracing spans and metrics.
+//
+// Both callbacks are optional and are called with the full name of the message type the operation is applied to:
+// the dest message type for the overwrites.
+type Hooks struct {
+	// OnStart is called before the operation starts.
+	OnStart func(op Operation, msgType protoreflect.FullName)
+	// OnFinish is called after the operation finishes with the number of the fields, map entries and list elements
+	// it affected: cleared by a filter or a prune, or changed by an overwrite as reported by NestedMask.FilterFunc,
+	// NestedMask.PruneFunc and NestedMask.OverwriteFunc respectively.
+	OnFinish func(op Operation, msgType protoreflect.FullName, affected int)
+}
+
+// HookedMask is a NestedMask that calls the hooks around its operations.
+//
+// It is created by NestedMask.WithHooks.
+type HookedMask struct {
+	mask  NestedMask
+	hooks Hooks
+}
+
+// WithHooks returns the mask that calls the hooks around its Filter, Prune and Overwrite operations.
+//
+// If no hooks are set, the operations work exactly like the NestedMask ones without any overhead. The operations on
+// nil messages do nothing and are not reported.
+func (mask NestedMask) WithHooks(hooks Hooks) HookedMask {
+	return HookedMask{mask: mask, hooks: hooks}
+}
+
+// Filter works like NestedMask.Filter and calls the hooks around it.
+func (m HookedMask) Filter(msg proto.Message) {
+	if isNil(msg) || m.noHooks() {
+		m.mask.Filter(msg)
+		return
+	}
+	m.run(OperationFilter, msg, func(affected *int) {
+		m.mask.FilterFunc(msg, func(string, protoreflect.FieldDescriptor) { *affected++ })
+	})
+}
+
+// Prune works like NestedMask.Prune and calls the hooks around it.
+func (m HookedMask) Prune(msg proto.Message) {
+	if isNil(msg) || m.noHooks() {
+		m.mask.Prune(msg)
+		return
+	}
+	m.run(OperationPrune, msg, func(affected *int) {
+		m.mask.PruneFunc(msg, func(string, protoreflect.FieldDescriptor) { *affected++ })
+	})
+}
+
+// Overwrite works like NestedMask.Overwrite and calls the hooks around it.
+func (m HookedMask) Overwrite(src, dest proto.Message) {
+	if isNil(src) || isNil(dest) || m.noHooks() {
+		m.mask.Overwrite(src, dest)
+		return
+	}
+	m.run(OperationOverwrite, dest, func(affected *int) {
+		m.mask.OverwriteFunc(src, dest, func(string, bool) { *affected++ })
+	})
+}
+
+// noHooks reports whether none of the hooks are set.
+func (m HookedMask) noHooks() bool {
+	return m.hooks.OnStart == nil && m.hooks.OnFinish == nil
+}
+
+// run calls the hooks around the apply function, which counts the affected fields.
+func (m HookedMask) run(op Operation, msg proto.Message, apply func(affected *int)) {
+	msgType := msg.ProtoReflect().Descriptor().FullName()
+	if m.hooks.OnStart != nil {
+		m.hooks.OnStart(op, msgType)
+	}
+	affected := 0
+	apply(&affected)
+	if m.hooks.OnFinish != nil {
+		m.hooks.OnFinish(op, msgType, affected)
+	}
+}
@@ -0,0 +1,103 @@
+package fmutils
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestNestedMask_WithHooks(t *testing.T) {
+	var events []string
+	hooks := Hooks{
+		OnStart: func(op Operation, msgType protoreflect.FullName) {
+			events = append(events, fmt.Sprintf("start %s %s", op, msgType))
+		},
+		OnFinish: func(op Operation, msgType protoreflect.FullName, affected int) {
+			events = append(events, fmt.Sprintf("finish %s %s %d", op, msgType, affected))
+		},
+	}
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:            &testproto.User{UserId: 1, Name: "name"},
+			Photo:           &testproto.Photo{Path: "path"},
+			LoginTimestamps: []int64{1},
+		}
+	}
+	mask := NestedMaskFromPaths([]string{"user.name", "photo"}).WithHooks(hooks)
+
+	msg := newProfile()
+	mask.Filter(msg)
+	if want := (&testproto.Profile{User: &testproto.User{Name: "name"}, Photo: &testproto.Photo{Path: "path"}}); !proto.Equal(msg, want) {
+		t.Errorf("filtered msg %v, want %v", msg, want)
+	}
+	msg = newProfile()
+	mask.Prune(msg)
+	dest := &testproto.Profile{User: &testproto.User{Name: "name"}}
+	mask.Overwrite(newProfile(), dest)
+	mask.Filter(nil)
+
+	want := []string{
+		"start filter testproto.Profile",
+		"finish filter testproto.Profile 2",
+		"start prune testproto.Profile",
+		"finish prune testproto.Profile 2",
+		"start overwrite testproto.Profile",
+		"finish overwrite testproto.Profile 1",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events %v, want %v", events, want)
+	}
+}
+
+func TestNestedMask_WithHooks_noHooks(t *testing.T) {
+	msg := &testproto.Profile{User: &testproto.User{UserId: 1, Name: "name"}}
+	NestedMaskFromPaths([]string{"user.name"}).WithHooks(Hooks{}).Filter(msg)
+	if want := (&testproto.Profile{User: &testproto.User{Name: "name"}}); !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+
+	// Only the finish hook is set.
+	affected := -1
+	hooks := Hooks{OnFinish: func(_ Operation, _ protoreflect.FullName, n int) { affected = n }}
+	NestedMaskFromPaths([]string{"user.name"}).WithHooks(hooks).Prune(msg)
+	if affected != 1 {
+		t.Errorf("affected %d, want 1", affected)
+	}
+}
+
+func TestHookedMask_Overwrite_typeMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		hooks Hooks
+	}{
+		{name: "no hooks", hooks: Hooks{}},
+		{name: "hooks", hooks: Hooks{OnFinish: func(Operation, protoreflect.FullName, int) {}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				err, ok := recover().(error)
+				if !ok {
+					t.Fatal("Overwrite() did not panic with an error on mismatched types")
+				}
+				if want := "fmutils: cannot overwrite testproto.Photo with testproto.Profile: message types differ"; err.Error() != want {
+					t.Errorf("panic %q, want %q", err, want)
+				}
+			}()
+			mask := NestedMaskFromPaths([]string{"user"}).WithHooks(tt.hooks)
+			mask.Overwrite(&testproto.Profile{User: &testproto.User{UserId: 1}}, &testproto.Photo{})
+		})
+	}
+}
+
+func BenchmarkHookedMask_Filter(b *testing.B) {
+	mask := NestedMaskFromPaths(benchmarkPaths).WithHooks(Hooks{})
+	for i := 0; i < b.N; i++ {
+		mask.Filter(benchmarkProfile())
+	}
+}
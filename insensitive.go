@@ -0,0 +1,81 @@
+package fmutils
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// NestedMaskFromPathsCI creates an instance of NestedMask for the given paths matching the path segments against
+// the msg field names case-insensitively.
+//
+// A segment matches a field if it equals either the field name or its JSON name ignoring the case, e.g.
+// "User.Name", "USER.name" and "profile.loginTimestamps" resolve to the "user.name" and "profile.login_timestamps"
+// fields. The JSON name is the one declared with the json_name option if any, otherwise it is the camelCase field
+// name. The resulting mask uses the exact field names so it may be used with any other NestedMask method for
+// the msg type. Exact matches take precedence, map keys are matched as is and segments that match no field are
+// kept unchanged.
+// Only the msg type is inspected, so a typed nil msg is fine.
+func NestedMaskFromPathsCI(msg proto.Message, paths []string) NestedMask {
+	mask := NestedMaskFromPaths(paths)
+	if msg == nil {
+		return mask
+	}
+	return mask.resolveNames(msg.ProtoReflect().Descriptor())
+}
+
+// resolveNames returns a copy of the mask with the segments replaced by the matching field names of md.
+func (mask NestedMask) resolveNames(md protoreflect.MessageDescriptor) NestedMask {
+	resolved := make(NestedMask, len(mask))
+	for name, submask := range mask {
+		fd := findFieldFold(md, name)
+		if fd == nil {
+			resolved.merge(name, submask)
+			continue
+		}
+		if len(submask) > 0 {
+			switch {
+			case fd.IsMap():
+				if valueMD := fd.MapValue().Message(); valueMD != nil {
+					keys := make(NestedMask, len(submask))
+					for key, m := range submask {
+						keys[key] = m.resolveNames(valueMD)
+					}
+					submask = keys
+				}
+			case fd.IsList() && fd.Message() != nil:
+				elements := make(NestedMask, len(submask))
+				for key, m := range submask {
+					if _, ok := parseIndex(key); ok {
+						elements.merge(key, m.resolveNames(fd.Message()))
+					} else {
+						for name, fieldMask := range (NestedMask{key: m}).resolveNames(fd.Message()) {
+							elements.merge(name, fieldMask)
+						}
+					}
+				}
+				submask = elements
+			case fd.Message() != nil:
+				submask = submask.resolveNames(fd.Message())
+			}
+		}
+		resolved.merge(string(fd.Name()), submask)
+	}
+	return resolved
+}
+
+// findFieldFold finds the md field by its name or JSON name ignoring the case.
+func findFieldFold(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if strings.EqualFold(string(fd.Name()), name) || strings.EqualFold(fd.JSONName(), name) {
+			return fd
+		}
+	}
+	return nil
+}
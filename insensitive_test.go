@@ -0,0 +1,106 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestNestedMaskFromPathsCI(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   proto.Message
+		paths []string
+		want  NestedMask
+	}{
+		{
+			name:  "mixed case names",
+			msg:   &testproto.Profile{},
+			paths: []string{"User.Name", "PHOTO.dimensions.Width"},
+			want: NestedMask{
+				"user":  NestedMask{"name": NestedMask{}},
+				"photo": NestedMask{"dimensions": NestedMask{"width": NestedMask{}}},
+			},
+		},
+		{
+			name:  "json names",
+			msg:   &testproto.Profile{},
+			paths: []string{"loginTimestamps", "CreatedAt.seconds", "gallery.photoId"},
+			want: NestedMask{
+				"login_timestamps": NestedMask{},
+				"created_at":       NestedMask{"seconds": NestedMask{}},
+				"gallery":          NestedMask{"photo_id": NestedMask{}},
+			},
+		},
+		{
+			name:  "explicit json names",
+			msg:   &testproto.Measurement{},
+			paths: []string{"measurementUnit", "BoundingBox.width"},
+			want: NestedMask{
+				"unit": NestedMask{},
+				"size": NestedMask{"width": NestedMask{}},
+			},
+		},
+		{
+			name:  "map keys are matched as is",
+			msg:   &testproto.Profile{},
+			paths: []string{"Attributes.Key1.Tags.T1", "gallery[1].Path"},
+			want: NestedMask{
+				"attributes": NestedMask{"Key1": NestedMask{"tags": NestedMask{"T1": NestedMask{}}}},
+				"gallery":    NestedMask{"[1]": NestedMask{"path": NestedMask{}}},
+			},
+		},
+		{
+			name:  "paths resolving to the same field are merged",
+			msg:   &testproto.Profile{},
+			paths: []string{"user.name", "User.user_id", "Photo", "photo.path"},
+			want: NestedMask{
+				"user":  NestedMask{"name": NestedMask{}, "user_id": NestedMask{}},
+				"photo": NestedMask{},
+			},
+		},
+		{
+			name:  "unknown segments are kept",
+			msg:   &testproto.Profile{},
+			paths: []string{"User.Foo", "Bar"},
+			want: NestedMask{
+				"user": NestedMask{"Foo": NestedMask{}},
+				"Bar":  NestedMask{},
+			},
+		},
+		{
+			name:  "typed nil message",
+			msg:   (*testproto.User)(nil),
+			paths: []string{"Name"},
+			want:  NestedMask{"name": NestedMask{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NestedMaskFromPathsCI(tt.msg, tt.paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NestedMaskFromPathsCI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedMaskFromPathsCI_explicitJSONName(t *testing.T) {
+	msg := &testproto.Measurement{Value: 1, Unit: "cm", Size: &testproto.Dimensions{Width: 10, Height: 20}}
+	paths := []string{"measurementUnit", "boundingBox.height"}
+	if err := Validate(msg, paths); err == nil {
+		t.Error("Validate() error is nil for the unresolved json names, want an error")
+	}
+
+	mask := NestedMaskFromPathsCI(msg, paths)
+	if err := mask.Validate(msg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	mask.Filter(msg)
+	want := &testproto.Measurement{Unit: "cm", Size: &testproto.Dimensions{Height: 20}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
@@ -0,0 +1,26 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// FilterJSON unmarshals the JSON data into the msg, keeps the fields listed in the paths and returns the msg
+// marshaled back into JSON.
+//
+// The msg defines the message type and holds the filtered message when the function returns. The paths may use
+// either the proto field names or their JSON (camelCase) names, e.g. "login_timestamps" or "loginTimestamps", and
+// are matched case-insensitively like in NestedMaskFromPathsCI.
+// The default protojson options are used: see FilterJSONWithOptions to configure them.
+func FilterJSON(data []byte, msg proto.Message, paths []string) ([]byte, error) {
+	return FilterJSONWithOptions(data, msg, paths, protojson.UnmarshalOptions{}, protojson.MarshalOptions{})
+}
+
+// FilterJSONWithOptions works like FilterJSON and unmarshals and marshals the JSON with the given options.
+func FilterJSONWithOptions(data []byte, msg proto.Message, paths []string, uopts protojson.UnmarshalOptions, mopts protojson.MarshalOptions) ([]byte, error) {
+	if err := uopts.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	NestedMaskFromPathsCI(msg, paths).Filter(msg)
+	return mopts.Marshal(msg)
+}
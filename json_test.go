@@ -0,0 +1,71 @@
+package fmutils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestFilterJSON(t *testing.T) {
+	data := []byte(`{
+		"user": {"userId": "1", "name": "name"},
+		"photo": {"path": "path"},
+		"loginTimestamps": ["1", "2"],
+		"gallery": [{"photoId": "3", "path": "gallery path"}]
+	}`)
+	tests := []struct {
+		name  string
+		paths []string
+		mopts protojson.MarshalOptions
+		want  string
+	}{
+		{
+			name:  "proto names",
+			paths: []string{"user.name", "login_timestamps", "gallery.photo_id"},
+			want:  `{"user": {"name": "name"}, "loginTimestamps": ["1", "2"], "gallery": [{"photoId": "3"}]}`,
+		},
+		{
+			name:  "json names",
+			paths: []string{"user.userId", "loginTimestamps"},
+			want:  `{"user": {"userId": "1"}, "loginTimestamps": ["1", "2"]}`,
+		},
+		{
+			name:  "marshal options",
+			paths: []string{"photo"},
+			mopts: protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			want: `{
+				"user": null, "photo": {"photo_id": "0", "path": "path", "dimensions": null, "thumbnail": ""},
+				"login_timestamps": [], "gallery": [], "attributes": {}, "created_at": null, "session_length": null
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &testproto.Profile{}
+			got, err := FilterJSONWithOptions(data, msg, tt.paths, protojson.UnmarshalOptions{}, tt.mopts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var gotJSON, wantJSON interface{}
+			if err := json.Unmarshal(got, &gotJSON); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantJSON); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotJSON, wantJSON) {
+				t.Errorf("FilterJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterJSON_InvalidJSON(t *testing.T) {
+	if _, err := FilterJSON([]byte(`{"user": 1}`), &testproto.Profile{}, []string{"user"}); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
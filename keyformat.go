@@ -0,0 +1,37 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// KeyFormattedMask is a NestedMask that matches the map keys using a custom key formatter.
+//
+// It is created by NestedMask.WithKeyFormatter.
+type KeyFormattedMask struct {
+	mask   NestedMask
+	format func(protoreflect.MapKey) string
+}
+
+// WithKeyFormatter returns the mask that matches the map key path segments against the map keys converted to strings
+// with the format instead of protoreflect.MapKey.String.
+//
+// This is useful when the paths come from clients that encode the map keys differently, e.g. quote the string keys.
+// The wildcard key "*" matches all the keys regardless of the format. A nil format is the same as
+// protoreflect.MapKey.String.
+func (mask NestedMask) WithKeyFormatter(format func(protoreflect.MapKey) string) KeyFormattedMask {
+	return KeyFormattedMask{mask: mask, format: format}
+}
+
+// Filter works like NestedMask.Filter with the map keys formatted with the mask key formatter.
+func (m KeyFormattedMask) Filter(msg proto.Message) {
+	m.mask.FilterWithOptions(msg, FilterOptions{KeyFormatter: m.format})
+}
+
+// Prune works like NestedMask.Prune with the map keys formatted with the mask key formatter.
+func (m KeyFormattedMask) Prune(msg proto.Message) {
+	if isNil(msg) {
+		return
+	}
+	m.mask.pruneMessage(msg, nil, m.format)
+}
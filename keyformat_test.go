@@ -0,0 +1,138 @@
+package fmutils
+
+import (
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func newCounters() *testproto.Counters {
+	return &testproto.Counters{
+		Flags: map[bool]string{true: "on", false: "off"},
+		Attributes: map[int64]*testproto.Attribute{
+			-42: {Tags: map[string]string{"t1": "1", "t2": "2"}},
+			7:   {Tags: map[string]string{"t1": "3"}},
+		},
+	}
+}
+
+func TestFilter_nonStringMapKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  *testproto.Counters
+	}{
+		{
+			name:  "bool key",
+			paths: []string{"flags.true"},
+			want:  &testproto.Counters{Flags: map[bool]string{true: "on"}},
+		},
+		{
+			name:  "negative int key",
+			paths: []string{"attributes.-42.tags.t2"},
+			want: &testproto.Counters{
+				Attributes: map[int64]*testproto.Attribute{-42: {Tags: map[string]string{"t2": "2"}}},
+			},
+		},
+		{
+			name:  "wildcard int key",
+			paths: []string{"attributes.*.tags.t1", "flags.false"},
+			want: &testproto.Counters{
+				Flags: map[bool]string{false: "off"},
+				Attributes: map[int64]*testproto.Attribute{
+					-42: {Tags: map[string]string{"t1": "1"}},
+					7:   {Tags: map[string]string{"t1": "3"}},
+				},
+			},
+		},
+		{
+			name:  "key in a different encoding",
+			paths: []string{"flags.True", "attributes.+7"},
+			want:  &testproto.Counters{Flags: map[bool]string{}, Attributes: map[int64]*testproto.Attribute{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newCounters()
+			Filter(msg, tt.paths)
+			if !proto.Equal(msg, tt.want) {
+				t.Errorf("msg %v, want %v", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedMask_WithKeyFormatter(t *testing.T) {
+	quoted := func(mk protoreflect.MapKey) string {
+		return strconv.Quote(mk.String())
+	}
+	tests := []struct {
+		name   string
+		paths  []string
+		format func(protoreflect.MapKey) string
+		prune  bool
+		want   *testproto.Counters
+	}{
+		{
+			name:   "filter quoted keys",
+			paths:  []string{`flags."true"`, `attributes."7"`},
+			format: quoted,
+			want: &testproto.Counters{
+				Flags:      map[bool]string{true: "on"},
+				Attributes: map[int64]*testproto.Attribute{7: {Tags: map[string]string{"t1": "3"}}},
+			},
+		},
+		{
+			name:   "filter unquoted keys do not match",
+			paths:  []string{"flags.true", `attributes.*.tags."t2"`},
+			format: quoted,
+			want: &testproto.Counters{
+				Flags: map[bool]string{},
+				Attributes: map[int64]*testproto.Attribute{
+					-42: {Tags: map[string]string{"t2": "2"}},
+					7:   {},
+				},
+			},
+		},
+		{
+			name:   "prune quoted keys",
+			paths:  []string{`flags."false"`, `attributes."-42".tags."t1"`},
+			format: quoted,
+			prune:  true,
+			want: &testproto.Counters{
+				Flags: map[bool]string{true: "on"},
+				Attributes: map[int64]*testproto.Attribute{
+					-42: {Tags: map[string]string{"t2": "2"}},
+					7:   {Tags: map[string]string{"t1": "3"}},
+				},
+			},
+		},
+		{
+			name:  "nil format",
+			paths: []string{"flags.false", "attributes.7"},
+			prune: true,
+			want: &testproto.Counters{
+				Flags:      map[bool]string{true: "on"},
+				Attributes: map[int64]*testproto.Attribute{-42: {Tags: map[string]string{"t1": "1", "t2": "2"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newCounters()
+			mask := NestedMaskFromPaths(tt.paths).WithKeyFormatter(tt.format)
+			if tt.prune {
+				mask.Prune(msg)
+			} else {
+				mask.Filter(msg)
+			}
+			if !proto.Equal(msg, tt.want) {
+				t.Errorf("msg %v, want %v", msg, tt.want)
+			}
+		})
+	}
+}
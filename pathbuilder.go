@@ -0,0 +1,66 @@
+package fmutils
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// PathBuilder builds a field mask path by navigating the descriptor of a proto message.
+//
+// Every segment is checked against the descriptor of the current message, so a typo is detected as soon as the
+// path is constructed rather than silently ignored when the mask is applied.
+// PathBuilder is immutable: each call to Field returns a new PathBuilder, so a common prefix can be reused to build
+// several paths.
+type PathBuilder struct {
+	desc     protoreflect.MessageDescriptor
+	mapField protoreflect.FieldDescriptor
+	segments []string
+}
+
+// NewPathBuilder creates a PathBuilder for the given msg type.
+func NewPathBuilder(msg proto.Message) PathBuilder {
+	return PathBuilder{desc: msg.ProtoReflect().Descriptor()}
+}
+
+// Field appends the named field to the path and navigates into it if it is a message.
+//
+// If the previous segment is a map field then name is treated as a map key and the path navigates into the map
+// value. Field panics if name is not a field of the current message or if the previous segment is a scalar field.
+func (b PathBuilder) Field(name string) PathBuilder {
+	next := PathBuilder{segments: make([]string, len(b.segments), len(b.segments)+1)}
+	copy(next.segments, b.segments)
+	next.segments = append(next.segments, name)
+
+	if b.mapField != nil {
+		next.desc = b.mapField.MapValue().Message()
+		return next
+	}
+	if b.desc == nil {
+		panic(fmt.Sprintf("fmutils: can't navigate into %q: %q is not a message", name, b.String()))
+	}
+	fd := b.desc.Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		panic(fmt.Sprintf("fmutils: message %s has no field %q", b.desc.FullName(), name))
+	}
+	if fd.IsMap() {
+		next.mapField = fd
+	} else {
+		next.desc = fd.Message()
+	}
+	return next
+}
+
+// Segments returns the path segments accumulated so far.
+func (b PathBuilder) Segments() []string {
+	segments := make([]string, len(b.segments))
+	copy(segments, b.segments)
+	return segments
+}
+
+// String returns the dotted path accumulated so far.
+func (b PathBuilder) String() string {
+	return strings.Join(b.segments, ".")
+}
@@ -0,0 +1,83 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestPathBuilder(t *testing.T) {
+	photo := NewPathBuilder(&testproto.Profile{}).Field("photo")
+	tests := []struct {
+		name         string
+		builder      PathBuilder
+		wantPath     string
+		wantSegments []string
+	}{
+		{
+			name:         "nested message fields",
+			builder:      photo.Field("dimensions").Field("width"),
+			wantPath:     "photo.dimensions.width",
+			wantSegments: []string{"photo", "dimensions", "width"},
+		},
+		{
+			name:         "shared prefix is not modified",
+			builder:      photo.Field("path"),
+			wantPath:     "photo.path",
+			wantSegments: []string{"photo", "path"},
+		},
+		{
+			name:         "repeated message field",
+			builder:      NewPathBuilder(&testproto.Profile{}).Field("gallery").Field("dimensions"),
+			wantPath:     "gallery.dimensions",
+			wantSegments: []string{"gallery", "dimensions"},
+		},
+		{
+			name:         "map key and map value fields",
+			builder:      NewPathBuilder(&testproto.Profile{}).Field("attributes").Field("a1").Field("tags").Field("t1"),
+			wantPath:     "attributes.a1.tags.t1",
+			wantSegments: []string{"attributes", "a1", "tags", "t1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.builder.String(); got != tt.wantPath {
+				t.Errorf("String() = %q, want %q", got, tt.wantPath)
+			}
+			if got := tt.builder.Segments(); !reflect.DeepEqual(got, tt.wantSegments) {
+				t.Errorf("Segments() = %v, want %v", got, tt.wantSegments)
+			}
+		})
+	}
+}
+
+func TestPathBuilder_Panics(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func()
+	}{
+		{
+			name:  "unknown field",
+			build: func() { NewPathBuilder(&testproto.Profile{}).Field("photo").Field("dimension") },
+		},
+		{
+			name:  "field nested under scalar",
+			build: func() { NewPathBuilder(&testproto.Profile{}).Field("user").Field("name").Field("foo") },
+		},
+		{
+			name:  "field nested under scalar map value",
+			build: func() { NewPathBuilder(&testproto.Attribute{}).Field("tags").Field("t1").Field("foo") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			tt.build()
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Project returns the values of the msg fields listed in the paths as a flat map keyed by the dotted paths.
+//
+// This is handy for structured logging when the selected values are needed without re-serializing the message.
+// Singular message fields listed with a sub-mask are flattened, so the paths "user.name" and "photo.dimensions"
+// result in the "user.name" and "photo.dimensions" keys. Only the populated fields are projected. The values are
+// converted to Go values per the proto kind:
+//   - bool, int32, int64, uint32, uint64, float32, float64, string and []byte scalars are kept as is;
+//   - enums become the names of their values or the int32 numbers if the values are not defined;
+//   - messages become a map[string]interface{} of their populated fields keyed by the field names;
+//   - repeated fields become a []interface{} of the element values;
+//   - maps become a map[string]interface{} keyed by the string form of the map keys.
+//
+// Sub-masks of repeated and map fields apply to their message elements, e.g. "gallery.path" or "attributes.*.tags",
+// and list indexes select the elements like in Filter. If the paths are empty or the msg is nil then nil is returned.
+func Project(msg proto.Message, paths []string) map[string]interface{} {
+	if len(paths) == 0 || isNil(msg) {
+		return nil
+	}
+	out := make(map[string]interface{})
+	NestedMaskFromPaths(paths).project(msg.ProtoReflect(), "", out)
+	return out
+}
+
+// project adds the values of the rft fields listed in the mask to the out map using the dotted paths as the keys.
+func (mask NestedMask) project(rft protoreflect.Message, prefix string, out map[string]interface{}) {
+	rft.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		m, ok := mask.fieldMask(fd)
+		if !ok {
+			return true
+		}
+		path := childPath(prefix, fieldKey(fd), true)
+		if len(m) > 0 && !fd.IsList() && !fd.IsMap() && fd.Message() != nil {
+			m.project(v.Message(), path, out)
+			return true
+		}
+		out[path] = projectValue(fd, v, m)
+		return true
+	})
+}
+
+// projectValue converts the value v of the field fd to a Go value keeping only the fields listed in the mask of
+// its messages. An empty mask keeps all the fields.
+func projectValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, mask NestedMask) interface{} {
+	switch {
+	case fd.IsMap():
+		values := make(map[string]interface{}, v.Map().Len())
+		v.Map().Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+			m := mask
+			if len(mask) > 0 {
+				var ok bool
+				if m, ok = mask.mapKeyMask(mk.String()); !ok {
+					return true
+				}
+			}
+			values[mk.String()] = projectSingular(fd.MapValue(), mv, m)
+			return true
+		})
+		return values
+	case fd.IsList():
+		fieldsMask, indexes := mask.splitIndexes()
+		list := v.List()
+		values := make([]interface{}, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			m, ok := indexes[i]
+			switch {
+			case !ok && len(indexes) > 0 && len(fieldsMask) == 0:
+				continue
+			case !ok:
+				m = fieldsMask
+			case len(fieldsMask) > 0:
+				m = unionMasks(fieldsMask, m)
+			}
+			values = append(values, projectSingular(fd, list.Get(i), m))
+		}
+		return values
+	}
+	return projectSingular(fd, v, mask)
+}
+
+// projectSingular converts the singular value v of the field fd or of an element of the repeated field fd to a Go
+// value.
+func projectSingular(fd protoreflect.FieldDescriptor, v protoreflect.Value, mask NestedMask) interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		values := make(map[string]interface{})
+		v.Message().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			m := mask
+			if len(mask) > 0 {
+				var ok bool
+				if m, ok = mask.fieldMask(fd); !ok {
+					return true
+				}
+			}
+			values[fieldKey(fd)] = projectValue(fd, v, m)
+			return true
+		})
+		return values
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
@@ -0,0 +1,130 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestProject(t *testing.T) {
+	profile := &testproto.Profile{
+		User: &testproto.User{UserId: 1, Name: "user name"},
+		Photo: &testproto.Photo{
+			PhotoId:    2,
+			Path:       "photo path",
+			Dimensions: &testproto.Dimensions{Width: 100, Height: 120},
+			Thumbnail:  []byte("thumb"),
+		},
+		LoginTimestamps: []int64{1, 2},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 3, Path: "path 3"},
+			{PhotoId: 4, Path: "path 4"},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "1"}},
+			"a2": {Tags: map[string]string{"t2": "2"}},
+		},
+	}
+	tests := []struct {
+		name  string
+		msg   proto.Message
+		paths []string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "scalar leaves",
+			msg:   profile,
+			paths: []string{"user.name", "photo.photo_id", "photo.dimensions.width", "photo.thumbnail"},
+			want: map[string]interface{}{
+				"user.name":              "user name",
+				"photo.photo_id":         int64(2),
+				"photo.dimensions.width": int32(100),
+				"photo.thumbnail":        []byte("thumb"),
+			},
+		},
+		{
+			name:  "message leaf",
+			msg:   profile,
+			paths: []string{"photo.dimensions", "user"},
+			want: map[string]interface{}{
+				"photo.dimensions": map[string]interface{}{"width": int32(100), "height": int32(120)},
+				"user":             map[string]interface{}{"user_id": int64(1), "name": "user name"},
+			},
+		},
+		{
+			name:  "repeated fields",
+			msg:   profile,
+			paths: []string{"login_timestamps", "gallery.path"},
+			want: map[string]interface{}{
+				"login_timestamps": []interface{}{int64(1), int64(2)},
+				"gallery": []interface{}{
+					map[string]interface{}{"path": "path 3"},
+					map[string]interface{}{"path": "path 4"},
+				},
+			},
+		},
+		{
+			name:  "list index",
+			msg:   profile,
+			paths: []string{"gallery[1].photo_id"},
+			want: map[string]interface{}{
+				"gallery": []interface{}{
+					map[string]interface{}{"photo_id": int64(4)},
+				},
+			},
+		},
+		{
+			name:  "map fields",
+			msg:   profile,
+			paths: []string{"attributes.a1"},
+			want: map[string]interface{}{
+				"attributes": map[string]interface{}{
+					"a1": map[string]interface{}{
+						"tags": map[string]interface{}{"t1": "1"},
+					},
+				},
+			},
+		},
+		{
+			name:  "map with non-string keys",
+			msg:   &testproto.Counters{Flags: map[bool]string{true: "yes"}},
+			paths: []string{"flags"},
+			want: map[string]interface{}{
+				"flags": map[string]interface{}{"true": "yes"},
+			},
+		},
+		{
+			name:  "enums",
+			msg:   &testproto.Event{Changed: &testproto.Event_Status{Status: testproto.Status_OK}, Statuses: []testproto.Status{testproto.Status_FAILED, 42}},
+			paths: []string{"status", "statuses"},
+			want: map[string]interface{}{
+				"status":   "OK",
+				"statuses": []interface{}{"FAILED", int32(42)},
+			},
+		},
+		{
+			name:  "unpopulated fields are skipped",
+			msg:   &testproto.Profile{User: &testproto.User{Name: "user name"}},
+			paths: []string{"user.user_id", "user.name", "photo.path"},
+			want: map[string]interface{}{
+				"user.name": "user name",
+			},
+		},
+		{
+			name:  "empty paths",
+			msg:   profile,
+			paths: nil,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Project(tt.msg, tt.paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Project() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package fmutils
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// PruneValues clears the fields listed in paths from the given msg if their current values match.
+//
+// The match is called with the value of every populated field listed in paths: the field is cleared if it returns
+// true and is left untouched otherwise. Repeated and map fields are matched as a whole.
+// Nested messages, repeated messages and message map values are descended into following the paths.
+func PruneValues(msg proto.Message, paths []string, match func(protoreflect.Value) bool) {
+	if isNil(msg) {
+		return
+	}
+	NestedMaskFromPaths(paths).rangeLeaves(msg.ProtoReflect(), nil, func(rft protoreflect.Message, fd protoreflect.FieldDescriptor) {
+		if match(rft.Get(fd)) {
+			rft.Clear(fd)
+		}
+	})
+}
+
+// PruneProtecting clears all the fields listed in prunePaths from the given msg except the ones listed in
+// protectPaths.
+//
+// Protection wins over pruning: a field covered by a protect path is kept even if a prune path covers it too, e.g.
+// pruning "user" while protecting "user.user_id" clears all the user fields but user_id. The protected fields that
+// are not set in msg stay unset. The list indexes in both paths refer to the elements of msg before any of them are
+// removed, e.g. pruning "gallery[0]" while protecting "gallery.photo_id" keeps the photo_id of the first element.
+func PruneProtecting(msg proto.Message, prunePaths, protectPaths []string) {
+	if isNil(msg) {
+		return
+	}
+	mask := NestedMaskFromPaths(prunePaths)
+	if protect := NestedMaskFromPaths(protectPaths); len(mask) > 0 && len(protect) > 0 {
+		mask = mask.unprotected(msg.ProtoReflect(), protect)
+	}
+	mask.Prune(msg)
+}
+
+// allFields is the mask matching all the fields of a message including the google.protobuf.Struct, Value and
+// ListValue ones.
+var allFields = NestedMask{wildcardKey: nil}
+
+// unprotected returns the mask pruning the populated fields of rft covered by the mask but not by the protect mask.
+//
+// The result lists the actual fields, map keys and list indexes of rft, so the protected fields nested under a
+// pruned field, map entry or list element are kept by pruning their siblings instead of the whole parent. All the
+// indexes refer to the list elements before any of them are removed. An empty mask covers all the rft fields and an
+// empty result prunes nothing.
+func (mask NestedMask) unprotected(rft protoreflect.Message, protect NestedMask) NestedMask {
+	if rft.Descriptor().FullName() == anyFullName {
+		if inner, ok := unpackAny(rft); ok {
+			return mask.unprotected(inner, protect)
+		}
+		return nil
+	}
+	md := rft.Descriptor()
+	if len(mask) == 0 {
+		mask = allFields
+	} else if mask = mask.messageStructMask(rft); len(mask) == 0 {
+		return nil
+	}
+	protect = protect.structMask(md)
+
+	result := make(NestedMask)
+	unprotectField := func(fd protoreflect.FieldDescriptor) {
+		m, ok := mask.fieldMask(fd)
+		if !ok {
+			return
+		}
+		p, ok := protect.fieldMask(fd)
+		if !ok {
+			result[fieldKey(fd)] = m
+		} else if m, ok = m.unprotectedField(rft, fd, p); ok {
+			result[fieldKey(fd)] = m
+		}
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); rft.Has(fd) {
+			unprotectField(fd)
+		}
+	}
+	if md.ExtensionRanges().Len() > 0 {
+		rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.IsExtension() {
+				unprotectField(fd)
+			}
+			return true
+		})
+	}
+
+	// The Struct and ListValue masks are translated back to the keys the Prune expects.
+	switch md.FullName() {
+	case structFullName:
+		return result["fields"]
+	case listValueFullName:
+		return result["values"]
+	}
+	return result
+}
+
+// unprotectedField returns the mask pruning the populated field fd of rft covered by the mask except for the paths
+// of the protect mask. It returns false if nothing is left to prune.
+func (mask NestedMask) unprotectedField(rft protoreflect.Message, fd protoreflect.FieldDescriptor, protect NestedMask) (NestedMask, bool) {
+	if len(protect) == 0 {
+		return nil, false
+	}
+	result := make(NestedMask)
+	switch {
+	case fd.IsMap():
+		rft.Get(fd).Map().Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+			key := mk.String()
+			m, ok := mask, true
+			if len(mask) > 0 {
+				m, ok = mask.mapKeyMask(key)
+			}
+			if !ok {
+				return true
+			}
+			if p, ok := protect.mapKeyMask(key); !ok {
+				result[key] = m
+			} else if fd.MapValue().Message() != nil && mv.Message().IsValid() {
+				if m, ok = m.unprotectedMessage(mv.Message(), p); ok {
+					result[key] = m
+				}
+			}
+			return true
+		})
+	case fd.IsList():
+		list := rft.Get(fd).List()
+		for i := 0; i < list.Len(); i++ {
+			m, ok := mask.elementMask(i)
+			if !ok {
+				continue
+			}
+			key := "[" + strconv.Itoa(i) + "]"
+			if p, ok := protect.elementMask(i); !ok {
+				result[key] = m
+			} else if fd.Message() != nil {
+				if m, ok = m.unprotectedMessage(list.Get(i).Message(), p); ok {
+					result[key] = m
+				}
+			}
+		}
+	case fd.Message() != nil:
+		return mask.unprotectedMessage(rft.Get(fd).Message(), protect)
+	}
+	return result, len(result) > 0
+}
+
+// unprotectedMessage returns the mask pruning the rft message covered by the mask except for the paths of the
+// protect mask. It returns false if nothing is left to prune.
+func (mask NestedMask) unprotectedMessage(rft protoreflect.Message, protect NestedMask) (NestedMask, bool) {
+	if len(protect) == 0 {
+		return nil, false
+	}
+	m := mask.unprotected(rft, protect)
+	return m, len(m) > 0
+}
+
+// elementMask returns the sub-mask of the list element at the index i given the mask of the repeated field.
+//
+// An empty mask covers all the elements entirely. A sub-mask listed for the index is united with the sub-mask
+// applied to all the elements unless it covers the entire element. It returns false if the element is not covered.
+func (mask NestedMask) elementMask(i int) (NestedMask, bool) {
+	if len(mask) == 0 {
+		return nil, true
+	}
+	if !mask.hasIndexes() {
+		return mask, true
+	}
+	fieldsMask, indexes := mask.splitIndexes()
+	m, ok := indexes[i]
+	switch {
+	case !ok:
+		return fieldsMask, len(fieldsMask) > 0
+	case len(m) > 0 && len(fieldsMask) > 0:
+		return unionMasks(fieldsMask, m), true
+	}
+	return m, true
+}
+
+// PruneRetains returns the sorted populated leaf paths of the msg that a NestedMask.Prune would leave untouched.
+//
+// See Walk for the definition of a populated leaf path. The msg is not modified: a copy of it is pruned instead.
+// Every populated leaf path of the msg is either retained or nested under a path NestedMask.PruneFunc reports as
+// cleared, so the two together give the full picture of a redaction policy. A message field whose fields are all
+// pruned stays set and is retained as an empty message.
+func (mask NestedMask) PruneRetains(msg proto.Message) []string {
+	if isNil(msg) {
+		return nil
+	}
+	pruned := proto.Clone(msg)
+	mask.Prune(pruned)
+	paths, _ := UnionSetPaths(pruned)
+	return paths
+}
+
+// PruneConditional clears the field at the targetPath from the given msg only if the condition holds for the msg.
+//
+// The condition is evaluated against the whole msg before anything is cleared, e.g. to clear "payment.card_number"
+// only if the order is closed. The targetPath may be nested and follows the Prune semantics.
+func PruneConditional(msg proto.Message, targetPath string, condition func(proto.Message) bool) {
+	if isNil(msg) || !condition(msg) {
+		return
+	}
+	Prune(msg, []string{targetPath})
+}
+
+// PruneDeprecated clears all the msg fields that are marked as deprecated in the schema.
+//
+// Nested messages, repeated messages and message map values are pruned recursively.
+func PruneDeprecated(msg proto.Message) {
+	Sanitize(msg, func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		return isDeprecated(fd)
+	})
+}
+
+// PruneKind clears all the msg fields of the given kinds, e.g. all the protoreflect.BytesKind fields to strip the
+// binary blobs before logging.
+//
+// Repeated fields are cleared if their elements are of one of the kinds and map fields are cleared if their values
+// are. Nested messages, repeated messages and message map values are pruned recursively.
+func PruneKind(msg proto.Message, kinds ...protoreflect.Kind) {
+	if len(kinds) == 0 {
+		return
+	}
+	// Sanitize calls the rule with the descriptors of the repeated fields and of the map values, so every element of
+	// a matching repeated field or map is removed.
+	Sanitize(msg, func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		for _, k := range kinds {
+			if k == fd.Kind() {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// isDeprecated reports whether the field is marked with the deprecated option. The value of a map entry is
+// deprecated if the map field is.
+func isDeprecated(fd protoreflect.FieldDescriptor) bool {
+	if entry := fd.ContainingMessage(); entry.IsMapEntry() {
+		if parent, ok := entry.Parent().(protoreflect.MessageDescriptor); ok {
+			fields := parent.Fields()
+			for i := 0; i < fields.Len(); i++ {
+				if f := fields.Get(i); f.IsMap() && f.Message() == entry {
+					fd = f
+					break
+				}
+			}
+		}
+	}
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	return ok && opts.GetDeprecated()
+}
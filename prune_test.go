@@ -0,0 +1,530 @@
+package fmutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestPruneValues(t *testing.T) {
+	redacted := func(v protoreflect.Value) bool {
+		return v.String() == "REDACTED"
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		match func(protoreflect.Value) bool
+		msg   proto.Message
+		want  proto.Message
+	}{
+		{
+			name:  "matching values are cleared",
+			paths: []string{"user.name", "photo.path", "gallery.path"},
+			match: redacted,
+			msg: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "REDACTED"},
+				Photo: &testproto.Photo{Path: "path"},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1, Path: "REDACTED"},
+					{PhotoId: 2, Path: "path"},
+				},
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{Path: "path"},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1},
+					{PhotoId: 2, Path: "path"},
+				},
+			},
+		},
+		{
+			name:  "unlisted matching values are kept",
+			paths: []string{"user.name"},
+			match: redacted,
+			msg: &testproto.Profile{
+				User:  &testproto.User{Name: "name"},
+				Photo: &testproto.Photo{Path: "REDACTED"},
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{Name: "name"},
+				Photo: &testproto.Photo{Path: "REDACTED"},
+			},
+		},
+		{
+			name:  "sentinel id",
+			paths: []string{"user.user_id", "photo.photo_id"},
+			match: func(v protoreflect.Value) bool {
+				return v.Int() == -1
+			},
+			msg: &testproto.Profile{
+				User:  &testproto.User{UserId: -1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2},
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2},
+			},
+		},
+		{
+			name:  "list index",
+			paths: []string{"gallery[1].path"},
+			match: redacted,
+			msg: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1, Path: "REDACTED"},
+					{PhotoId: 2, Path: "REDACTED"},
+				},
+			},
+			want: &testproto.Profile{
+				Gallery: []*testproto.Photo{
+					{PhotoId: 1, Path: "REDACTED"},
+					{PhotoId: 2},
+				},
+			},
+		},
+		{
+			name:  "wildcard",
+			paths: []string{"*.path"},
+			match: redacted,
+			msg: &testproto.Profile{
+				Photo:   &testproto.Photo{PhotoId: 1, Path: "REDACTED"},
+				Gallery: []*testproto.Photo{{PhotoId: 2, Path: "REDACTED"}},
+			},
+			want: &testproto.Profile{
+				Photo:   &testproto.Photo{PhotoId: 1},
+				Gallery: []*testproto.Photo{{PhotoId: 2}},
+			},
+		},
+		{
+			name:  "message packed into Any",
+			paths: []string{"details.name"},
+			match: redacted,
+			msg: &testproto.Event{
+				Changed: &testproto.Event_Details{Details: createAny(&testproto.User{UserId: 1, Name: "REDACTED"})},
+			},
+			want: &testproto.Event{
+				Changed: &testproto.Event_Details{Details: createAny(&testproto.User{UserId: 1})},
+			},
+		},
+		{
+			name:  "extension",
+			paths: []string{"[testproto.note]"},
+			match: redacted,
+			msg: func() proto.Message {
+				account := &testproto.Account{Id: proto.Int64(1)}
+				proto.SetExtension(account, testproto.E_Note, "REDACTED")
+				return account
+			}(),
+			want: &testproto.Account{Id: proto.Int64(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PruneValues(tt.msg, tt.paths, tt.match)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneDeprecated(t *testing.T) {
+	msg := &testproto.Profile{
+		User: &testproto.User{UserId: 1, Name: "name", LegacyName: "legacy", LegacyTags: map[string]string{"t": "v"}},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 1},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "v1"}},
+		},
+	}
+	PruneDeprecated(msg)
+	want := &testproto.Profile{
+		User: &testproto.User{UserId: 1, Name: "name"},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 1},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "v1"}},
+		},
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+
+	event := &testproto.Event{
+		Changed: &testproto.Event_Profile{Profile: &testproto.Profile{
+			User: &testproto.User{LegacyName: "legacy"},
+		}},
+	}
+	PruneDeprecated(event)
+	wantEvent := &testproto.Event{
+		Changed: &testproto.Event_Profile{Profile: &testproto.Profile{User: &testproto.User{}}},
+	}
+	if !proto.Equal(event, wantEvent) {
+		t.Errorf("event %v, want %v", event, wantEvent)
+	}
+}
+
+func TestPruneKind(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:  &testproto.User{UserId: 1, Name: "name"},
+			Photo: &testproto.Photo{PhotoId: 2, Path: "path", Thumbnail: []byte("thumb")},
+			Gallery: []*testproto.Photo{
+				{PhotoId: 3, Thumbnail: []byte("thumb3")},
+				{PhotoId: 4, Path: "path4"},
+			},
+			Attributes: map[string]*testproto.Attribute{
+				"a1": {Tags: map[string]string{"t1": "1"}},
+			},
+		}
+	}
+	tests := []struct {
+		name  string
+		msg   proto.Message
+		kinds []protoreflect.Kind
+		want  proto.Message
+	}{
+		{
+			name:  "bytes",
+			msg:   newProfile(),
+			kinds: []protoreflect.Kind{protoreflect.BytesKind},
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path"},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 3},
+					{PhotoId: 4, Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+				},
+			},
+		},
+		{
+			name:  "strings and string maps",
+			msg:   newProfile(),
+			kinds: []protoreflect.Kind{protoreflect.StringKind},
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{PhotoId: 2, Thumbnail: []byte("thumb")},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 3, Thumbnail: []byte("thumb3")},
+					{PhotoId: 4},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {},
+				},
+			},
+		},
+		{
+			name:  "multiple kinds",
+			msg:   newProfile(),
+			kinds: []protoreflect.Kind{protoreflect.BytesKind, protoreflect.Int64Kind},
+			want: &testproto.Profile{
+				User:  &testproto.User{Name: "name"},
+				Photo: &testproto.Photo{Path: "path"},
+				Gallery: []*testproto.Photo{
+					{},
+					{Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+				},
+			},
+		},
+		{
+			name:  "repeated scalars",
+			msg:   &testproto.Profile{User: &testproto.User{UserId: 1}, LoginTimestamps: []int64{1, 2}},
+			kinds: []protoreflect.Kind{protoreflect.Int64Kind},
+			want:  &testproto.Profile{User: &testproto.User{}},
+		},
+		{
+			name:  "no kinds",
+			msg:   newProfile(),
+			kinds: nil,
+			want:  newProfile(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PruneKind(tt.msg, tt.kinds...)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneProtecting(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User:  &testproto.User{UserId: 1, Name: "name"},
+			Photo: &testproto.Photo{PhotoId: 2, Path: "path", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+			Gallery: []*testproto.Photo{
+				{PhotoId: 3, Path: "path3"},
+				{PhotoId: 4, Path: "path4"},
+			},
+			Attributes: map[string]*testproto.Attribute{
+				"a1": {Tags: map[string]string{"t1": "1"}},
+				"a2": {Tags: map[string]string{"t2": "2"}},
+			},
+		}
+	}
+	tests := []struct {
+		name         string
+		prunePaths   []string
+		protectPaths []string
+		msg          *testproto.Profile
+		want         *testproto.Profile
+	}{
+		{
+			name:         "protected wildcard",
+			prunePaths:   []string{"photo", "gallery"},
+			protectPaths: []string{"*.path"},
+			msg:          newProfile(),
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{Path: "path"},
+				Gallery: []*testproto.Photo{
+					{Path: "path3"},
+					{Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2"}},
+				},
+			},
+		},
+		{
+			name:         "protected field nested under a pruned parent",
+			prunePaths:   []string{"user", "photo"},
+			protectPaths: []string{"user.user_id", "photo.dimensions.width"},
+			msg:          newProfile(),
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{Dimensions: &testproto.Dimensions{Width: 10}},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 3, Path: "path3"},
+					{PhotoId: 4, Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2"}},
+				},
+			},
+		},
+		{
+			name:         "protected repeated and map fields",
+			prunePaths:   []string{"gallery", "attributes", "user.name"},
+			protectPaths: []string{"gallery.photo_id", "attributes.a2", "user"},
+			msg:          newProfile(),
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 3},
+					{PhotoId: 4},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a2": {Tags: map[string]string{"t2": "2"}},
+				},
+			},
+		},
+		{
+			name:         "unset protected fields keep their parent",
+			prunePaths:   []string{"user", "photo"},
+			protectPaths: []string{"user.user_id", "photo.photo_id"},
+			msg:          &testproto.Profile{Photo: &testproto.Photo{Path: "path"}},
+			want:         &testproto.Profile{Photo: &testproto.Photo{}},
+		},
+		{
+			name:         "pruned index with a protected field of all the elements",
+			prunePaths:   []string{"gallery[0]"},
+			protectPaths: []string{"gallery.photo_id"},
+			msg:          newProfile(),
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 3},
+					{PhotoId: 4, Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2"}},
+				},
+			},
+		},
+		{
+			name:         "pruned indexes with a protected index",
+			prunePaths:   []string{"gallery[0]", "gallery[1]"},
+			protectPaths: []string{"gallery[1]"},
+			msg:          newProfile(),
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 4, Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2"}},
+				},
+			},
+		},
+		{
+			name:         "pruned list with a protected field of an index",
+			prunePaths:   []string{"gallery"},
+			protectPaths: []string{"gallery[1].path"},
+			msg:          newProfile(),
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+				Gallery: []*testproto.Photo{
+					{Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2"}},
+				},
+			},
+		},
+		{
+			name:         "protected field of a map entry",
+			prunePaths:   []string{"attributes"},
+			protectPaths: []string{"attributes.a1.tags.t1"},
+			msg:          newProfile(),
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1, Name: "name"},
+				Photo: &testproto.Photo{PhotoId: 2, Path: "path", Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 3, Path: "path3"},
+					{PhotoId: 4, Path: "path4"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+				},
+			},
+		},
+		{
+			name:       "no protected fields",
+			prunePaths: []string{"user", "photo", "gallery", "attributes"},
+			msg:        newProfile(),
+			want:       &testproto.Profile{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PruneProtecting(tt.msg, tt.prunePaths, tt.protectPaths)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneConditional(t *testing.T) {
+	failed := func(msg proto.Message) bool {
+		return msg.(*testproto.Event).GetStatus() == testproto.Status_FAILED
+	}
+	tests := []struct {
+		name       string
+		targetPath string
+		condition  func(proto.Message) bool
+		msg        proto.Message
+		want       proto.Message
+	}{
+		{
+			name:       "condition holds",
+			targetPath: "event_id",
+			condition:  failed,
+			msg:        &testproto.Event{EventId: 1, Changed: &testproto.Event_Status{Status: testproto.Status_FAILED}},
+			want:       &testproto.Event{Changed: &testproto.Event_Status{Status: testproto.Status_FAILED}},
+		},
+		{
+			name:       "condition doesn't hold",
+			targetPath: "event_id",
+			condition:  failed,
+			msg:        &testproto.Event{EventId: 1, Changed: &testproto.Event_Status{Status: testproto.Status_OK}},
+			want:       &testproto.Event{EventId: 1, Changed: &testproto.Event_Status{Status: testproto.Status_OK}},
+		},
+		{
+			name:       "nested target path",
+			targetPath: "photo.dimensions.width",
+			condition: func(msg proto.Message) bool {
+				return msg.(*testproto.Profile).GetUser().GetName() == ""
+			},
+			msg: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{Dimensions: &testproto.Dimensions{Width: 10, Height: 20}},
+			},
+			want: &testproto.Profile{
+				User:  &testproto.User{UserId: 1},
+				Photo: &testproto.Photo{Dimensions: &testproto.Dimensions{Height: 20}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PruneConditional(tt.msg, tt.targetPath, tt.condition)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedMask_PruneRetains(t *testing.T) {
+	msg := &testproto.Profile{
+		User:            &testproto.User{UserId: 1, Name: "user name"},
+		Photo:           &testproto.Photo{Path: "path"},
+		LoginTimestamps: []int64{1},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 2, Path: "path 2"},
+			{PhotoId: 3, Dimensions: &testproto.Dimensions{Width: 10}},
+		},
+		Attributes: map[string]*testproto.Attribute{"a1": {Tags: map[string]string{"t1": "1"}}},
+	}
+	original := proto.Clone(msg)
+	mask := NestedMaskFromPaths([]string{"user.name", "photo.path", "gallery.path", "attributes"})
+
+	got := mask.PruneRetains(msg)
+	want := []string{"gallery.dimensions.width", "gallery.photo_id", "login_timestamps", "photo", "user.user_id"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PruneRetains() = %v, want %v", got, want)
+	}
+	if !proto.Equal(msg, original) {
+		t.Errorf("msg is modified: %v", msg)
+	}
+
+	// Every populated leaf path is either retained or cleared.
+	var cleared []string
+	mask.PruneFunc(proto.Clone(msg), func(path string, _ protoreflect.FieldDescriptor) {
+		cleared = append(cleared, path)
+	})
+	all, err := UnionSetPaths(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range all {
+		covered := false
+		for _, c := range append(got, cleared...) {
+			covered = covered || path == c || strings.HasPrefix(path, c+".") || strings.HasPrefix(path, c+"[")
+		}
+		if !covered {
+			t.Errorf("path %q is neither retained nor cleared", path)
+		}
+	}
+
+	if got := mask.PruneRetains(nil); got != nil {
+		t.Errorf("PruneRetains(nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,46 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// SelfRedactor is implemented by the messages that clear their own fields instead of being pruned using
+// reflection, e.g. the messages with encrypted fields that need special handling.
+//
+// NestedMask.Prune, Prune and their variants delegate to RedactFields if the message being pruned or any message
+// nested in it implements this interface. RedactFields must clear the fields listed in the mask the same way
+// NestedMask.Prune does. It must not prune the receiver itself using this package, since that would delegate back
+// to it, but it may prune the messages it wraps or holds.
+type SelfRedactor interface {
+	RedactFields(mask NestedMask)
+}
+
+// SelfFilterer is implemented by the messages that filter their own fields instead of being filtered using
+// reflection.
+//
+// NestedMask.Filter, Filter and their variants delegate to FilterFields if the message being filtered or any message
+// nested in it implements this interface. FilterFields must keep the fields listed in the mask and clear all the
+// rest the same way NestedMask.Filter does. It must not filter the receiver itself using this package, since that
+// would delegate back to it, but it may filter the messages it wraps or holds.
+type SelfFilterer interface {
+	FilterFields(mask NestedMask)
+}
+
+// filterMessage filters the msg using its SelfFilterer implementation if any, or using reflection otherwise.
+func (mask NestedMask) filterMessage(msg proto.Message, onClear func(string, protoreflect.FieldDescriptor), opts FilterOptions) {
+	if f, ok := msg.(SelfFilterer); ok && len(mask) > 0 {
+		f.FilterFields(mask)
+		return
+	}
+	mask.filter(msg.ProtoReflect(), "", onClear, opts)
+}
+
+// pruneMessage prunes the msg using its SelfRedactor implementation if any, or using reflection otherwise.
+func (mask NestedMask) pruneMessage(msg proto.Message, onClear func(string, protoreflect.FieldDescriptor), format func(protoreflect.MapKey) string) {
+	if r, ok := msg.(SelfRedactor); ok && len(mask) > 0 {
+		r.RedactFields(mask)
+		return
+	}
+	mask.prune(msg.ProtoReflect(), "", onClear, format)
+}
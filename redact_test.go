@@ -0,0 +1,81 @@
+package fmutils
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+// maskedUser masks its name instead of clearing it.
+type maskedUser struct {
+	*testproto.User
+}
+
+func (u maskedUser) RedactFields(mask NestedMask) {
+	if _, ok := mask["name"]; ok && u.Name != "" {
+		u.Name = "***"
+	}
+	rest := mask.Clone()
+	delete(rest, "name")
+	rest.Prune(u.User)
+}
+
+func (u maskedUser) FilterFields(mask NestedMask) {
+	name := u.Name
+	mask.Filter(u.User)
+	if _, ok := mask["name"]; !ok && name != "" {
+		u.Name = "***"
+	}
+}
+
+func TestSelfRedactor(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		prune bool
+		want  *testproto.User
+	}{
+		{
+			name:  "prune delegates",
+			paths: []string{"name", "user_id"},
+			prune: true,
+			want:  &testproto.User{Name: "***", LegacyName: "legacy"},
+		},
+		{
+			name:  "filter delegates",
+			paths: []string{"user_id"},
+			want:  &testproto.User{UserId: 1, Name: "***"},
+		},
+		{
+			name:  "filter keeping the name",
+			paths: []string{"name"},
+			want:  &testproto.User{Name: "user name"},
+		},
+		{
+			name: "empty mask is not delegated",
+			want: &testproto.User{UserId: 1, Name: "user name", LegacyName: "legacy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &testproto.User{UserId: 1, Name: "user name", LegacyName: "legacy"}
+			if tt.prune {
+				Prune(maskedUser{user}, tt.paths)
+			} else {
+				Filter(maskedUser{user}, tt.paths)
+			}
+			if !proto.Equal(user, tt.want) {
+				t.Errorf("user %v, want %v", user, tt.want)
+			}
+		})
+	}
+
+	// Messages that don't implement the interfaces are processed using reflection.
+	user := &testproto.User{UserId: 1, Name: "user name"}
+	Prune(user, []string{"name"})
+	if want := (&testproto.User{UserId: 1}); !proto.Equal(user, want) {
+		t.Errorf("user %v, want %v", user, want)
+	}
+}
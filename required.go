@@ -0,0 +1,49 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RequiredPaths returns the paths of all the required fields of the msg type.
+//
+// Required message fields are descended into: a required message field that has required fields itself is
+// represented by the paths of those fields, e.g. "owner.email", otherwise by its own path. Optional and repeated
+// fields are not descended into even if their messages have required fields. The paths are ordered by the field
+// numbers, so Filter with the returned paths keeps the minimal set of fields a valid message needs.
+// Messages without required fields, e.g. proto3 ones, result in no paths. Only the msg type is inspected, so a
+// typed nil msg is fine.
+func RequiredPaths(msg proto.Message) []string {
+	if msg == nil {
+		return nil
+	}
+	return requiredPaths(msg.ProtoReflect().Descriptor(), "", nil)
+}
+
+// requiredPaths appends the paths of the required fields of md to paths.
+//
+// The parents are the messages the md is nested in, which guards against the recursive required fields.
+func requiredPaths(md protoreflect.MessageDescriptor, prefix string, parents []protoreflect.FullName) []string {
+	if containsName(parents, md.FullName()) {
+		return nil
+	}
+	parents = append(parents, md.FullName())
+
+	var paths []string
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Cardinality() != protoreflect.Required {
+			continue
+		}
+		path := childPath(prefix, string(fd.Name()), true)
+		if fd.Message() != nil {
+			if nested := requiredPaths(fd.Message(), path, parents); len(nested) > 0 {
+				paths = append(paths, nested...)
+				continue
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -0,0 +1,78 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestRequiredPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  proto.Message
+		want []string
+	}{
+		{
+			name: "nested required fields",
+			msg:  &testproto.Account{},
+			want: []string{"id", "owner.email", "settings"},
+		},
+		{
+			name: "flat required fields",
+			msg:  &testproto.Owner{},
+			want: []string{"email"},
+		},
+		{
+			name: "proto2 without required fields",
+			msg:  &testproto.Settings{},
+			want: nil,
+		},
+		{
+			name: "proto3",
+			msg:  &testproto.Profile{},
+			want: nil,
+		},
+		{
+			name: "typed nil message",
+			msg:  (*testproto.Account)(nil),
+			want: []string{"id", "owner.email", "settings"},
+		},
+		{
+			name: "nil message",
+			msg:  nil,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequiredPaths(tt.msg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RequiredPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredPaths_filter(t *testing.T) {
+	msg := &testproto.Account{
+		Id:          proto.Int64(1),
+		Owner:       &testproto.Owner{Email: proto.String("owner@example.com"), Name: proto.String("owner")},
+		BackupOwner: &testproto.Owner{Email: proto.String("backup@example.com")},
+		Settings:    &testproto.Settings{Limit: proto.Int64(5)},
+		Members:     []*testproto.Owner{{Email: proto.String("member@example.com")}},
+	}
+	Filter(msg, RequiredPaths(msg))
+	want := &testproto.Account{
+		Id:       proto.Int64(1),
+		Owner:    &testproto.Owner{Email: proto.String("owner@example.com")},
+		Settings: &testproto.Settings{Limit: proto.Int64(5)},
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+	if err := proto.CheckInitialized(msg); err != nil {
+		t.Errorf("filtered msg is not initialized: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FilterAt keeps the fields listed in paths of the message located at rootPath in msg and clears all the rest of
+// its fields.
+//
+// The paths are relative to the message at rootPath, e.g. FilterAt(profile, "photo", []string{"path"}) is the same as
+// Filter(profile.GetPhoto(), []string{"path"}). The fields of msg outside of rootPath are left untouched.
+// The rootPath is a dotted path of message fields and message map values, e.g. "attributes.a1". An empty rootPath
+// refers to msg itself. If the root message is not set or rootPath doesn't refer to a message then msg is left
+// untouched.
+func FilterAt(msg proto.Message, rootPath string, paths []string) {
+	if isNil(msg) {
+		return
+	}
+	if root, ok := messageAt(msg.ProtoReflect(), rootPath); ok {
+		NestedMaskFromPaths(paths).filter(root, "", nil, FilterOptions{})
+	}
+}
+
+// messageAt returns the message located at the path in rft if it is set.
+func messageAt(rft protoreflect.Message, path string) (protoreflect.Message, bool) {
+	segments := splitPath(path)
+	for i := 0; i < len(segments); i++ {
+		fd := rft.Descriptor().Fields().ByName(protoreflect.Name(segments[i]))
+		if fd == nil || fd.Message() == nil || fd.IsList() || !rft.Has(fd) {
+			return nil, false
+		}
+		if !fd.IsMap() {
+			rft = rft.Get(fd).Message()
+			continue
+		}
+		if i++; i == len(segments) || fd.MapValue().Message() == nil {
+			return nil, false
+		}
+		mk, err := parseMapKey(fd.MapKey(), segments[i])
+		if err != nil {
+			return nil, false
+		}
+		v := rft.Get(fd).Map().Get(mk)
+		if !v.IsValid() {
+			return nil, false
+		}
+		rft = v.Message()
+	}
+	return rft, true
+}
@@ -0,0 +1,110 @@
+package fmutils
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestFilterAt(t *testing.T) {
+	newProfile := func() *testproto.Profile {
+		return &testproto.Profile{
+			User: &testproto.User{UserId: 1, Name: "name"},
+			Photo: &testproto.Photo{
+				PhotoId:    2,
+				Path:       "path",
+				Dimensions: &testproto.Dimensions{Width: 10, Height: 20},
+			},
+			Attributes: map[string]*testproto.Attribute{
+				"a1": {Tags: map[string]string{"t1": "1", "t2": "2"}},
+				"a2": {Tags: map[string]string{"t1": "1"}},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		rootPath string
+		paths    []string
+		msg      *testproto.Profile
+		want     *testproto.Profile
+	}{
+		{
+			name:     "nested message",
+			rootPath: "photo",
+			paths:    []string{"path", "dimensions.width"},
+			msg:      newProfile(),
+			want: func() *testproto.Profile {
+				p := newProfile()
+				p.Photo = &testproto.Photo{Path: "path", Dimensions: &testproto.Dimensions{Width: 10}}
+				return p
+			}(),
+		},
+		{
+			name:     "deeply nested message",
+			rootPath: "photo.dimensions",
+			paths:    []string{"height"},
+			msg:      newProfile(),
+			want: func() *testproto.Profile {
+				p := newProfile()
+				p.Photo.Dimensions = &testproto.Dimensions{Height: 20}
+				return p
+			}(),
+		},
+		{
+			name:     "map value",
+			rootPath: "attributes.a1",
+			paths:    []string{"tags.t2"},
+			msg:      newProfile(),
+			want: func() *testproto.Profile {
+				p := newProfile()
+				p.Attributes["a1"] = &testproto.Attribute{Tags: map[string]string{"t2": "2"}}
+				return p
+			}(),
+		},
+		{
+			name:     "empty root path",
+			rootPath: "",
+			paths:    []string{"user"},
+			msg:      newProfile(),
+			want:     &testproto.Profile{User: &testproto.User{UserId: 1, Name: "name"}},
+		},
+		{
+			name:     "unset root",
+			rootPath: "photo",
+			paths:    []string{"path"},
+			msg:      &testproto.Profile{User: &testproto.User{UserId: 1}},
+			want:     &testproto.Profile{User: &testproto.User{UserId: 1}},
+		},
+		{
+			name:     "missing map key",
+			rootPath: "attributes.a3",
+			paths:    []string{"tags"},
+			msg:      newProfile(),
+			want:     newProfile(),
+		},
+		{
+			name:     "scalar root",
+			rootPath: "user.name",
+			paths:    []string{"foo"},
+			msg:      newProfile(),
+			want:     newProfile(),
+		},
+		{
+			name:     "unknown root",
+			rootPath: "foo",
+			paths:    []string{"bar"},
+			msg:      newProfile(),
+			want:     newProfile(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			FilterAt(tt.msg, tt.rootPath, tt.paths)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Sanitize clears all the msg fields whose values are rejected by the rule.
+//
+// The rule is called for every populated field with the field descriptor and its value. A rejected field is
+// cleared, otherwise a message field is sanitized recursively.
+// Repeated fields and maps are sanitized element by element: the rule is called with the descriptor of the repeated
+// field (or the map value descriptor) and a single element value, and the rejected elements are removed.
+func Sanitize(msg proto.Message, rule func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool) {
+	if isNil(msg) {
+		return
+	}
+	sanitize(msg.ProtoReflect(), rule)
+}
+
+// FilterIf keeps the msg fields whose values are accepted by keep and clears all the rest.
+//
+// This is the value-driven counterpart of Filter: which fields are kept depends on their runtime values rather than
+// on a mask. The keep predicate is called for the fields and the elements the same way Sanitize calls its rule,
+// so a kept message field is filtered recursively and the repeated fields and maps are filtered element by element.
+func FilterIf(msg proto.Message, keep func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool) {
+	Sanitize(msg, func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		return !keep(fd, v)
+	})
+}
+
+func sanitize(rft protoreflect.Message, rule func(protoreflect.FieldDescriptor, protoreflect.Value) bool) {
+	rft.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsMap() {
+			xmap := v.Map()
+			valueFD := fd.MapValue()
+			xmap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+				if rule(valueFD, mv) {
+					xmap.Clear(mk)
+				} else if valueFD.Message() != nil {
+					sanitize(mv.Message(), rule)
+				}
+				return true
+			})
+		} else if fd.IsList() {
+			list := v.List()
+			n := 0
+			for i := 0; i < list.Len(); i++ {
+				item := list.Get(i)
+				if rule(fd, item) {
+					continue
+				}
+				if fd.Message() != nil {
+					sanitize(item.Message(), rule)
+				}
+				list.Set(n, item)
+				n++
+			}
+			list.Truncate(n)
+		} else if rule(fd, v) {
+			rft.Clear(fd)
+		} else if fd.Message() != nil {
+			sanitize(v.Message(), rule)
+		}
+		return true
+	})
+}
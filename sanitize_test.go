@@ -0,0 +1,128 @@
+package fmutils
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		rule func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool
+		msg  proto.Message
+		want proto.Message
+	}{
+		{
+			name: "long strings are cleared recursively",
+			rule: func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+				return fd.Kind() == protoreflect.StringKind && len(v.String()) > 5
+			},
+			msg: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+					Name:   "long name",
+				},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 2, Path: "path"},
+					{PhotoId: 3, Path: "long path"},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "short", "t2": "too long"}},
+				},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{
+					UserId: 1,
+				},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 2, Path: "path"},
+					{PhotoId: 3},
+				},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "short"}},
+				},
+			},
+		},
+		{
+			name: "rejected list elements are removed",
+			rule: func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+				if fd.Kind() == protoreflect.Int64Kind {
+					return v.Int() < 0
+				}
+				if fd.Kind() == protoreflect.MessageKind && fd.Message().Name() == "Photo" {
+					return !v.Message().Has(fd.Message().Fields().ByName("path"))
+				}
+				return false
+			},
+			msg: &testproto.Profile{
+				User: &testproto.User{
+					UserId: -1,
+					Name:   "name",
+				},
+				LoginTimestamps: []int64{1, -2, 3, -4},
+				Gallery: []*testproto.Photo{
+					{PhotoId: 2},
+					{PhotoId: -3, Path: "path"},
+				},
+			},
+			want: &testproto.Profile{
+				User: &testproto.User{
+					Name: "name",
+				},
+				LoginTimestamps: []int64{1, 3},
+				Gallery: []*testproto.Photo{
+					{Path: "path"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Sanitize(tt.msg, tt.rule)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterIf(t *testing.T) {
+	msg := &testproto.Profile{
+		User:  &testproto.User{UserId: 1, Name: "user name"},
+		Photo: &testproto.Photo{PhotoId: 2},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 3, Path: "path 3"},
+			{PhotoId: 4},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "", "t2": "tag"}},
+		},
+	}
+	// Keep the non-empty strings, the ids greater than 2 and the photos that have a path.
+	keep := func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Kind() == protoreflect.StringKind:
+			return v.String() != ""
+		case fd.Kind() == protoreflect.Int64Kind:
+			return v.Int() > 2
+		case fd.Message() != nil && fd.Message().Name() == "Photo":
+			return v.Message().Get(fd.Message().Fields().ByName("path")).String() != ""
+		}
+		return true
+	}
+	FilterIf(msg, keep)
+	want := &testproto.Profile{
+		User:    &testproto.User{Name: "user name"},
+		Gallery: []*testproto.Photo{{PhotoId: 3, Path: "path 3"}},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t2": "tag"}},
+		},
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
@@ -0,0 +1,85 @@
+package fmutils
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const fieldMaskFullName protoreflect.FullName = "google.protobuf.FieldMask"
+
+// FilterBySelfMask filters the msg using the paths of the google.protobuf.FieldMask stored in its maskFieldName
+// field.
+//
+// The mask is normalized before it is applied and the mask field itself is always kept. Like with Filter, an empty
+// mask keeps all the fields.
+// An error is returned if the msg has no such field or if it isn't a google.protobuf.FieldMask.
+func FilterBySelfMask(msg proto.Message, maskFieldName string) error {
+	if isNil(msg) {
+		return nil
+	}
+	paths, err := selfMaskPaths(msg.ProtoReflect(), maskFieldName)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	mask := NestedMaskFromPaths(paths)
+	mask[maskFieldName] = NestedMask{}
+	mask.Filter(msg)
+	return nil
+}
+
+// FilterFieldBySelfMask filters the message stored in the fieldName field of the msg using the paths of the
+// google.protobuf.FieldMask stored in its maskFieldName field.
+//
+// This is common for AIP-style update requests where the mask travels with the payload, e.g.
+// FilterFieldBySelfMask(req, "update_mask", "profile"). The mask is normalized before it is applied and an empty
+// mask keeps all the fields.
+// An error is returned if the msg has no such fields, if the mask field isn't a google.protobuf.FieldMask or if the
+// fieldName field isn't a singular message field.
+func FilterFieldBySelfMask(msg proto.Message, maskFieldName, fieldName string) error {
+	if isNil(msg) {
+		return nil
+	}
+	rft := msg.ProtoReflect()
+	paths, err := selfMaskPaths(rft, maskFieldName)
+	if err != nil {
+		return err
+	}
+	fd := rft.Descriptor().Fields().ByName(protoreflect.Name(fieldName))
+	if fd == nil {
+		return fmt.Errorf("fmutils: message %s has no field %q", rft.Descriptor().FullName(), fieldName)
+	}
+	if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+		return fmt.Errorf("fmutils: field %q of message %s is not a singular message field",
+			fieldName, rft.Descriptor().FullName())
+	}
+	if rft.Has(fd) {
+		NestedMaskFromPaths(paths).Filter(rft.Get(fd).Message().Interface())
+	}
+	return nil
+}
+
+// selfMaskPaths returns the normalized paths of the FieldMask stored in the maskFieldName field of the rft.
+func selfMaskPaths(rft protoreflect.Message, maskFieldName string) ([]string, error) {
+	md := rft.Descriptor()
+	fd := md.Fields().ByName(protoreflect.Name(maskFieldName))
+	if fd == nil {
+		return nil, fmt.Errorf("fmutils: message %s has no field %q", md.FullName(), maskFieldName)
+	}
+	if fd.Message() == nil || fd.Message().FullName() != fieldMaskFullName || fd.IsList() {
+		return nil, fmt.Errorf("fmutils: field %q of message %s is not a %s", maskFieldName, md.FullName(), fieldMaskFullName)
+	}
+	fm := rft.Get(fd).Message()
+	list := fm.Get(fm.Descriptor().Fields().ByName("paths")).List()
+	mask := &fieldmaskpb.FieldMask{Paths: make([]string, list.Len())}
+	for i := range mask.Paths {
+		mask.Paths[i] = list.Get(i).String()
+	}
+	mask.Normalize()
+	return mask.Paths, nil
+}
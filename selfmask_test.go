@@ -0,0 +1,95 @@
+package fmutils
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestFilterFieldBySelfMask(t *testing.T) {
+	req := &testproto.UpdateProfileRequest{
+		Profile: &testproto.Profile{
+			User:  &testproto.User{UserId: 1, Name: "name"},
+			Photo: &testproto.Photo{PhotoId: 2, Path: "path"},
+		},
+		Fieldmask: &fieldmaskpb.FieldMask{Paths: []string{"photo", "user.name", "photo.path"}},
+	}
+	if err := FilterFieldBySelfMask(req, "fieldmask", "profile"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &testproto.UpdateProfileRequest{
+		Profile: &testproto.Profile{
+			User:  &testproto.User{Name: "name"},
+			Photo: &testproto.Photo{PhotoId: 2, Path: "path"},
+		},
+		Fieldmask: &fieldmaskpb.FieldMask{Paths: []string{"photo", "user.name", "photo.path"}},
+	}
+	if !proto.Equal(req, want) {
+		t.Errorf("req %v, want %v", req, want)
+	}
+
+	req.Fieldmask = nil
+	if err := FilterFieldBySelfMask(req, "fieldmask", "profile"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !proto.Equal(req.Profile, want.Profile) {
+		t.Errorf("profile %v, want %v", req.Profile, want.Profile)
+	}
+}
+
+func TestFilterBySelfMask(t *testing.T) {
+	req := &testproto.UpdateProfileRequest{
+		Profile: &testproto.Profile{
+			User:  &testproto.User{UserId: 1, Name: "name"},
+			Photo: &testproto.Photo{PhotoId: 2},
+		},
+		Fieldmask: &fieldmaskpb.FieldMask{Paths: []string{"profile.user.user_id"}},
+	}
+	if err := FilterBySelfMask(req, "fieldmask"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &testproto.UpdateProfileRequest{
+		Profile:   &testproto.Profile{User: &testproto.User{UserId: 1}},
+		Fieldmask: &fieldmaskpb.FieldMask{Paths: []string{"profile.user.user_id"}},
+	}
+	if !proto.Equal(req, want) {
+		t.Errorf("req %v, want %v", req, want)
+	}
+}
+
+func TestFilterBySelfMask_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  func() error
+		wantErr string
+	}{
+		{
+			name:    "unknown mask field",
+			filter:  func() error { return FilterBySelfMask(&testproto.UpdateProfileRequest{}, "update_mask") },
+			wantErr: `message testproto.UpdateProfileRequest has no field "update_mask"`,
+		},
+		{
+			name:    "mask field is not a FieldMask",
+			filter:  func() error { return FilterBySelfMask(&testproto.UpdateProfileRequest{}, "profile") },
+			wantErr: `field "profile" of message testproto.UpdateProfileRequest is not a google.protobuf.FieldMask`,
+		},
+		{
+			name: "unknown target field",
+			filter: func() error {
+				return FilterFieldBySelfMask(&testproto.UpdateProfileRequest{}, "fieldmask", "foo")
+			},
+			wantErr: `message testproto.UpdateProfileRequest has no field "foo"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package fmutils
+
+import (
+	"reflect"
+)
+
+// structTag is the Go struct field tag used by MaskFromStruct.
+const structTag = "fmutils"
+
+// MaskFromStruct returns the paths listed in the `fmutils:"..."` tags of the v struct fields.
+//
+// This allows a Go view type to declare the proto paths it needs, e.g.:
+//
+//	type UserView struct {
+//		Name  string `fmutils:"user.name"`
+//		Photo string `fmutils:"photo.path"`
+//	}
+//
+// The v may be a struct or a pointer to a struct. Unexported fields, fields without the tag and fields tagged
+// with "-" are skipped. Nil is returned if v is not a struct.
+func MaskFromStruct(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var paths []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		path, ok := f.Tag.Lookup(structTag)
+		if !ok || path == "" || path == "-" {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -0,0 +1,52 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskFromStruct(t *testing.T) {
+	type view struct {
+		Name     string `fmutils:"user.name"`
+		Width    int32  `fmutils:"photo.dimensions.width"`
+		Skipped  string `fmutils:"-"`
+		NoTag    string
+		Other    string `json:"other"`
+		internal string `fmutils:"user.user_id"`
+	}
+	_ = view{}.internal
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want []string
+	}{
+		{
+			name: "struct",
+			v:    view{},
+			want: []string{"user.name", "photo.dimensions.width"},
+		},
+		{
+			name: "pointer to struct",
+			v:    &view{},
+			want: []string{"user.name", "photo.dimensions.width"},
+		},
+		{
+			name: "not a struct",
+			v:    "user.name",
+			want: nil,
+		},
+		{
+			name: "nil",
+			v:    nil,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskFromStruct(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MaskFromStruct() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	structFullName    protoreflect.FullName = "google.protobuf.Struct"
+	valueFullName     protoreflect.FullName = "google.protobuf.Value"
+	listValueFullName protoreflect.FullName = "google.protobuf.ListValue"
+)
+
+// structMask translates the mask applied to a google.protobuf.Struct, Value or ListValue message of the md type into
+// the mask of the actual message fields, so that the paths may navigate the JSON-like values by their keys.
+//
+// The segments under a Struct are the keys of its fields. The segments under a Value are either its fields, e.g.
+// "struct_value" or "string_value", or the keys of its struct_value otherwise. The segments under a ListValue are
+// applied to all of its values. The mask of any other type is returned as is.
+func (mask NestedMask) structMask(md protoreflect.MessageDescriptor) NestedMask {
+	switch md.FullName() {
+	case structFullName:
+		return NestedMask{"fields": mask}
+	case listValueFullName:
+		return NestedMask{"values": mask}
+	case valueFullName:
+		var keys NestedMask
+		for key, m := range mask {
+			if md.Fields().ByName(protoreflect.Name(key)) == nil {
+				if keys == nil {
+					keys = make(NestedMask)
+				}
+				keys[key] = m
+			}
+		}
+		if keys == nil {
+			return mask
+		}
+		translated := make(NestedMask, len(mask)-len(keys)+1)
+		for key, m := range mask {
+			if _, ok := keys[key]; !ok {
+				translated[key] = m
+			}
+		}
+		if m, ok := translated["struct_value"]; ok {
+			translated["struct_value"] = unionMasks(m, keys)
+		} else {
+			translated["struct_value"] = keys
+		}
+		return translated
+	}
+	return mask
+}
+
+// messageStructMask works like structMask for the actual rft message.
+//
+// A google.protobuf.Value of a scalar kind is a leaf for the paths that don't list its set field explicitly, so nil
+// is returned for it to keep the value as is instead of leaving it without a kind.
+func (mask NestedMask) messageStructMask(rft protoreflect.Message) NestedMask {
+	md := rft.Descriptor()
+	mask = mask.structMask(md)
+	if md.FullName() == valueFullName {
+		if fd := rft.WhichOneof(md.Oneofs().ByName("kind")); fd != nil && fd.Message() == nil {
+			if _, ok := mask[string(fd.Name())]; !ok {
+				return nil
+			}
+		}
+	}
+	return mask
+}
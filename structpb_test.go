@@ -0,0 +1,101 @@
+package fmutils
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func newEvent(t *testing.T) *testproto.Event {
+	payload, err := structpb.NewValue(map[string]interface{}{
+		"user": map[string]interface{}{
+			"name": "name",
+			"age":  30,
+		},
+		"tags":  []interface{}{map[string]interface{}{"id": 1, "label": "a"}, map[string]interface{}{"id": 2}},
+		"token": "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := structpb.NewStruct(map[string]interface{}{
+		"source":  "web",
+		"traceId": "123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testproto.Event{EventId: 1, Payload: payload, Metadata: metadata}
+}
+
+func TestFilter_Struct(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "struct_value path",
+			paths: []string{"payload.struct_value.user.name"},
+			want:  map[string]interface{}{"user": map[string]interface{}{"name": "name"}},
+		},
+		{
+			name:  "implicit struct_value path",
+			paths: []string{"payload.user.name", "payload.token"},
+			want:  map[string]interface{}{"user": map[string]interface{}{"name": "name"}, "token": "secret"},
+		},
+		{
+			name:  "list values",
+			paths: []string{"payload.tags.list_value.id"},
+			want: map[string]interface{}{
+				"tags": []interface{}{map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2}},
+			},
+		},
+		{
+			name:  "paths into scalar values keep them",
+			paths: []string{"payload.token.foo", "payload.user.name.bar", "payload.user.age"},
+			want: map[string]interface{}{
+				"user":  map[string]interface{}{"name": "name", "age": 30},
+				"token": "secret",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := newEvent(t)
+			Filter(event, tt.paths)
+			want, err := structpb.NewValue(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(event, &testproto.Event{Payload: want}) {
+				t.Errorf("event %v, want payload %v", event, want)
+			}
+		})
+	}
+}
+
+func TestPrune_Struct(t *testing.T) {
+	event := newEvent(t)
+	Prune(event, []string{"payload.user.name", "payload.tags", "metadata.traceId"})
+	want := newEvent(t)
+	delete(want.Payload.GetStructValue().Fields["user"].GetStructValue().Fields, "name")
+	delete(want.Payload.GetStructValue().Fields, "tags")
+	delete(want.Metadata.Fields, "traceId")
+	if !proto.Equal(event, want) {
+		t.Errorf("event %v, want %v", event, want)
+	}
+}
+
+func TestValidate_Struct(t *testing.T) {
+	paths := []string{"payload.user.name", "payload.struct_value.user", "payload.list_value.id", "metadata.anything"}
+	if err := Validate(&testproto.Event{}, paths); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Validate(&testproto.Event{}, []string{"payload.string_value.foo"}); err == nil {
+		t.Error("expected an error for a path nested under string_value")
+	}
+}
@@ -0,0 +1,402 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.0
+// 	protoc        v3.21.12
+// source: testproto2.proto
+
+package testproto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Settings struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name        *string `protobuf:"bytes,1,opt,name=name,def=unnamed" json:"name,omitempty"`
+	Limit       *int64  `protobuf:"varint,2,opt,name=limit,def=10" json:"limit,omitempty"`
+	Enabled     *bool   `protobuf:"varint,3,opt,name=enabled,def=1" json:"enabled,omitempty"`
+	Description *string `protobuf:"bytes,4,opt,name=description" json:"description,omitempty"`
+}
+
+// Default values for Settings fields.
+const (
+	Default_Settings_Name    = string("unnamed")
+	Default_Settings_Limit   = int64(10)
+	Default_Settings_Enabled = bool(true)
+)
+
+func (x *Settings) Reset() {
+	*x = Settings{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_testproto2_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Settings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Settings) ProtoMessage() {}
+
+func (x *Settings) ProtoReflect() protoreflect.Message {
+	mi := &file_testproto2_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Settings.ProtoReflect.Descriptor instead.
+func (*Settings) Descriptor() ([]byte, []int) {
+	return file_testproto2_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Settings) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return Default_Settings_Name
+}
+
+func (x *Settings) GetLimit() int64 {
+	if x != nil && x.Limit != nil {
+		return *x.Limit
+	}
+	return Default_Settings_Limit
+}
+
+func (x *Settings) GetEnabled() bool {
+	if x != nil && x.Enabled != nil {
+		return *x.Enabled
+	}
+	return Default_Settings_Enabled
+}
+
+func (x *Settings) GetDescription() string {
+	if x != nil && x.Description != nil {
+		return *x.Description
+	}
+	return ""
+}
+
+type Owner struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Email *string `protobuf:"bytes,1,req,name=email" json:"email,omitempty"`
+	Name  *string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+}
+
+func (x *Owner) Reset() {
+	*x = Owner{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_testproto2_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Owner) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Owner) ProtoMessage() {}
+
+func (x *Owner) ProtoReflect() protoreflect.Message {
+	mi := &file_testproto2_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Owner.ProtoReflect.Descriptor instead.
+func (*Owner) Descriptor() ([]byte, []int) {
+	return file_testproto2_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Owner) GetEmail() string {
+	if x != nil && x.Email != nil {
+		return *x.Email
+	}
+	return ""
+}
+
+func (x *Owner) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+type Account struct {
+	state           protoimpl.MessageState
+	sizeCache       protoimpl.SizeCache
+	unknownFields   protoimpl.UnknownFields
+	extensionFields protoimpl.ExtensionFields
+
+	Id          *int64    `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
+	Owner       *Owner    `protobuf:"bytes,2,req,name=owner" json:"owner,omitempty"`
+	BackupOwner *Owner    `protobuf:"bytes,3,opt,name=backup_owner,json=backupOwner" json:"backup_owner,omitempty"`
+	Settings    *Settings `protobuf:"bytes,4,req,name=settings" json:"settings,omitempty"`
+	Members     []*Owner  `protobuf:"bytes,5,rep,name=members" json:"members,omitempty"`
+}
+
+func (x *Account) Reset() {
+	*x = Account{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_testproto2_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Account) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Account) ProtoMessage() {}
+
+func (x *Account) ProtoReflect() protoreflect.Message {
+	mi := &file_testproto2_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Account.ProtoReflect.Descriptor instead.
+func (*Account) Descriptor() ([]byte, []int) {
+	return file_testproto2_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Account) GetId() int64 {
+	if x != nil && x.Id != nil {
+		return *x.Id
+	}
+	return 0
+}
+
+func (x *Account) GetOwner() *Owner {
+	if x != nil {
+		return x.Owner
+	}
+	return nil
+}
+
+func (x *Account) GetBackupOwner() *Owner {
+	if x != nil {
+		return x.BackupOwner
+	}
+	return nil
+}
+
+func (x *Account) GetSettings() *Settings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+func (x *Account) GetMembers() []*Owner {
+	if x != nil {
+		return x.Members
+	}
+	return nil
+}
+
+var file_testproto2_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*Account)(nil),
+		ExtensionType: (*Owner)(nil),
+		Field:         100,
+		Name:          "testproto.auditor",
+		Tag:           "bytes,100,opt,name=auditor",
+		Filename:      "testproto2.proto",
+	},
+	{
+		ExtendedType:  (*Account)(nil),
+		ExtensionType: (*string)(nil),
+		Field:         101,
+		Name:          "testproto.note",
+		Tag:           "bytes,101,opt,name=note",
+		Filename:      "testproto2.proto",
+	},
+}
+
+// Extension fields to Account.
+var (
+	// optional testproto.Owner auditor = 100;
+	E_Auditor = &file_testproto2_proto_extTypes[0]
+	// optional string note = 101;
+	E_Note = &file_testproto2_proto_extTypes[1]
+)
+
+var File_testproto2_proto protoreflect.FileDescriptor
+
+var file_testproto2_proto_rawDesc = []byte{
+	0x0a, 0x10, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x32, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x09, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x83, 0x01,
+	0x0a, 0x08, 0x53, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x73, 0x12, 0x1b, 0x0a, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x3a, 0x07, 0x75, 0x6e, 0x6e, 0x61, 0x6d, 0x65,
+	0x64, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x3a, 0x02, 0x31, 0x30, 0x52, 0x05, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x12, 0x1e, 0x0a, 0x07, 0x65, 0x6e, 0x61, 0x62, 0x6c, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x08, 0x3a, 0x04, 0x74, 0x72, 0x75, 0x65, 0x52, 0x07, 0x65, 0x6e, 0x61, 0x62, 0x6c, 0x65,
+	0x64, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x22, 0x31, 0x0a, 0x05, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05,
+	0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x02, 0x28, 0x09, 0x52, 0x05, 0x65, 0x6d, 0x61,
+	0x69, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0xda, 0x01, 0x0a, 0x07, 0x41, 0x63, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x02, 0x28, 0x03, 0x52, 0x02,
+	0x69, 0x64, 0x12, 0x26, 0x0a, 0x05, 0x6f, 0x77, 0x6e, 0x65, 0x72, 0x18, 0x02, 0x20, 0x02, 0x28,
+	0x0b, 0x32, 0x10, 0x2e, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4f, 0x77,
+	0x6e, 0x65, 0x72, 0x52, 0x05, 0x6f, 0x77, 0x6e, 0x65, 0x72, 0x12, 0x33, 0x0a, 0x0c, 0x62, 0x61,
+	0x63, 0x6b, 0x75, 0x70, 0x5f, 0x6f, 0x77, 0x6e, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x10, 0x2e, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4f, 0x77, 0x6e,
+	0x65, 0x72, 0x52, 0x0b, 0x62, 0x61, 0x63, 0x6b, 0x75, 0x70, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x12,
+	0x2f, 0x0a, 0x08, 0x73, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x73, 0x18, 0x04, 0x20, 0x02, 0x28,
+	0x0b, 0x32, 0x13, 0x2e, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65,
+	0x74, 0x74, 0x69, 0x6e, 0x67, 0x73, 0x52, 0x08, 0x73, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x73,
+	0x12, 0x2a, 0x0a, 0x07, 0x6d, 0x65, 0x6d, 0x62, 0x65, 0x72, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x10, 0x2e, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4f, 0x77,
+	0x6e, 0x65, 0x72, 0x52, 0x07, 0x6d, 0x65, 0x6d, 0x62, 0x65, 0x72, 0x73, 0x2a, 0x05, 0x08, 0x64,
+	0x10, 0xc8, 0x01, 0x3a, 0x3e, 0x0a, 0x07, 0x61, 0x75, 0x64, 0x69, 0x74, 0x6f, 0x72, 0x12, 0x12,
+	0x2e, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x41, 0x63, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x18, 0x64, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x74, 0x65, 0x73, 0x74, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x52, 0x07, 0x61, 0x75, 0x64, 0x69,
+	0x74, 0x6f, 0x72, 0x3a, 0x26, 0x0a, 0x04, 0x6e, 0x6f, 0x74, 0x65, 0x12, 0x12, 0x2e, 0x74, 0x65,
+	0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x41, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18,
+	0x65, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x6f, 0x74, 0x65, 0x42, 0x31, 0x5a, 0x2f, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6d, 0x65, 0x6e, 0x6e, 0x61, 0x6e,
+	0x6f, 0x76, 0x2f, 0x66, 0x6d, 0x75, 0x74, 0x69, 0x6c, 0x73, 0x2f, 0x74, 0x65, 0x73, 0x74, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x3b, 0x74, 0x65, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+}
+
+var (
+	file_testproto2_proto_rawDescOnce sync.Once
+	file_testproto2_proto_rawDescData = file_testproto2_proto_rawDesc
+)
+
+func file_testproto2_proto_rawDescGZIP() []byte {
+	file_testproto2_proto_rawDescOnce.Do(func() {
+		file_testproto2_proto_rawDescData = protoimpl.X.CompressGZIP(file_testproto2_proto_rawDescData)
+	})
+	return file_testproto2_proto_rawDescData
+}
+
+var file_testproto2_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_testproto2_proto_goTypes = []interface{}{
+	(*Settings)(nil), // 0: testproto.Settings
+	(*Owner)(nil),    // 1: testproto.Owner
+	(*Account)(nil),  // 2: testproto.Account
+}
+var file_testproto2_proto_depIdxs = []int32{
+	1, // 0: testproto.Account.owner:type_name -> testproto.Owner
+	1, // 1: testproto.Account.backup_owner:type_name -> testproto.Owner
+	0, // 2: testproto.Account.settings:type_name -> testproto.Settings
+	1, // 3: testproto.Account.members:type_name -> testproto.Owner
+	2, // 4: testproto.auditor:extendee -> testproto.Account
+	2, // 5: testproto.note:extendee -> testproto.Account
+	1, // 6: testproto.auditor:type_name -> testproto.Owner
+	7, // [7:7] is the sub-list for method output_type
+	7, // [7:7] is the sub-list for method input_type
+	6, // [6:7] is the sub-list for extension type_name
+	4, // [4:6] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_testproto2_proto_init() }
+func file_testproto2_proto_init() {
+	if File_testproto2_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_testproto2_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Settings); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_testproto2_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Owner); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_testproto2_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Account); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			case 3:
+				return &v.extensionFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_testproto2_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 2,
+			NumServices:   0,
+		},
+		GoTypes:           file_testproto2_proto_goTypes,
+		DependencyIndexes: file_testproto2_proto_depIdxs,
+		MessageInfos:      file_testproto2_proto_msgTypes,
+		ExtensionInfos:    file_testproto2_proto_extTypes,
+	}.Build()
+	File_testproto2_proto = out.File
+	file_testproto2_proto_rawDesc = nil
+	file_testproto2_proto_goTypes = nil
+	file_testproto2_proto_depIdxs = nil
+}
@@ -0,0 +1,54 @@
+package fmutils
+
+import (
+	"fmt"
+)
+
+// NestedMaskFromTree creates an instance of NestedMask from a nested selection tree, e.g. the one translated from a
+// GraphQL selection set, without flattening it to paths first.
+//
+// The tree keys are the path segments. A nil or true value is a leaf, a false value is not selected and a nested
+// map[string]interface{} is a sub-tree: an empty sub-tree is a leaf as well, while a sub-tree with all the values
+// false is not selected. For example,
+//
+//	map[string]interface{}{"user": map[string]interface{}{"name": true}, "photo": nil}
+//
+// results in the same mask as the "user.name" and "photo" paths. An error is returned for the values of other types
+// and for the empty keys.
+func NestedMaskFromTree(tree map[string]interface{}) (NestedMask, error) {
+	mask := make(NestedMask, len(tree))
+	if err := mask.addTree(tree, ""); err != nil {
+		return nil, err
+	}
+	return mask, nil
+}
+
+// addTree adds the paths of the tree nested under the prefix to the mask.
+func (mask NestedMask) addTree(tree map[string]interface{}, prefix string) error {
+	for key, v := range tree {
+		if key == "" {
+			return fmt.Errorf("fmutils: empty key in the selection tree at %q", prefix)
+		}
+		path := childPath(prefix, key, true)
+		switch v := v.(type) {
+		case nil:
+			mask[key] = NestedMask{}
+		case bool:
+			if v {
+				mask[key] = NestedMask{}
+			}
+		case map[string]interface{}:
+			submask := make(NestedMask, len(v))
+			if err := submask.addTree(v, path); err != nil {
+				return err
+			}
+			// A sub-tree with nothing selected in it must not become a leaf selecting everything.
+			if len(submask) > 0 || len(v) == 0 {
+				mask[key] = submask
+			}
+		default:
+			return fmt.Errorf("fmutils: unexpected value of type %T in the selection tree at %q", v, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestNestedMaskFromTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		tree    map[string]interface{}
+		want    NestedMask
+		wantErr string
+	}{
+		{
+			name: "leaves and sub-trees",
+			tree: map[string]interface{}{
+				"user":             map[string]interface{}{"name": true, "user_id": nil},
+				"photo":            map[string]interface{}{"dimensions": map[string]interface{}{"width": true}},
+				"login_timestamps": nil,
+			},
+			want: NestedMaskFromPaths([]string{"user.name", "user.user_id", "photo.dimensions.width", "login_timestamps"}),
+		},
+		{
+			name: "false values are not selected",
+			tree: map[string]interface{}{
+				"user":    map[string]interface{}{"name": false, "user_id": true},
+				"photo":   false,
+				"gallery": map[string]interface{}{"path": false},
+			},
+			want: NestedMaskFromPaths([]string{"user.user_id"}),
+		},
+		{
+			name: "empty sub-tree is a leaf",
+			tree: map[string]interface{}{"user": map[string]interface{}{}},
+			want: NestedMaskFromPaths([]string{"user"}),
+		},
+		{
+			name: "empty tree",
+			tree: nil,
+			want: NestedMask{},
+		},
+		{
+			name:    "unexpected value type",
+			tree:    map[string]interface{}{"user": map[string]interface{}{"name": "yes"}},
+			wantErr: `fmutils: unexpected value of type string in the selection tree at "user.name"`,
+		},
+		{
+			name:    "empty key",
+			tree:    map[string]interface{}{"user": map[string]interface{}{"": true}},
+			wantErr: `fmutils: empty key in the selection tree at "user"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NestedMaskFromTree(tt.tree)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("NestedMaskFromTree() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NestedMaskFromTree() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	mask, err := NestedMaskFromTree(map[string]interface{}{"user": map[string]interface{}{"name": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &testproto.Profile{User: &testproto.User{UserId: 1, Name: "name"}, Photo: &testproto.Photo{Path: "path"}}
+	mask.Filter(msg)
+	if want := (&testproto.Profile{User: &testproto.User{Name: "name"}}); !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
@@ -0,0 +1,111 @@
+package fmutils
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// TruncateBytes truncates the values of the bytes fields listed in paths to at most maxLen bytes.
+//
+// Repeated bytes fields and maps with bytes values have each of their values truncated.
+// Paths that refer to fields of other kinds are ignored.
+func TruncateBytes(msg proto.Message, paths []string, maxLen int) {
+	if isNil(msg) {
+		return
+	}
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	NestedMaskFromPaths(paths).rangeLeaves(msg.ProtoReflect(), nil, func(rft protoreflect.Message, fd protoreflect.FieldDescriptor) {
+		if fd.IsMap() {
+			if fd.MapValue().Kind() != protoreflect.BytesKind {
+				return
+			}
+			xmap := rft.Mutable(fd).Map()
+			xmap.Range(func(mk protoreflect.MapKey, mv protoreflect.Value) bool {
+				if b := mv.Bytes(); len(b) > maxLen {
+					xmap.Set(mk, protoreflect.ValueOfBytes(truncateBytes(b, maxLen)))
+				}
+				return true
+			})
+			return
+		}
+		if fd.Kind() != protoreflect.BytesKind {
+			return
+		}
+		if fd.IsList() {
+			list := rft.Mutable(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				if b := list.Get(i).Bytes(); len(b) > maxLen {
+					list.Set(i, protoreflect.ValueOfBytes(truncateBytes(b, maxLen)))
+				}
+			}
+		} else if b := rft.Get(fd).Bytes(); len(b) > maxLen {
+			rft.Set(fd, protoreflect.ValueOfBytes(truncateBytes(b, maxLen)))
+		}
+	})
+}
+
+// TruncateRepeated truncates the repeated fields and maps listed in paths to at most max elements.
+//
+// Lists keep their first max elements. Maps keep the entries with the first max keys in ascending order, so the
+// result is deterministic. Paths that refer to singular fields are ignored.
+func TruncateRepeated(msg proto.Message, paths []string, max int) {
+	if isNil(msg) {
+		return
+	}
+	if max < 0 {
+		max = 0
+	}
+	NestedMaskFromPaths(paths).rangeLeaves(msg.ProtoReflect(), nil, func(rft protoreflect.Message, fd protoreflect.FieldDescriptor) {
+		if fd.IsMap() {
+			truncateMap(rft, fd, max)
+		} else if fd.IsList() {
+			if list := rft.Get(fd).List(); list.Len() > max {
+				rft.Mutable(fd).List().Truncate(max)
+				if max == 0 {
+					rft.Clear(fd)
+				}
+			}
+		}
+	})
+}
+
+// TruncateMap keeps at most max entries of the map field located at the path in msg and clears the rest.
+//
+// The entries with the smallest keys are kept so that the result is deterministic: string keys are ordered
+// lexicographically by their bytes, integer keys numerically and bool keys false first. The map field is cleared if
+// max is not positive. The path may refer to a map nested in other messages, e.g. "attributes.a1.tags" or
+// "attributes.*.tags". Paths that refer to other fields are ignored.
+func TruncateMap(msg proto.Message, path string, max int) {
+	if isNil(msg) {
+		return
+	}
+	if max < 0 {
+		max = 0
+	}
+	NestedMaskFromPaths([]string{path}).rangeLeaves(msg.ProtoReflect(), nil, func(rft protoreflect.Message, fd protoreflect.FieldDescriptor) {
+		if fd.IsMap() {
+			truncateMap(rft, fd, max)
+		}
+	})
+}
+
+// truncateMap keeps the entries with the first max keys of the map field fd in ascending order and clears the rest.
+func truncateMap(rft protoreflect.Message, fd protoreflect.FieldDescriptor, max int) {
+	xmap := rft.Get(fd).Map()
+	if xmap.Len() <= max {
+		return
+	}
+	for _, mk := range sortedMapKeys(xmap)[max:] {
+		xmap.Clear(mk)
+	}
+	if xmap.Len() == 0 {
+		rft.Clear(fd)
+	}
+}
+
+// truncateBytes returns a copy of the first maxLen bytes of b so that the rest of b can be garbage collected.
+func truncateBytes(b []byte, maxLen int) []byte {
+	return append([]byte(nil), b[:maxLen]...)
+}
@@ -0,0 +1,252 @@
+package fmutils
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestTruncateBytes(t *testing.T) {
+	tests := []struct {
+		name   string
+		paths  []string
+		maxLen int
+		msg    proto.Message
+		want   proto.Message
+	}{
+		{
+			name:   "top level bytes field",
+			paths:  []string{"data"},
+			maxLen: 2,
+			msg:    &testproto.Result{Data: []byte("abcdef"), NextToken: 1},
+			want:   &testproto.Result{Data: []byte("ab"), NextToken: 1},
+		},
+		{
+			name:   "nested and repeated bytes fields",
+			paths:  []string{"photo.thumbnail", "gallery.thumbnail"},
+			maxLen: 3,
+			msg: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "path", Thumbnail: []byte("abcdef")},
+				Gallery: []*testproto.Photo{
+					{Thumbnail: []byte("ab")},
+					{Thumbnail: []byte("abcd")},
+				},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "path", Thumbnail: []byte("abc")},
+				Gallery: []*testproto.Photo{
+					{Thumbnail: []byte("ab")},
+					{Thumbnail: []byte("abc")},
+				},
+			},
+		},
+		{
+			name:   "wildcard and list index taking precedence over it",
+			paths:  []string{"*.thumbnail", "gallery[1].thumbnail"},
+			maxLen: 1,
+			msg: &testproto.Profile{
+				Photo:   &testproto.Photo{Thumbnail: []byte("abc")},
+				Gallery: []*testproto.Photo{{Thumbnail: []byte("abc")}, {Thumbnail: []byte("abc")}},
+			},
+			want: &testproto.Profile{
+				Photo:   &testproto.Photo{Thumbnail: []byte("a")},
+				Gallery: []*testproto.Photo{{Thumbnail: []byte("abc")}, {Thumbnail: []byte("a")}},
+			},
+		},
+		{
+			name:   "non bytes fields are ignored",
+			paths:  []string{"photo.path", "photo.dimensions", "user"},
+			maxLen: 1,
+			msg: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "path", Thumbnail: []byte("abcdef")},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{Path: "path", Thumbnail: []byte("abcdef")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TruncateBytes(tt.msg, tt.paths, tt.maxLen)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateRepeated(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		max   int
+		msg   proto.Message
+		want  proto.Message
+	}{
+		{
+			name:  "lists longer than the cap",
+			paths: []string{"login_timestamps", "gallery"},
+			max:   2,
+			msg: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2, 3, 4},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2}, {PhotoId: 3}},
+			},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2}},
+			},
+		},
+		{
+			name:  "lists shorter than the cap",
+			paths: []string{"login_timestamps", "gallery"},
+			max:   5,
+			msg: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+			},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2},
+				Gallery:         []*testproto.Photo{{PhotoId: 1}},
+			},
+		},
+		{
+			name:  "maps",
+			paths: []string{"attributes", "photo"},
+			max:   2,
+			msg: &testproto.Profile{
+				Photo: &testproto.Photo{PhotoId: 1},
+				Attributes: map[string]*testproto.Attribute{
+					"c": {}, "a": {}, "b": {},
+				},
+			},
+			want: &testproto.Profile{
+				Photo: &testproto.Photo{PhotoId: 1},
+				Attributes: map[string]*testproto.Attribute{
+					"a": {}, "b": {},
+				},
+			},
+		},
+		{
+			name:  "nested maps",
+			paths: []string{"attributes.a1.tags"},
+			max:   1,
+			msg: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t2": "2", "t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2", "t1": "1"}},
+				},
+			},
+			want: &testproto.Profile{
+				LoginTimestamps: []int64{1, 2},
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t2": "2", "t1": "1"}},
+				},
+			},
+		},
+		{
+			name:  "zero cap",
+			paths: []string{"login_timestamps"},
+			max:   0,
+			msg:   &testproto.Profile{LoginTimestamps: []int64{1, 2}},
+			want:  &testproto.Profile{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TruncateRepeated(tt.msg, tt.paths, tt.max)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateMap(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		max  int
+		msg  proto.Message
+		want proto.Message
+	}{
+		{
+			name: "string keys",
+			path: "attributes",
+			max:  2,
+			msg: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{"b": {}, "a10": {}, "a2": {}, "c": {}},
+			},
+			want: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{"a10": {}, "a2": {}},
+			},
+		},
+		{
+			name: "nested map under a wildcard key",
+			path: "attributes.*.tags",
+			max:  1,
+			msg: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t2": "2", "t1": "1"}},
+					"a2": {Tags: map[string]string{"t3": "3"}},
+				},
+			},
+			want: &testproto.Profile{
+				Attributes: map[string]*testproto.Attribute{
+					"a1": {Tags: map[string]string{"t1": "1"}},
+					"a2": {Tags: map[string]string{"t3": "3"}},
+				},
+			},
+		},
+		{
+			name: "int keys",
+			path: "attributes",
+			max:  2,
+			msg: &testproto.Counters{
+				Attributes: map[int64]*testproto.Attribute{10: {}, -5: {}, 2: {}, 100: {}},
+			},
+			want: &testproto.Counters{
+				Attributes: map[int64]*testproto.Attribute{-5: {}, 2: {}},
+			},
+		},
+		{
+			name: "bool keys",
+			path: "flags",
+			max:  1,
+			msg:  &testproto.Counters{Flags: map[bool]string{true: "on", false: "off"}},
+			want: &testproto.Counters{Flags: map[bool]string{false: "off"}},
+		},
+		{
+			name: "zero max clears the map",
+			path: "flags",
+			max:  0,
+			msg:  &testproto.Counters{Flags: map[bool]string{true: "on"}},
+			want: &testproto.Counters{},
+		},
+		{
+			name: "fewer entries than max",
+			path: "flags",
+			max:  5,
+			msg:  &testproto.Counters{Flags: map[bool]string{true: "on"}},
+			want: &testproto.Counters{Flags: map[bool]string{true: "on"}},
+		},
+		{
+			name: "not a map",
+			path: "login_timestamps",
+			max:  1,
+			msg:  &testproto.Profile{LoginTimestamps: []int64{1, 2}},
+			want: &testproto.Profile{LoginTimestamps: []int64{1, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TruncateMap(tt.msg, tt.path, tt.max)
+			if !proto.Equal(tt.msg, tt.want) {
+				t.Errorf("msg %v, want %v", tt.msg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package fmutils
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// UnmatchedPaths returns the sorted mask paths that don't refer to any populated field of the msg.
+//
+// Such paths have no effect when the mask is applied to the msg, e.g. a Filter keeps nothing for them.
+// A path nested under a repeated message field (or the "*" map key) is matched if it refers to a populated field of
+// at least one of the elements. Likewise, a path nested under the "*" field wildcard is matched if it refers to a
+// populated field of at least one of the fields the wildcard matches. The msg is not modified.
+// Paths that are invalid for the msg type are not reported: use Validate to detect them.
+func (mask NestedMask) UnmatchedPaths(msg proto.Message) []string {
+	if msg == nil {
+		return mask.leafPaths("")
+	}
+	paths := mask.unmatched(msg.ProtoReflect(), "")
+	sort.Strings(paths)
+	return paths
+}
+
+func (mask NestedMask) unmatched(rft protoreflect.Message, prefix string) []string {
+	var paths []string
+	for _, name := range mask.sortedKeys() {
+		path := childPath(prefix, name, true)
+		if name == wildcardKey {
+			paths = append(paths, mask.unmatchedWildcard(rft, path)...)
+			continue
+		}
+		fd := rft.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = extensionField(rft.Descriptor(), name)
+		}
+		if fd != nil {
+			paths = append(paths, mask[name].unmatchedField(rft, fd, path)...)
+		}
+	}
+	return paths
+}
+
+// unmatchedWildcard returns the paths nested under the wildcard "*" of the mask that are unmatched in every rft field
+// the wildcard matches. The fields listed in the mask explicitly are not matched by the wildcard.
+func (mask NestedMask) unmatchedWildcard(rft protoreflect.Message, path string) []string {
+	var fds []protoreflect.FieldDescriptor
+	collect := func(fd protoreflect.FieldDescriptor) {
+		if _, ok := mask[fieldKey(fd)]; ok {
+			return
+		}
+		if _, ok := mask.fieldMask(fd); ok {
+			fds = append(fds, fd)
+		}
+	}
+	fields := rft.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		collect(fields.Get(i))
+	}
+	rft.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if fd.IsExtension() {
+			collect(fd)
+		}
+		return true
+	})
+
+	m := mask[wildcardKey]
+	counts := make(map[string]int)
+	for _, fd := range fds {
+		for _, p := range m.unmatchedField(rft, fd, path) {
+			counts[p]++
+		}
+	}
+	var paths []string
+	for _, p := range m.leafPaths(path) {
+		if counts[p] == len(fds) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// unmatchedField returns the mask paths nested under the field fd of rft that don't refer to any of its populated
+// fields. The mask is the sub-mask of the field located at the path.
+func (mask NestedMask) unmatchedField(rft protoreflect.Message, fd protoreflect.FieldDescriptor, path string) []string {
+	if !rft.Has(fd) {
+		return mask.leafPaths(path)
+	}
+	if len(mask) == 0 {
+		return nil
+	}
+
+	var paths []string
+	if fd.IsMap() {
+		xmap := rft.Get(fd).Map()
+		valueMD := fd.MapValue().Message()
+		for _, key := range mask.sortedKeys() {
+			mi := mask[key]
+			keyPath := childPath(path, key, true)
+			if key == wildcardKey {
+				if valueMD == nil || len(mi) == 0 {
+					continue
+				}
+				var values []protoreflect.Message
+				xmap.Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					values = append(values, mv.Message())
+					return true
+				})
+				paths = append(paths, mi.unmatchedInAll(values, keyPath)...)
+				continue
+			}
+			mk, err := parseMapKey(fd.MapKey(), key)
+			if err != nil {
+				continue
+			}
+			if !xmap.Has(mk) {
+				paths = append(paths, mi.leafPaths(keyPath)...)
+			} else if len(mi) > 0 && valueMD != nil {
+				paths = append(paths, mi.unmatched(xmap.Get(mk).Message(), keyPath)...)
+			}
+		}
+	} else if fd.Message() == nil {
+		return nil
+	} else if fd.IsList() {
+		list := rft.Get(fd).List()
+		fieldsMask, indexes := mask.splitIndexes()
+		if len(fieldsMask) > 0 {
+			elements := make([]protoreflect.Message, list.Len())
+			for i := range elements {
+				elements[i] = list.Get(i).Message()
+			}
+			paths = append(paths, fieldsMask.unmatchedInAll(elements, path)...)
+		}
+		for _, key := range mask.sortedKeys() {
+			i, ok := parseIndex(key)
+			if !ok {
+				continue
+			}
+			indexPath := childPath(path, key, true)
+			if i >= list.Len() {
+				paths = append(paths, indexes[i].leafPaths(indexPath)...)
+			} else if len(indexes[i]) > 0 {
+				paths = append(paths, indexes[i].unmatched(list.Get(i).Message(), indexPath)...)
+			}
+		}
+	} else {
+		paths = append(paths, mask.unmatched(rft.Get(fd).Message(), path)...)
+	}
+	return paths
+}
+
+// unmatchedInAll returns the mask paths that are unmatched in every one of the msgs.
+func (mask NestedMask) unmatchedInAll(msgs []protoreflect.Message, prefix string) []string {
+	counts := make(map[string]int)
+	for _, msg := range msgs {
+		for _, path := range mask.unmatched(msg, prefix) {
+			counts[path]++
+		}
+	}
+	var paths []string
+	for _, path := range mask.leafPaths(prefix) {
+		if counts[path] == len(msgs) && counts[path] > 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// leafPaths returns the sorted paths of all the mask leaves nested under the prefix.
+func (mask NestedMask) leafPaths(prefix string) []string {
+	if len(mask) == 0 {
+		if prefix == "" {
+			return nil
+		}
+		return []string{prefix}
+	}
+	var paths []string
+	for _, name := range mask.sortedKeys() {
+		paths = append(paths, mask[name].leafPaths(childPath(prefix, name, true))...)
+	}
+	return paths
+}
@@ -0,0 +1,122 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestNestedMask_UnmatchedPaths(t *testing.T) {
+	profile := &testproto.Profile{
+		User: &testproto.User{UserId: 1},
+		Gallery: []*testproto.Photo{
+			{PhotoId: 1},
+			{Path: "path"},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"src1": {Tags: map[string]string{"key1": "value1"}},
+			"src2": {},
+		},
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		msg   proto.Message
+		want  []string
+	}{
+		{
+			name:  "all paths matched",
+			paths: []string{"user", "gallery.photo_id", "attributes.src1.tags"},
+			msg:   profile,
+			want:  nil,
+		},
+		{
+			name:  "unset fields are reported",
+			paths: []string{"user.user_id", "user.name", "photo.path", "photo.dimensions.width"},
+			msg:   profile,
+			want:  []string{"photo.dimensions.width", "photo.path", "user.name"},
+		},
+		{
+			name:  "repeated message path matched by any element",
+			paths: []string{"gallery.photo_id", "gallery.path", "gallery.dimensions"},
+			msg:   profile,
+			want:  []string{"gallery.dimensions"},
+		},
+		{
+			name:  "list indexes",
+			paths: []string{"gallery[0].photo_id", "gallery[1].photo_id", "gallery[5]"},
+			msg:   profile,
+			want:  []string{"gallery[1].photo_id", "gallery[5]"},
+		},
+		{
+			name:  "map keys",
+			paths: []string{"attributes.src1.tags", "attributes.src2.tags", "attributes.src3"},
+			msg:   profile,
+			want:  []string{"attributes.src2.tags", "attributes.src3"},
+		},
+		{
+			name:  "map wildcard key",
+			paths: []string{"attributes.*.tags"},
+			msg:   profile,
+			want:  nil,
+		},
+		{
+			name:  "field wildcard",
+			paths: []string{"*.dimensions.width", "photo.dimensions"},
+			msg:   &testproto.Profile{},
+			want:  []string{"*.dimensions.width", "photo.dimensions"},
+		},
+		{
+			name:  "field wildcard matched by one of the fields",
+			paths: []string{"*.path", "*.dimensions.width", "user.name"},
+			msg:   profile,
+			want:  []string{"*.dimensions.width", "user.name"},
+		},
+		{
+			name:  "field wildcard without a sub-mask",
+			paths: []string{"*"},
+			msg:   profile,
+			want:  nil,
+		},
+		{
+			name:  "extensions",
+			paths: []string{"[testproto.note]", "[testproto.auditor].email", "id"},
+			msg: func() proto.Message {
+				account := &testproto.Account{Id: proto.Int64(1)}
+				proto.SetExtension(account, testproto.E_Auditor, &testproto.Owner{Name: proto.String("auditor")})
+				return account
+			}(),
+			want: []string{"[testproto.auditor].email", "[testproto.note]"},
+		},
+		{
+			name:  "invalid paths are not reported",
+			paths: []string{"user.foo", "bar", "login_timestamps"},
+			msg:   profile,
+			want:  []string{"login_timestamps"},
+		},
+		{
+			name:  "nil message",
+			paths: []string{"user.name", "photo"},
+			msg:   nil,
+			want:  []string{"photo", "user.name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before proto.Message
+			if tt.msg != nil {
+				before = proto.Clone(tt.msg)
+			}
+			got := NestedMaskFromPaths(tt.paths).UnmatchedPaths(tt.msg)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmatchedPaths() = %v, want %v", got, tt.want)
+			}
+			if tt.msg != nil && !proto.Equal(tt.msg, before) {
+				t.Errorf("UnmatchedPaths() modified the message: %v", tt.msg)
+			}
+		})
+	}
+}
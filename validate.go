@@ -0,0 +1,419 @@
+package fmutils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Validate checks that all the paths are valid for the given msg type.
+//
+// This is a handy wrapper for NestedMask.Validate method.
+//
+// Empty paths are ignored, so paths holding only empty strings are valid and result in an empty mask. Non-empty
+// paths with empty segments, e.g. "." or "user..name", are invalid.
+func Validate(msg proto.Message, paths []string) error {
+	_, err := validatedMask(msg, paths)
+	return err
+}
+
+// ValidateAndNormalize checks that all the paths are valid for the given msg type and returns them normalized.
+//
+// The normalized paths are sorted and deduplicated, and the paths nested under other paths are dropped since they are
+// covered by their ancestors, e.g. "photo", "user.name", "photo.path" and "user.name" result in "photo" and
+// "user.name". Empty paths are ignored like in Validate. If any of the paths is invalid an error and no paths are
+// returned.
+func ValidateAndNormalize(msg proto.Message, paths []string) ([]string, error) {
+	mask, err := validatedMask(msg, paths)
+	if err != nil {
+		return nil, err
+	}
+	normalized := mask.leafPaths("")
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// FilterE keeps the msg fields that are listed in the paths and clears all the rest.
+//
+// Unlike Filter, the paths are validated first: if any of them is invalid an error is returned and msg is left
+// untouched.
+func FilterE(msg proto.Message, paths []string) error {
+	mask, err := validatedMask(msg, paths)
+	if err != nil {
+		return err
+	}
+	mask.Filter(msg)
+	return nil
+}
+
+// FilterStrict keeps the msg fields that are listed in the paths and clears all the rest, or returns an error
+// without modifying msg if any of the paths is invalid.
+//
+// This is exactly the same operation as FilterE, provided for callers that think in terms of a strict mode.
+func FilterStrict(msg proto.Message, paths []string) error {
+	return FilterE(msg, paths)
+}
+
+// PruneE clears all the fields listed in paths from the given msg.
+//
+// Unlike Prune, the paths are validated first: if any of them is invalid an error is returned and msg is left
+// untouched.
+func PruneE(msg proto.Message, paths []string) error {
+	mask, err := validatedMask(msg, paths)
+	if err != nil {
+		return err
+	}
+	mask.Prune(msg)
+	return nil
+}
+
+// PathError describes an invalid path.
+//
+// It is returned by the functions that validate paths, e.g. Validate, FilterE and PruneE. Use errors.As to
+// inspect it.
+type PathError struct {
+	// Path is the invalid path.
+	Path string
+	// Field is the path segment that makes the path invalid, e.g. an unknown field name or a malformed map key.
+	Field string
+	// Reason describes why the path is invalid.
+	Reason string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("fmutils: invalid path %q: %s", e.Path, e.Reason)
+}
+
+// PathErrors is a list of invalid paths returned by ValidateAll.
+type PathErrors []*PathError
+
+func (e PathErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidateAll checks that all the paths are valid for the given msg type.
+//
+// This is a handy wrapper for NestedMask.ValidateAll method.
+func ValidateAll(msg proto.Message, paths []string) error {
+	errs := syntaxErrors(paths)
+	err := NestedMaskFromPaths(paths).ValidateAll(msg)
+	if len(errs) == 0 {
+		return err
+	}
+	pathErrs, ok := err.(PathErrors)
+	if err != nil && !ok {
+		return err
+	}
+	return append(PathErrors(errs), pathErrs...)
+}
+
+// validatedMask creates the mask for the paths and validates it for the given msg type.
+func validatedMask(msg proto.Message, paths []string) (NestedMask, error) {
+	if errs := syntaxErrors(paths); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	mask := NestedMaskFromPaths(paths)
+	if err := mask.Validate(msg); err != nil {
+		return nil, err
+	}
+	return mask, nil
+}
+
+// syntaxErrors returns an error for every non-empty path that has an empty segment.
+func syntaxErrors(paths []string) []*PathError {
+	var errs []*PathError
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		for _, segment := range strings.Split(path, ".") {
+			if segment == "" {
+				errs = append(errs, &PathError{Path: path, Reason: "path has an empty segment"})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// Validate checks that all the mask paths are valid for the given msg type.
+//
+// Every path segment must be a field of the message it is nested in, a map field may only be followed by a key
+// that is valid for the map key type (or the "*" wildcard), a repeated field may be followed by an index in square
+// brackets, and only message fields (or message map values) may have nested fields.
+// The error for the first invalid path is a *PathError.
+// Only the msg type is inspected, so a typed nil msg is fine.
+func (mask NestedMask) Validate(msg proto.Message) error {
+	if msg == nil {
+		return errors.New("fmutils: can't validate paths against a nil message")
+	}
+	if errs := mask.validate(msg.ProtoReflect().Descriptor(), "", nil, ValidateOptions{}); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll works like NestedMask.Validate but reports all the invalid paths instead of the first one.
+//
+// The returned error is PathErrors listing the invalid paths in a deterministic order if any of the paths is
+// invalid.
+func (mask NestedMask) ValidateAll(msg proto.Message) error {
+	if msg == nil {
+		return errors.New("fmutils: can't validate paths against a nil message")
+	}
+	if errs := mask.validate(msg.ProtoReflect().Descriptor(), "", nil, ValidateOptions{}); len(errs) > 0 {
+		return PathErrors(errs)
+	}
+	return nil
+}
+
+// ValidateOptions configures the additional checks of NestedMask.ValidateWithOptions.
+type ValidateOptions struct {
+	// RejectOneofConflicts makes a mask listing several members of the same oneof in the same message invalid since
+	// they can't be set at the same time and applying such a mask, e.g. with Overwrite, is ambiguous.
+	RejectOneofConflicts bool
+}
+
+// ValidateWithOptions checks that all the paths are valid for the given msg type with the additional checks
+// enabled in the opts.
+//
+// This is a handy wrapper for NestedMask.ValidateWithOptions method.
+func ValidateWithOptions(msg proto.Message, paths []string, opts ValidateOptions) error {
+	if errs := syntaxErrors(paths); len(errs) > 0 {
+		return errs[0]
+	}
+	return NestedMaskFromPaths(paths).ValidateWithOptions(msg, opts)
+}
+
+// ValidateWithOptions works like NestedMask.Validate and performs the additional checks enabled in the opts.
+func (mask NestedMask) ValidateWithOptions(msg proto.Message, opts ValidateOptions) error {
+	if msg == nil {
+		return errors.New("fmutils: can't validate paths against a nil message")
+	}
+	if errs := mask.validate(msg.ProtoReflect().Descriptor(), "", nil, opts); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// oneofConflicts appends an error for every mask field that is a member of the same md oneof as a previous one.
+func (mask NestedMask) oneofConflicts(md protoreflect.MessageDescriptor, prefix string, errs []*PathError) []*PathError {
+	var listed map[protoreflect.FullName]string
+	for _, name := range mask.sortedKeys() {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			continue
+		}
+		od := fd.ContainingOneof()
+		if od == nil || od.IsSynthetic() {
+			continue
+		}
+		if first, ok := listed[od.FullName()]; ok {
+			errs = append(errs, &PathError{
+				Path:  childPath(prefix, name, true),
+				Field: name,
+				Reason: fmt.Sprintf("fields %q and %q are members of the same oneof %q and can't be set together",
+					first, name, od.Name()),
+			})
+			continue
+		}
+		if listed == nil {
+			listed = make(map[protoreflect.FullName]string)
+		}
+		listed[od.FullName()] = name
+	}
+	return errs
+}
+
+// validate appends an error for every invalid mask path to errs.
+func (mask NestedMask) validate(md protoreflect.MessageDescriptor, prefix string, errs []*PathError, opts ValidateOptions) []*PathError {
+	mask = mask.structMask(md)
+	if opts.RejectOneofConflicts {
+		errs = mask.oneofConflicts(md, prefix, errs)
+	}
+	for _, name := range mask.sortedKeys() {
+		submask := mask[name]
+		path := childPath(prefix, name, true)
+		if name == wildcardKey {
+			errs = submask.validateWildcard(md, path, errs, opts)
+			continue
+		}
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = extensionField(md, name)
+		}
+		if fd == nil {
+			errs = append(errs, &PathError{
+				Path:   path,
+				Field:  name,
+				Reason: fmt.Sprintf("message %s has no field %q", md.FullName(), name),
+			})
+			continue
+		}
+		if len(submask) == 0 {
+			continue
+		}
+
+		if fd.IsMap() {
+			for _, key := range submask.sortedKeys() {
+				keyPath := childPath(path, key, true)
+				if _, err := parseMapKey(fd.MapKey(), key); err != nil && key != wildcardKey {
+					errs = append(errs, &PathError{
+						Path:   keyPath,
+						Field:  key,
+						Reason: fmt.Sprintf("%q is not a valid %s key of map field %q", key, fd.MapKey().Kind(), path),
+					})
+					continue
+				}
+				valueMask := submask[key]
+				if len(valueMask) == 0 {
+					continue
+				}
+				if fd.MapValue().Message() == nil {
+					errs = append(errs, valueMask.scalarErrors(keyPath, fd.MapValue())...)
+					continue
+				}
+				errs = valueMask.validate(fd.MapValue().Message(), keyPath, errs, opts)
+			}
+			continue
+		}
+		if fd.IsList() {
+			fieldsMask, indexes := submask.splitIndexes()
+			for _, key := range submask.sortedKeys() {
+				i, ok := parseIndex(key)
+				if !ok || len(indexes[i]) == 0 {
+					continue
+				}
+				indexPath := path + key
+				if fd.Message() == nil {
+					errs = append(errs, indexes[i].scalarErrors(indexPath, fd)...)
+					continue
+				}
+				errs = indexes[i].validate(fd.Message(), indexPath, errs, opts)
+			}
+			submask = fieldsMask
+			if len(submask) == 0 {
+				continue
+			}
+		}
+		if fd.Message() == nil {
+			errs = append(errs, submask.scalarErrors(path, fd)...)
+			continue
+		}
+		errs = submask.validate(fd.Message(), path, errs, opts)
+	}
+	return errs
+}
+
+// validateWildcard appends an error for every invalid path of the mask nested under the wildcard field of md.
+//
+// The mask is validated against the messages of all the fields the wildcard matches, and it is invalid if the
+// wildcard doesn't match any field.
+func (mask NestedMask) validateWildcard(md protoreflect.MessageDescriptor, path string, errs []*PathError, opts ValidateOptions) []*PathError {
+	if len(mask) == 0 {
+		return errs
+	}
+	validated := make(map[protoreflect.FullName]bool)
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.IsMap() || fd.Message() == nil || validated[fd.Message().FullName()] || !mask.appliesTo(fd.Message()) {
+			continue
+		}
+		validated[fd.Message().FullName()] = true
+		errs = mask.validate(fd.Message(), path, errs, opts)
+	}
+	if len(validated) == 0 {
+		errs = append(errs, &PathError{
+			Path:   path,
+			Field:  wildcardKey,
+			Reason: fmt.Sprintf("no field of message %s matches the wildcard", md.FullName()),
+		})
+	}
+	return errs
+}
+
+// extensionField returns the descriptor of the extension of md with the mask key name, e.g. "[testproto.auditor]",
+// or nil if there is no such extension in protoregistry.GlobalTypes.
+func extensionField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if len(name) < 3 || name[0] != '[' || name[len(name)-1] != ']' {
+		return nil
+	}
+	xt, err := protoregistry.GlobalTypes.FindExtensionByName(protoreflect.FullName(name[1 : len(name)-1]))
+	if err != nil || xt.TypeDescriptor().ContainingMessage().FullName() != md.FullName() {
+		return nil
+	}
+	return xt.TypeDescriptor()
+}
+
+// scalarErrors returns the errors for the mask nested under the scalar field fd located at the given path.
+func (mask NestedMask) scalarErrors(path string, fd protoreflect.FieldDescriptor) []*PathError {
+	errs := make([]*PathError, 0, len(mask))
+	for _, name := range mask.sortedKeys() {
+		errs = append(errs, &PathError{
+			Path:   childPath(path, name, true),
+			Field:  name,
+			Reason: fmt.Sprintf("%q is a %s field and has no nested fields", path, fd.Kind()),
+		})
+	}
+	return errs
+}
+
+// sortedKeys returns the mask keys in a deterministic order.
+func (mask NestedMask) sortedKeys() []string {
+	keys := make([]string, 0, len(mask))
+	for k := range mask {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseMapKey parses the path segment s as a key of a map with the given key descriptor.
+func parseMapKey(fd protoreflect.FieldDescriptor, s string) (protoreflect.MapKey, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s).MapKey(), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		return protoreflect.ValueOfBool(v).MapKey(), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		return protoreflect.ValueOfInt32(int32(v)).MapKey(), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		return protoreflect.ValueOfInt64(v).MapKey(), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		return protoreflect.ValueOfUint32(uint32(v)).MapKey(), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		return protoreflect.ValueOfUint64(v).MapKey(), nil
+	}
+	return protoreflect.MapKey{}, fmt.Errorf("unsupported map key kind %s", fd.Kind())
+}
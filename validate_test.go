@@ -0,0 +1,417 @@
+package fmutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		msg     proto.Message
+		wantErr string
+	}{
+		{
+			name:  "valid paths",
+			paths: []string{"user.name", "photo.dimensions.width", "gallery.path", "attributes.a1.tags.t1"},
+			msg:   &testproto.Profile{},
+		},
+		{
+			name:  "valid oneof paths",
+			paths: []string{"user.name", "profile.photo"},
+			msg:   &testproto.Event{},
+		},
+		{
+			name:  "typed nil message",
+			paths: []string{"user.name"},
+			msg:   (*testproto.Profile)(nil),
+		},
+		{
+			name:  "valid list index paths",
+			paths: []string{"login_timestamps[2]", "gallery[0].path", "gallery.photo_id"},
+			msg:   &testproto.Profile{},
+		},
+		{
+			name:    "nested field under scalar list index",
+			paths:   []string{"login_timestamps[2].foo"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "login_timestamps[2].foo": "login_timestamps[2]" is a int64 field`,
+		},
+		{
+			name:    "unknown field under message list index",
+			paths:   []string{"gallery[1].foo"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "gallery[1].foo": message testproto.Photo has no field "foo"`,
+		},
+		{
+			name:  "valid map wildcard key",
+			paths: []string{"attributes.*.tags.secret"},
+			msg:   &testproto.Profile{},
+		},
+		{
+			name:  "valid field wildcards",
+			paths: []string{"*.dimensions.width", "photo.*", "*.*.height"},
+			msg:   &testproto.Profile{},
+		},
+		{
+			name:    "unknown field under field wildcard",
+			paths:   []string{"*.dimensions.foo"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "*.dimensions.foo": message testproto.Dimensions has no field "foo"`,
+		},
+		{
+			name:    "field wildcard without matching fields",
+			paths:   []string{"*.foo"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "*": no field of message testproto.Profile matches the wildcard`,
+		},
+		{
+			name:  "empty path",
+			paths: []string{""},
+			msg:   &testproto.Profile{},
+		},
+		{
+			name:  "several empty paths",
+			paths: []string{"", ""},
+			msg:   &testproto.Profile{},
+		},
+		{
+			name:    "dot path",
+			paths:   []string{"user.name", "."},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path ".": path has an empty segment`,
+		},
+		{
+			name:    "path with an empty segment",
+			paths:   []string{"user..name"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "user..name": path has an empty segment`,
+		},
+		{
+			name:    "path with a trailing dot",
+			paths:   []string{"user."},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "user.": path has an empty segment`,
+		},
+		{
+			name:    "nil message",
+			paths:   []string{"user.name"},
+			msg:     nil,
+			wantErr: "nil message",
+		},
+		{
+			name:    "unknown field",
+			paths:   []string{"user.name", "photo.dimension"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "photo.dimension": message testproto.Photo has no field "dimension"`,
+		},
+		{
+			name:    "nested field under scalar field",
+			paths:   []string{"user.name.foo"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "user.name.foo": "user.name" is a string field`,
+		},
+		{
+			name:    "nested field under repeated scalar field",
+			paths:   []string{"login_timestamps.foo"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "login_timestamps.foo": "login_timestamps" is a int64 field`,
+		},
+		{
+			name:    "nested field under scalar map value",
+			paths:   []string{"attributes.a1.tags.t1.foo"},
+			msg:     &testproto.Profile{},
+			wantErr: `invalid path "attributes.a1.tags.t1.foo": "attributes.a1.tags.t1" is a string field`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.msg, tt.paths)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterE(t *testing.T) {
+	msg := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+			Name:   "user name",
+		},
+		Photo: &testproto.Photo{
+			PhotoId: 2,
+		},
+	}
+	want := proto.Clone(msg)
+	err := FilterE(msg, []string{"photo", "user.name.foo"})
+	if err == nil || !strings.Contains(err.Error(), `"user.name" is a string field`) {
+		t.Errorf("error %v, want scalar field error", err)
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+
+	if err := FilterE(msg, []string{"user.name"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = &testproto.Profile{User: &testproto.User{Name: "user name"}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
+
+func TestFilterStrict(t *testing.T) {
+	msg := &testproto.Profile{
+		User:  &testproto.User{UserId: 1, Name: "user name"},
+		Photo: &testproto.Photo{PhotoId: 2},
+	}
+	want := proto.Clone(msg)
+	err := FilterStrict(msg, []string{"user.name", "photo.pth"})
+	if pathErr, ok := err.(*PathError); !ok || pathErr.Path != "photo.pth" {
+		t.Errorf("error %v, want a *PathError for %q", err, "photo.pth")
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+
+	if err := FilterStrict(msg, []string{"user.name", "photo"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = &testproto.Profile{User: &testproto.User{Name: "user name"}, Photo: &testproto.Photo{PhotoId: 2}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
+
+func TestPruneE(t *testing.T) {
+	msg := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+			Name:   "user name",
+		},
+		Photo: &testproto.Photo{
+			PhotoId: 2,
+		},
+	}
+	want := proto.Clone(msg)
+	err := PruneE(msg, []string{"photo", "user.name.foo"})
+	if err == nil || !strings.Contains(err.Error(), `"user.name" is a string field`) {
+		t.Errorf("error %v, want scalar field error", err)
+	}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+
+	if err := PruneE(msg, []string{"user.name"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = &testproto.Profile{User: &testproto.User{UserId: 1}, Photo: &testproto.Photo{PhotoId: 2}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+
+	msg = &testproto.Profile{Gallery: []*testproto.Photo{{PhotoId: 1, Path: "path1"}, {PhotoId: 2, Path: "path2"}}}
+	if err := PruneE(msg, []string{"gallery[0].path"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = &testproto.Profile{Gallery: []*testproto.Photo{{PhotoId: 1}, {PhotoId: 2, Path: "path2"}}}
+	if !proto.Equal(msg, want) {
+		t.Errorf("msg %v, want %v", msg, want)
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	err := ValidateAll(&testproto.Profile{}, []string{
+		"user.name", "user.foo", "photo.path.bar", "attributes.a1.tags.t1.baz", "bar",
+	})
+	pathErrs, ok := err.(PathErrors)
+	if !ok {
+		t.Fatalf("error %v, want PathErrors", err)
+	}
+	want := PathErrors{
+		{
+			Path:   "attributes.a1.tags.t1.baz",
+			Field:  "baz",
+			Reason: `"attributes.a1.tags.t1" is a string field and has no nested fields`,
+		},
+		{
+			Path:   "bar",
+			Field:  "bar",
+			Reason: `message testproto.Profile has no field "bar"`,
+		},
+		{
+			Path:   "photo.path.bar",
+			Field:  "bar",
+			Reason: `"photo.path" is a string field and has no nested fields`,
+		},
+		{
+			Path:   "user.foo",
+			Field:  "foo",
+			Reason: `message testproto.User has no field "foo"`,
+		},
+	}
+	if !reflect.DeepEqual(pathErrs, want) {
+		t.Errorf("ValidateAll() = %v, want %v", pathErrs, want)
+	}
+
+	err = ValidateAll(&testproto.Profile{}, []string{"user.name", ".", "foo"})
+	if got, want := err.Error(), `fmutils: invalid path ".": path has an empty segment; `+
+		`fmutils: invalid path "foo": message testproto.Profile has no field "foo"`; got != want {
+		t.Errorf("ValidateAll() = %q, want %q", got, want)
+	}
+
+	if err := ValidateAll(&testproto.Profile{}, []string{"user.name", "gallery[1].path", ""}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPathError(t *testing.T) {
+	err := FilterE(&testproto.Profile{}, []string{"attributes.a1", "login_timestamps.foo"})
+	pathErr, ok := err.(*PathError)
+	if !ok {
+		t.Fatalf("error %v, want *PathError", err)
+	}
+	want := &PathError{
+		Path:   "login_timestamps.foo",
+		Field:  "foo",
+		Reason: `"login_timestamps" is a int64 field and has no nested fields`,
+	}
+	if !reflect.DeepEqual(pathErr, want) {
+		t.Errorf("error %+v, want %+v", pathErr, want)
+	}
+	if got, want := err.Error(), `fmutils: invalid path "login_timestamps.foo": "login_timestamps" is a int64 field and has no nested fields`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateWithOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		msg     proto.Message
+		opts    ValidateOptions
+		wantErr string
+	}{
+		{
+			name:  "oneof conflicts are allowed by default",
+			paths: []string{"user", "photo.path"},
+			msg:   &testproto.Event{},
+		},
+		{
+			name:    "oneof conflict",
+			paths:   []string{"user", "photo.path", "event_id"},
+			msg:     &testproto.Event{},
+			opts:    ValidateOptions{RejectOneofConflicts: true},
+			wantErr: `invalid path "user": fields "photo" and "user" are members of the same oneof "changed"`,
+		},
+		{
+			name:    "oneof name is not a field",
+			paths:   []string{"changed.profile.user", "changed.status"},
+			msg:     &testproto.Event{},
+			opts:    ValidateOptions{RejectOneofConflicts: true},
+			wantErr: `message testproto.Event has no field "changed"`,
+		},
+		{
+			name:  "single oneof member",
+			paths: []string{"user.name", "user.user_id", "payloads"},
+			msg:   &testproto.Event{},
+			opts:  ValidateOptions{RejectOneofConflicts: true},
+		},
+		{
+			name:  "proto3 optional fields are not oneof members",
+			paths: []string{"optional_string", "optional_int"},
+			msg:   &testproto.Options{},
+			opts:  ValidateOptions{RejectOneofConflicts: true},
+		},
+		{
+			name:    "invalid path",
+			paths:   []string{"user..name"},
+			msg:     &testproto.Event{},
+			opts:    ValidateOptions{RejectOneofConflicts: true},
+			wantErr: "path has an empty segment",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWithOptions(tt.msg, tt.paths, tt.opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "redundant and duplicate paths",
+			paths: []string{"user.name", "photo.path", "photo", "user.name", "", "photo.dimensions.width"},
+			want:  []string{"photo", "user.name"},
+		},
+		{
+			name:  "map keys and list indexes",
+			paths: []string{"gallery[1].path", "attributes.a1.tags", "attributes.a1", "gallery[0]"},
+			want:  []string{"attributes.a1", "gallery[0]", "gallery[1].path"},
+		},
+		{
+			name:  "empty paths",
+			paths: []string{""},
+			want:  nil,
+		},
+		{
+			name:    "invalid path",
+			paths:   []string{"user.name", "user.foo"},
+			wantErr: `fmutils: invalid path "user.foo": message testproto.User has no field "foo"`,
+		},
+		{
+			name:    "empty segment",
+			paths:   []string{"user..name"},
+			wantErr: `fmutils: invalid path "user..name": path has an empty segment`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateAndNormalize(&testproto.Profile{}, tt.paths)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("ValidateAndNormalize() error = %v, want %q", err, tt.wantErr)
+				}
+				if got != nil {
+					t.Errorf("ValidateAndNormalize() = %v, want no paths", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateAndNormalize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
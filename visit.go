@@ -0,0 +1,88 @@
+package fmutils
+
+import (
+	"sort"
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Visit calls the visitor for every populated field of the msg and descends into the field if the visitor returns
+// true.
+//
+// Fields are visited depth-first in the order of their names. The visitor is called with the path of the field,
+// its descriptor and its value. Descending into a message field visits its populated fields, descending into a
+// repeated field visits its elements in order and descending into a map field visits its entries sorted by key.
+// An element is visited with the descriptor of the repeated field and the path of the repeated field followed by
+// the element index in square brackets, e.g. "gallery[1]". A map entry is visited with the map value descriptor and
+// the path of the map field followed by the key, e.g. "attributes.a1". These are the same path formats the
+// NestedMask paths use, so the paths may be used in masks.
+// The msg must not be modified by the visitor.
+func Visit(msg proto.Message, visitor func(path string, fd protoreflect.FieldDescriptor, v protoreflect.Value) bool) {
+	if isNil(msg) {
+		return
+	}
+	visitFields(msg.ProtoReflect(), "", visitor)
+}
+
+func visitFields(rft protoreflect.Message, prefix string, visitor func(string, protoreflect.FieldDescriptor, protoreflect.Value) bool) {
+	for _, n := range walkFields(rft, prefix) {
+		if visitor(n.path, n.fd, n.v) {
+			visitValue(n.path, n.fd, n.v, visitor)
+		}
+	}
+}
+
+// visitValue visits the values nested in the value v of the field fd located at the path.
+func visitValue(path string, fd protoreflect.FieldDescriptor, v protoreflect.Value, visitor func(string, protoreflect.FieldDescriptor, protoreflect.Value) bool) {
+	switch {
+	case fd.IsMap():
+		xmap := v.Map()
+		valueFD := fd.MapValue()
+		for _, mk := range sortedMapKeys(xmap) {
+			mv := xmap.Get(mk)
+			keyPath := childPath(path, mk.String(), true)
+			if visitor(keyPath, valueFD, mv) && valueFD.Message() != nil {
+				visitFields(mv.Message(), keyPath, visitor)
+			}
+		}
+	case fd.IsList():
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			item := list.Get(i)
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			if visitor(itemPath, fd, item) && fd.Message() != nil {
+				visitFields(item.Message(), itemPath, visitor)
+			}
+		}
+	case fd.Message() != nil:
+		visitFields(v.Message(), path, visitor)
+	}
+}
+
+// sortedMapKeys returns the keys of the xmap in ascending order.
+func sortedMapKeys(xmap protoreflect.Map) []protoreflect.MapKey {
+	keys := make([]protoreflect.MapKey, 0, xmap.Len())
+	xmap.Range(func(mk protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, mk)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return mapKeyLess(keys[i], keys[j])
+	})
+	return keys
+}
+
+// mapKeyLess reports whether the map key a sorts before the map key b of the same kind.
+func mapKeyLess(a, b protoreflect.MapKey) bool {
+	switch x := a.Interface().(type) {
+	case bool:
+		return !x && b.Bool()
+	case int32, int64:
+		return a.Int() < b.Int()
+	case uint32, uint64:
+		return a.Uint() < b.Uint()
+	}
+	return a.String() < b.String()
+}
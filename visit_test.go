@@ -0,0 +1,91 @@
+package fmutils
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestVisit(t *testing.T) {
+	msg := &testproto.Profile{
+		User:            &testproto.User{UserId: 1, Name: "name"},
+		Photo:           &testproto.Photo{Dimensions: &testproto.Dimensions{Width: 100}},
+		LoginTimestamps: []int64{1, 2},
+		Gallery: []*testproto.Photo{
+			{Path: "path 0"},
+			{PhotoId: 1},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a2": {Tags: map[string]string{"t2": "v2", "t1": "v1"}},
+			"a1": {},
+		},
+	}
+	tests := []struct {
+		name string
+		skip map[string]bool
+		want []string
+	}{
+		{
+			name: "descend into everything",
+			want: []string{
+				"attributes", "attributes.a1", "attributes.a2", "attributes.a2.tags", "attributes.a2.tags.t1",
+				"attributes.a2.tags.t2", "gallery", "gallery[0]", "gallery[0].path", "gallery[1]", "gallery[1].photo_id",
+				"login_timestamps", "login_timestamps[0]", "login_timestamps[1]", "photo", "photo.dimensions",
+				"photo.dimensions.width", "user", "user.name", "user.user_id",
+			},
+		},
+		{
+			name: "skip some fields",
+			skip: map[string]bool{"attributes.a2": true, "gallery": true, "login_timestamps": true, "photo": true},
+			want: []string{
+				"attributes", "attributes.a1", "attributes.a2", "gallery", "login_timestamps", "photo", "user",
+				"user.name", "user.user_id",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			Visit(msg, func(path string, _ protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+				got = append(got, path)
+				return !tt.skip[path]
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paths %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisit_ValuesAndDescriptors(t *testing.T) {
+	msg := &testproto.Profile{
+		Gallery: []*testproto.Photo{{PhotoId: 1}},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {Tags: map[string]string{"t1": "v1"}},
+		},
+	}
+	got := make(map[string]string)
+	Visit(msg, func(path string, fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Message() == nil {
+			got[path] = string(fd.FullName()) + "=" + v.String()
+		} else {
+			got[path] = string(fd.FullName())
+		}
+		return true
+	})
+	want := map[string]string{
+		"attributes":            "testproto.Profile.attributes",
+		"attributes.a1":         "testproto.Profile.AttributesEntry.value",
+		"attributes.a1.tags":    "testproto.Attribute.tags",
+		"attributes.a1.tags.t1": "testproto.Attribute.TagsEntry.value=v1",
+		"gallery":               "testproto.Profile.gallery",
+		"gallery[0]":            "testproto.Profile.gallery",
+		"gallery[0].photo_id":   "testproto.Photo.photo_id=1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,187 @@
+package fmutils
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Walk calls fn for every populated leaf field of the msg with the dotted path of that field.
+//
+// Scalar, repeated scalar and map fields are leaves. Message fields are walked recursively and are only reported
+// as leaves if none of their fields are populated. The elements of a repeated message field are walked one by one
+// using the path of the repeated field as a prefix, so the same path may be reported several times.
+// Extensions are reported by their full names in square brackets, e.g. "[testproto.auditor].email", like in the mask
+// paths. Fields are walked depth-first in the order of their names.
+func Walk(msg proto.Message, fn func(path string, fd protoreflect.FieldDescriptor, v protoreflect.Value)) {
+	WalkWithOptions(msg, WalkOptions{LeavesOnly: true}, fn)
+}
+
+// TraversalOrder defines the order in which WalkWithOptions visits the fields.
+type TraversalOrder int
+
+const (
+	// DepthFirst visits all the fields nested in a field before moving on to its next sibling.
+	DepthFirst TraversalOrder = iota
+	// BreadthFirst visits all the fields of a message before any of the fields nested in them.
+	BreadthFirst
+)
+
+// WalkOptions configures how WalkWithOptions walks the message.
+type WalkOptions struct {
+	// LeavesOnly makes only the leaf fields reported as defined by Walk. Otherwise all the populated fields are
+	// reported including the intermediate message fields, e.g. "photo", "photo.dimensions" and
+	// "photo.dimensions.width". A repeated message field is reported once and its elements are not reported.
+	LeavesOnly bool
+	// Order is the order in which the fields are visited. Sibling fields are always visited in the order of their
+	// names, so the result is deterministic.
+	Order TraversalOrder
+}
+
+// WalkWithOptions works like Walk and allows tuning the reported fields and their order with the opts.
+func WalkWithOptions(msg proto.Message, opts WalkOptions, fn func(path string, fd protoreflect.FieldDescriptor, v protoreflect.Value)) {
+	if isNil(msg) {
+		return
+	}
+	nodes := walkFields(msg.ProtoReflect(), "")
+	if opts.Order == BreadthFirst {
+		for len(nodes) > 0 {
+			n := nodes[0]
+			nodes = nodes[1:]
+			children := n.children()
+			n.visit(children, opts.LeavesOnly, fn)
+			nodes = append(nodes, children...)
+		}
+		return
+	}
+	walkDepthFirst(nodes, opts.LeavesOnly, fn)
+}
+
+func walkDepthFirst(nodes []walkNode, leavesOnly bool, fn func(string, protoreflect.FieldDescriptor, protoreflect.Value)) {
+	for _, n := range nodes {
+		children := n.children()
+		n.visit(children, leavesOnly, fn)
+		walkDepthFirst(children, leavesOnly, fn)
+	}
+}
+
+// walkNode is a populated field or an element of a populated repeated message field visited by WalkWithOptions.
+type walkNode struct {
+	path    string
+	fd      protoreflect.FieldDescriptor
+	v       protoreflect.Value
+	element bool
+}
+
+// children returns the nodes nested in the node.
+func (n walkNode) children() []walkNode {
+	if n.fd.IsMap() || n.fd.Message() == nil {
+		return nil
+	}
+	if n.fd.IsList() && !n.element {
+		list := n.v.List()
+		nodes := make([]walkNode, list.Len())
+		for i := range nodes {
+			nodes[i] = walkNode{path: n.path, fd: n.fd, v: list.Get(i), element: true}
+		}
+		return nodes
+	}
+	return walkFields(n.v.Message(), n.path)
+}
+
+// visit calls fn for the node if it should be reported.
+func (n walkNode) visit(children []walkNode, leavesOnly bool, fn func(string, protoreflect.FieldDescriptor, protoreflect.Value)) {
+	if leavesOnly && len(children) == 0 || !leavesOnly && !n.element {
+		fn(n.path, n.fd, n.v)
+	}
+}
+
+// walkFields returns the nodes of the populated rft fields sorted by their mask keys, so the extensions are listed
+// by their full names in square brackets.
+func walkFields(rft protoreflect.Message, prefix string) []walkNode {
+	var nodes []walkNode
+	rft.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		nodes = append(nodes, walkNode{path: childPath(prefix, fieldKey(fd), true), fd: fd, v: v})
+		return true
+	})
+	sort.Slice(nodes, func(i, j int) bool {
+		return fieldKey(nodes[i].fd) < fieldKey(nodes[j].fd)
+	})
+	return nodes
+}
+
+// UnionSetPaths returns the sorted union of the populated leaf field paths of all the msgs.
+//
+// See Walk for the definition of a populated leaf field path.
+// All the msgs must be of the same type, otherwise an error is returned.
+func UnionSetPaths(msgs ...proto.Message) ([]string, error) {
+	set := make(map[string]struct{})
+	var name protoreflect.FullName
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		msgName := msg.ProtoReflect().Descriptor().FullName()
+		if name == "" {
+			name = msgName
+		} else if name != msgName {
+			return nil, fmt.Errorf("fmutils: can't union paths of different message types %s and %s", name, msgName)
+		}
+		Walk(msg, func(path string, _ protoreflect.FieldDescriptor, _ protoreflect.Value) {
+			set[path] = struct{}{}
+		})
+	}
+
+	paths := make([]string, 0, len(set))
+	for path := range set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// AllPaths returns the sorted paths of all the leaf fields a message of the msg type may have.
+//
+// Unlike Walk, only the msg type is inspected, so a typed nil msg is fine. Singular message fields are descended
+// into, and are leaves only if their message has no fields or is already being descended into, which stops the
+// recursion of self-referential types, e.g. a "next" field of a linked list node. Scalar, repeated and map fields are
+// leaves: the paths of their elements depend on the indexes and keys of a particular message.
+func AllPaths(msg proto.Message) []string {
+	if msg == nil {
+		return nil
+	}
+	paths := allPaths(msg.ProtoReflect().Descriptor(), "", nil, nil)
+	sort.Strings(paths)
+	return paths
+}
+
+// allPaths appends the leaf paths of the md fields to paths.
+//
+// The parents are the messages the md is nested in.
+func allPaths(md protoreflect.MessageDescriptor, prefix string, parents []protoreflect.FullName, paths []string) []string {
+	parents = append(parents, md.FullName())
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := childPath(prefix, fieldKey(fd), true)
+		if fd.IsList() || fd.IsMap() || fd.Message() == nil || fd.Message().Fields().Len() == 0 ||
+			containsName(parents, fd.Message().FullName()) {
+			paths = append(paths, path)
+			continue
+		}
+		paths = allPaths(fd.Message(), path, parents, paths)
+	}
+	return paths
+}
+
+// containsName reports whether the names contain the name.
+func containsName(names []protoreflect.FullName, name protoreflect.FullName) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package fmutils
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/mennanov/fmutils/testproto"
+)
+
+func TestWalk(t *testing.T) {
+	msg := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+			Name:   "user name",
+		},
+		Photo:           &testproto.Photo{},
+		LoginTimestamps: []int64{1, 2},
+		Gallery: []*testproto.Photo{
+			{Path: "path 1"},
+			{Path: "path 2", Dimensions: &testproto.Dimensions{Width: 100}},
+		},
+		Attributes: map[string]*testproto.Attribute{
+			"a1": {},
+		},
+	}
+	var got []string
+	Walk(msg, func(path string, _ protoreflect.FieldDescriptor, _ protoreflect.Value) {
+		got = append(got, path)
+	})
+	sort.Strings(got)
+	want := []string{
+		"attributes",
+		"gallery.dimensions.width",
+		"gallery.path",
+		"gallery.path",
+		"login_timestamps",
+		"photo",
+		"user.name",
+		"user.user_id",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paths %v, want %v", got, want)
+	}
+}
+
+func TestWalk_extensions(t *testing.T) {
+	msg := &testproto.Account{Id: proto.Int64(1)}
+	proto.SetExtension(msg, testproto.E_Auditor, &testproto.Owner{Email: proto.String("auditor@example.com")})
+	proto.SetExtension(msg, testproto.E_Note, "note")
+	var got []string
+	Walk(msg, func(path string, _ protoreflect.FieldDescriptor, _ protoreflect.Value) {
+		got = append(got, path)
+	})
+	want := []string{"[testproto.auditor].email", "[testproto.note]", "id"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paths %v, want %v", got, want)
+	}
+	if err := NestedMaskFromPaths(got).Validate(msg); err != nil {
+		t.Errorf("Validate() error %v, want nil", err)
+	}
+}
+
+func TestWalkWithOptions(t *testing.T) {
+	msg := &testproto.Profile{
+		User: &testproto.User{
+			UserId: 1,
+		},
+		Photo: &testproto.Photo{
+			Path:       "path",
+			Dimensions: &testproto.Dimensions{Width: 100},
+		},
+		Gallery: []*testproto.Photo{
+			{Path: "path 1"},
+			{},
+		},
+	}
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{
+			name: "depth-first leaves",
+			opts: WalkOptions{LeavesOnly: true},
+			want: []string{"gallery.path", "gallery", "photo.dimensions.width", "photo.path", "user.user_id"},
+		},
+		{
+			name: "depth-first all fields",
+			opts: WalkOptions{},
+			want: []string{
+				"gallery", "gallery.path", "photo", "photo.dimensions", "photo.dimensions.width", "photo.path", "user",
+				"user.user_id",
+			},
+		},
+		{
+			name: "breadth-first leaves",
+			opts: WalkOptions{LeavesOnly: true, Order: BreadthFirst},
+			want: []string{"gallery", "photo.path", "user.user_id", "gallery.path", "photo.dimensions.width"},
+		},
+		{
+			name: "breadth-first all fields",
+			opts: WalkOptions{Order: BreadthFirst},
+			want: []string{
+				"gallery", "photo", "user", "photo.dimensions", "photo.path", "user.user_id", "gallery.path",
+				"photo.dimensions.width",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			WalkWithOptions(msg, tt.opts, func(path string, _ protoreflect.FieldDescriptor, _ protoreflect.Value) {
+				got = append(got, path)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paths %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnionSetPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgs    []proto.Message
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "union of populated paths",
+			msgs: []proto.Message{
+				&testproto.Profile{
+					User: &testproto.User{UserId: 1},
+					Gallery: []*testproto.Photo{
+						{Path: "path"},
+					},
+				},
+				&testproto.Profile{
+					User:            &testproto.User{UserId: 2, Name: "name"},
+					LoginTimestamps: []int64{1},
+				},
+				&testproto.Profile{},
+			},
+			want: []string{"gallery.path", "login_timestamps", "user.name", "user.user_id"},
+		},
+		{
+			name: "extensions",
+			msgs: func() []proto.Message {
+				a1 := &testproto.Account{Id: proto.Int64(1)}
+				proto.SetExtension(a1, testproto.E_Note, "note")
+				a2 := &testproto.Account{}
+				proto.SetExtension(a2, testproto.E_Auditor, &testproto.Owner{Name: proto.String("auditor")})
+				return []proto.Message{a1, a2}
+			}(),
+			want: []string{"[testproto.auditor].name", "[testproto.note]", "id"},
+		},
+		{
+			name: "no messages",
+			want: []string{},
+		},
+		{
+			name: "different message types",
+			msgs: []proto.Message{
+				&testproto.Profile{},
+				&testproto.User{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnionSetPaths(tt.msgs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paths %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  proto.Message
+		want []string
+	}{
+		{
+			name: "nested messages are descended into",
+			msg:  &testproto.Profile{},
+			want: []string{
+				"attributes", "created_at.nanos", "created_at.seconds", "gallery", "login_timestamps",
+				"photo.dimensions.height", "photo.dimensions.width", "photo.path", "photo.photo_id", "photo.thumbnail",
+				"session_length.nanos", "session_length.seconds", "user.legacy_name", "user.legacy_tags", "user.name",
+				"user.user_id",
+			},
+		},
+		{
+			name: "self-referential message",
+			msg:  &testproto.Node{},
+			want: []string{"children", "name", "next"},
+		},
+		{
+			name: "typed nil message",
+			msg:  (*testproto.Catalog)(nil),
+			want: []string{"sections"},
+		},
+		{
+			name: "nil message",
+			msg:  nil,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllPaths(tt.msg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AllPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	msg := &testproto.Profile{
+		User:  &testproto.User{UserId: 1},
+		Photo: &testproto.Photo{Dimensions: &testproto.Dimensions{Width: 1}},
+	}
+	if err := Validate(msg, AllPaths(msg)); err != nil {
+		t.Errorf("AllPaths() returned invalid paths: %v", err)
+	}
+	want := proto.Clone(msg)
+	Filter(msg, AllPaths(msg))
+	if !proto.Equal(msg, want) {
+		t.Errorf("Filter() with AllPaths() msg %v, want %v", msg, want)
+	}
+}